@@ -0,0 +1,347 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Requests to /api/v1 are tagged with their version, which decides the shape of error replies
+const apiVersionKey = "api_version"
+
+// Machine-readable codes sent in the error envelope of /api/v1, so clients don't have to match on
+// messages. Most failures use the code for their status, the rest say more about what went wrong.
+const (
+	codeInvalidRequest     = "invalid_request"
+	codeInvalidID          = "invalid_id"
+	codeForbidden          = "forbidden"
+	codeNotFound           = "not_found"
+	codeConflict           = "conflict"
+	codeUnavailable        = "unavailable"
+	codeInternal           = "internal_error"
+	codeRegistrationClosed = "registration_closed"
+	codeAlreadyRegistered  = "already_registered"
+	codeInvalidTransition  = "invalid_transition"
+	codeApprovalRequired   = "approval_required"
+	codeSelfApproval       = "self_approval"
+)
+
+// APIError is the error envelope every failed /api/v1 request is answered with
+type APIError struct {
+	Error APIErrorDetail `json:"error"`
+}
+
+type APIErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIMessage answers requests that have nothing to send back but whether they worked, and every
+// failed request to the routes before /api/v1
+type APIMessage struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidRequest
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	default:
+		return codeInternal
+	}
+}
+
+// sendError replies to a failed request. /api/v1 gets the error envelope, the older routes keep
+// the success and message they have always sent.
+func sendError(c *gin.Context, status int, code string, message string) {
+	if c.GetInt(apiVersionKey) >= 1 {
+		c.JSON(status, APIError{Error: APIErrorDetail{Code: code, Message: message}})
+		return
+	}
+	c.JSON(status, APIMessage{Success: false, Message: message})
+}
+
+func apiVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(apiVersionKey, version)
+		c.Next()
+	}
+}
+
+var successorParam = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// deprecated marks a route kept for older clients and links to the /api/v1 route replacing it.
+// Placeholders like {event} in the successor are filled from the request's query string, and
+// the link is left out if the request doesn't have them.
+func deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+
+		resolved := true
+		link := successorParam.ReplaceAllStringFunc(successor, func(placeholder string) string {
+			value := c.Query(strings.Trim(placeholder, "{}"))
+			if value == "" {
+				resolved = false
+			}
+			return url.PathEscape(value)
+		})
+		if resolved {
+			c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+		}
+		c.Next()
+	}
+}
+
+// idParam reads a numeric ID from the path of /api/v1 routes, or the query string of the older
+// ones. Anything else, such as the "NaN" the dashboard sends when nothing is selected, is
+// answered with a 400.
+func idParam(c *gin.Context, name string) (int, bool) {
+	value := c.Param(name)
+	if value == "" {
+		value = c.Query(name)
+	}
+
+	id, err := strconv.Atoi(value)
+	if err != nil || id < 1 {
+		msg := fmt.Sprintf("Invalid %s ID %q", name, value)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendError(c, http.StatusBadRequest, codeInvalidID, msg)
+		return 0, false
+	}
+	return id, true
+}
+
+// eventByID looks up an event, replying with a 404 if there isn't one
+func eventByID(c *gin.Context, eventID int) (*database.Event, bool) {
+	event, err := database.GetEventByID(c.Request.Context(), eventID)
+	if errors.Is(err, database.ErrEventNotFound) {
+		sendError(c, http.StatusNotFound, codeNotFound, "Event not found")
+		return nil, false
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get event: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendError(c, http.StatusInternalServerError, codeInternal, msg)
+		return nil, false
+	}
+	return event, true
+}
+
+// publicEventByID looks up an event for the public pages, where drafts stay hidden until another
+// admin approves them
+func publicEventByID(c *gin.Context, eventID int) (*database.Event, bool) {
+	event, ok := eventByID(c, eventID)
+	if ok && event.EventStatus == database.EventStatusDraft {
+		sendError(c, http.StatusNotFound, codeNotFound, "Event not found")
+		return nil, false
+	}
+	return event, ok
+}
+
+// publicEvent is what the register page gets about an event, leaving out which admins created
+// and approved it
+type publicEvent struct {
+	EventID       int                  `json:"event_id"`
+	EventLocation string               `json:"session_location"`
+	EventDate     string               `json:"session_date"`
+	MeetLocation  string               `json:"meet_point"`
+	MeetTime      string               `json:"meet_time"`
+	TotalSeats    int                  `json:"total_seats"`
+	SeatsTaken    int                  `json:"current_seats"`
+	RequireMember bool                 `json:"require_member"`
+	OpenDatetime  string               `json:"open_date"`
+	CloseDatetime string               `json:"close_date"`
+	EventStatus   database.EventStatus `json:"status"`
+
+	MeetAt       time.Time `json:"meet_at"`
+	SessionStart time.Time `json:"session_start"`
+	SessionEnd   time.Time `json:"session_end"`
+
+	CancellationReason string `json:"cancellation_reason"`
+	CancelledAt        string `json:"cancelled_at"`
+
+	AllocationMode database.AllocationMode `json:"allocation_mode"`
+	BallotWeighted bool                    `json:"ballot_weighted"`
+	BallotDrawnAt  string                  `json:"ballot_drawn_at"`
+}
+
+func newPublicEvent(event database.Event) publicEvent {
+	return publicEvent{
+		EventID:       event.EventID,
+		EventLocation: event.EventLocation,
+		EventDate:     event.EventDate,
+		MeetLocation:  event.MeetLocation,
+		MeetTime:      event.MeetTime,
+		TotalSeats:    event.TotalSeats,
+		SeatsTaken:    event.SeatsTaken,
+		RequireMember: event.RequireMember,
+		OpenDatetime:  event.OpenDatetime,
+		CloseDatetime: event.CloseDatetime,
+		EventStatus:   event.EventStatus,
+
+		MeetAt:       event.MeetAt,
+		SessionStart: event.SessionStart,
+		SessionEnd:   event.SessionEnd,
+
+		CancellationReason: event.CancellationReason,
+		CancelledAt:        event.CancelledAt,
+
+		AllocationMode: event.AllocationMode,
+		BallotWeighted: event.BallotWeighted,
+		BallotDrawnAt:  event.BallotDrawnAt,
+	}
+}
+
+// pathEventID puts the event in the path of /api/v1 routes into a request body's event ID, the
+// older routes send it in the body
+func pathEventID(c *gin.Context, eventID *int) bool {
+	if c.Param("event") == "" {
+		return true
+	}
+	id, ok := idParam(c, "event")
+	*eventID = id
+	return ok
+}
+
+// inEvent checks the participant, vehicle or offer in an /api/v1 path belongs to the event in
+// the path, so nothing can be changed through another event's URL
+func inEvent(name string, notFound error, eventOf func(ctx context.Context, id int) (int, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eventID, ok := idParam(c, "event")
+		if !ok {
+			c.Abort()
+			return
+		}
+		id, ok := idParam(c, name)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		resourceEventID, err := eventOf(c.Request.Context(), id)
+		if errors.Is(err, notFound) || (err == nil && resourceEventID != eventID) {
+			sendError(c, http.StatusNotFound, codeNotFound, fmt.Sprintf("%s %d not found for event %d", name, id, eventID))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			msg := fmt.Sprintf("Failed to find %s: %s", name, err)
+			logger.ErrorContext(c.Request.Context(), msg)
+			sendError(c, http.StatusInternalServerError, codeInternal, msg)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func participantEvent(ctx context.Context, participantID int) (int, error) {
+	participant, err := database.GetParticipantByID(ctx, participantID)
+	if err != nil {
+		return 0, err
+	}
+	return participant.EventID, nil
+}
+
+func vehicleEvent(ctx context.Context, vehicleID int) (int, error) {
+	vehicle, err := database.GetVehicleByID(ctx, vehicleID)
+	if err != nil {
+		return 0, err
+	}
+	return vehicle.EventID, nil
+}
+
+func offerEvent(ctx context.Context, offerID int) (int, error) {
+	offer, err := database.GetDriverOfferByID(ctx, offerID)
+	if err != nil {
+		return 0, err
+	}
+	return offer.EventID, nil
+}
+
+// handleAPINotFound answers unknown /api/v1 paths with the error envelope, anything else gets
+// gin's usual reply
+func handleAPINotFound(c *gin.Context) {
+	if !strings.HasPrefix(c.Request.URL.Path, "/api/v1/") {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+	c.Set(apiVersionKey, 1)
+	sendError(c, http.StatusNotFound, codeNotFound, "No such endpoint")
+}
+
+// registerAPIv1 adds the versioned API, which names resources in the path instead of the query
+// string
+func registerAPIv1(router *gin.Engine, encryptionPassPhrase string) {
+	admin := authMiddleware(encryptionPassPhrase)
+	participant := inEvent("participant", database.ErrParticipantNotFound, participantEvent)
+	vehicle := inEvent("vehicle", database.ErrVehicleNotFound, vehicleEvent)
+	offer := inEvent("offer", database.ErrOfferNotFound, offerEvent)
+
+	v1 := router.Group("/api/v1", apiVersion(1))
+
+	v1.POST("/login", handleAdminLogin)
+
+	v1.GET("/events/upcoming", handleUpcomingEvents)
+	v1.GET("/events/:event", handleEventDetails)
+	v1.GET("/events/:event/stream", handleSeatStream)
+	v1.POST("/events/:event/registrations", handleAPIRegister)
+	v1.POST("/events/:event/driver-offers", handleOfferToDrive)
+
+	v1.GET("/registrations/:token", handleGetRegistration)
+	v1.DELETE("/registrations/:token", handleCancelRegistration)
+	v1.PUT("/registrations/:token/reminders", handleSetRegistrationReminders)
+
+	v1.GET("/events", admin, handleGetEvents)
+	v1.POST("/events", admin, handleCreateEvent)
+	v1.POST("/events/import", admin, handleImportEvents)
+	v1.GET("/events/pending", admin, handleGetPendingEvents)
+	v1.PUT("/events/:event", admin, handleUpdateEvent)
+	v1.DELETE("/events/:event", admin, handleDeleteEvent)
+	v1.POST("/events/:event/cancel", admin, handleCancelEvent)
+	v1.POST("/events/:event/approve", admin, handleApproveEvent)
+	v1.POST("/events/:event/reopen", admin, handleReopenEvent)
+	v1.POST("/events/:event/complete", admin, handleCompleteEvent)
+	v1.GET("/events/:event/export", admin, handleExportParticipants)
+
+	v1.GET("/events/:event/participants", admin, handleGetEventParticipants)
+	v1.DELETE("/events/:event/participants/:participant", admin, participant, handleDeleteParticipant)
+	v1.PUT("/events/:event/participants/:participant/attendance", admin, participant, handleSetAttendance)
+	v1.PUT("/events/:event/participants/:participant/vehicle", admin, participant, handleAssignVehicle)
+
+	v1.GET("/events/:event/vehicles", admin, handleGetVehicles)
+	v1.POST("/events/:event/vehicles", admin, handleAddVehicle)
+	v1.POST("/events/:event/vehicles/assign", admin, handleAutoAssignVehicles)
+	v1.PUT("/events/:event/vehicles/:vehicle", admin, vehicle, handleUpdateVehicle)
+	v1.DELETE("/events/:event/vehicles/:vehicle", admin, vehicle, handleDeleteVehicle)
+
+	v1.GET("/events/:event/driver-offers", admin, handleGetDriverOffers)
+	v1.POST("/events/:event/driver-offers/:offer/approve", admin, offer, handleApproveDriverOffer)
+	v1.POST("/events/:event/driver-offers/:offer/decline", admin, offer, handleDeclineDriverOffer)
+
+	v1.GET("/attendance", admin, handleGetAttendanceHistory)
+	v1.GET("/members", admin, handleGetMembers)
+	v1.POST("/members", admin, handleImportMembers)
+	v1.GET("/people", admin, handleGetPeople)
+	v1.POST("/people/merge", admin, handleMergePeople)
+	v1.PUT("/people/:person/driver", admin, handleSetQualifiedDriver)
+	v1.GET("/export/events", admin, handleExportEvents)
+}
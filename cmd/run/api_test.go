@@ -0,0 +1,173 @@
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// serve sends a request through a router, returning the recorded reply
+func serve(router http.Handler, method string, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+// errorReply reads the code and message of an error reply in either the /api/v1 envelope or the
+// older success and message shape
+func errorReply(t *testing.T, recorder *httptest.ResponseRecorder) (code string, message string) {
+	t.Helper()
+
+	var reply struct {
+		Error   *APIErrorDetail `json:"error"`
+		Success *bool           `json:"success"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &reply); err != nil {
+		t.Fatalf("unreadable reply %q: %v", recorder.Body.String(), err)
+	}
+	if reply.Error != nil {
+		return reply.Error.Code, reply.Error.Message
+	}
+	if reply.Success == nil || *reply.Success {
+		t.Fatalf("reply %q isn't a failure", recorder.Body.String())
+	}
+	return "", reply.Message
+}
+
+func TestIDParam(t *testing.T) {
+	router := gin.New()
+	handler := func(c *gin.Context) {
+		id, ok := idParam(c, "event")
+		if !ok {
+			return
+		}
+		c.String(http.StatusOK, strconv.Itoa(id))
+	}
+	router.GET("/api/v1/events/:event", apiVersion(1), handler)
+	router.GET("/api/event", handler)
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		// The ID read for a 200, or the error code sent by /api/v1 otherwise
+		want string
+	}{
+		{name: "path", target: "/api/v1/events/12", status: http.StatusOK, want: "12"},
+		{name: "query", target: "/api/event?event=7", status: http.StatusOK, want: "7"},
+		{name: "NaN in path", target: "/api/v1/events/NaN", status: http.StatusBadRequest, want: codeInvalidID},
+		{name: "zero", target: "/api/v1/events/0", status: http.StatusBadRequest, want: codeInvalidID},
+		{name: "negative", target: "/api/v1/events/-3", status: http.StatusBadRequest, want: codeInvalidID},
+		{name: "exponent", target: "/api/v1/events/1e3", status: http.StatusBadRequest, want: codeInvalidID},
+		{name: "NaN in query", target: "/api/event?event=NaN", status: http.StatusBadRequest},
+		{name: "missing from query", target: "/api/event", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, http.MethodGet, test.target)
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.status == http.StatusOK {
+				if got := recorder.Body.String(); got != test.want {
+					t.Errorf("ID = %s, want %s", got, test.want)
+				}
+				return
+			}
+			if code, _ := errorReply(t, recorder); code != test.want {
+				t.Errorf("code = %q, want %q", code, test.want)
+			}
+		})
+	}
+}
+
+func TestInEvent(t *testing.T) {
+	errThingNotFound := errors.New("thing not found")
+	things := map[int]int{1: 10, 2: 20}
+	thingEvent := func(ctx context.Context, id int) (int, error) {
+		if id == 99 {
+			return 0, errors.New("database is locked")
+		}
+		eventID, ok := things[id]
+		if !ok {
+			return 0, errThingNotFound
+		}
+		return eventID, nil
+	}
+
+	router := gin.New()
+	router.GET("/api/v1/events/:event/things/:thing", apiVersion(1), inEvent("thing", errThingNotFound, thingEvent), func(c *gin.Context) {
+		c.String(http.StatusOK, "reached")
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+		code   string
+	}{
+		{name: "in the event", target: "/api/v1/events/10/things/1", status: http.StatusOK},
+		{name: "in another event", target: "/api/v1/events/10/things/2", status: http.StatusNotFound, code: codeNotFound},
+		{name: "missing", target: "/api/v1/events/10/things/3", status: http.StatusNotFound, code: codeNotFound},
+		{name: "lookup fails", target: "/api/v1/events/10/things/99", status: http.StatusInternalServerError, code: codeInternal},
+		{name: "invalid event", target: "/api/v1/events/NaN/things/1", status: http.StatusBadRequest, code: codeInvalidID},
+		{name: "invalid thing", target: "/api/v1/events/10/things/NaN", status: http.StatusBadRequest, code: codeInvalidID},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, http.MethodGet, test.target)
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.status == http.StatusOK {
+				if recorder.Body.String() != "reached" {
+					t.Errorf("handler wasn't reached: %s", recorder.Body)
+				}
+				return
+			}
+			// Only the error is sent, the handler after inEvent must not run
+			if code, _ := errorReply(t, recorder); code != test.code {
+				t.Errorf("code = %q, want %q", code, test.code)
+			}
+		})
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	router := gin.New()
+	router.GET("/api/participants", deprecated("/api/v1/events/{event}/participants"), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	recorder := serve(router, http.MethodGet, "/api/participants?event=4")
+	if recorder.Header().Get("Deprecation") != "true" {
+		t.Errorf("Deprecation header missing")
+	}
+	if got, want := recorder.Header().Get("Link"), `</api/v1/events/4/participants>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %s, want %s", got, want)
+	}
+
+	// Without the event there's nothing to link to
+	recorder = serve(router, http.MethodGet, "/api/participants")
+	if link := recorder.Header().Get("Link"); link != "" {
+		t.Errorf("Link = %s, want none", link)
+	}
+}
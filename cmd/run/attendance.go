@@ -0,0 +1,116 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func handleSetAttendance(c *gin.Context) {
+	participantID, ok := idParam(c, "participant")
+	if !ok {
+		return
+	}
+
+	var attendanceData struct {
+		Attendance database.AttendanceStatus `json:"attendance"`
+	}
+	if err := c.ShouldBindJSON(&attendanceData); err != nil {
+		msg := fmt.Sprintf("Invalid attendance: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	err := database.SetParticipantAttendance(c.Request.Context(), participantID, attendanceData.Attendance)
+	if errors.Is(err, database.ErrParticipantNotFound) {
+		sendError(c, http.StatusNotFound, codeNotFound, "Participant not found")
+		return
+	}
+	if errors.Is(err, database.ErrAttendanceNotSeated) {
+		sendError(c, http.StatusConflict, codeConflict, "Attendance can only be recorded for participants with a seat")
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to update attendance: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg, "participant_id", participantID)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Updated attendance", "participant_id", participantID, "attendance", attendanceData.Attendance)
+	sendResponse(c, true, "Attendance updated", http.StatusOK)
+}
+
+// handleGetAttendanceHistory looks a person up by ID, or by name for anyone who hasn't got their ID
+func handleGetAttendanceHistory(c *gin.Context) {
+	var personID int
+	if personIDParam := c.Query("person"); personIDParam != "" {
+		id, err := strconv.Atoi(personIDParam)
+		if err != nil {
+			msg := fmt.Sprintf("Failed to find person: %s", err)
+			logger.WarnContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusNotFound)
+			return
+		}
+		personID = id
+	} else {
+		firstName := strings.TrimSpace(c.Query("first_name"))
+		surname := strings.TrimSpace(c.Query("last_name"))
+		if firstName == "" || surname == "" {
+			sendResponse(c, false, "Either person or both first_name and last_name are required", http.StatusBadRequest)
+			return
+		}
+
+		id, err := database.FindPerson(c.Request.Context(), database.Registrant{FirstName: firstName, LastName: surname})
+		if err != nil {
+			msg := fmt.Sprintf("Failed to find person: %s", err)
+			logger.WarnContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusNotFound)
+			return
+		}
+		personID = id
+	}
+
+	history, err := database.GetAttendanceHistory(c.Request.Context(), personID)
+	if errors.Is(err, database.ErrPersonNotFound) {
+		sendResponse(c, false, "Failed to find person", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get attendance history: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history":    history,
+		"allocation": allocationPolicy.Evaluate(history, time.Now()),
+	})
+}
+
+// registrantHistory returns the attendance history of whoever a registrant matches, which is
+// empty for someone registering for the first time
+func registrantHistory(ctx context.Context, registrant database.Registrant) (*database.AttendanceHistory, error) {
+	personID, err := database.FindPerson(ctx, registrant)
+	if errors.Is(err, database.ErrPersonNotFound) {
+		return &database.AttendanceHistory{
+			FirstName: registrant.FirstName,
+			LastName:  registrant.LastName,
+			Records:   []database.AttendanceRecord{},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return database.GetAttendanceHistory(ctx, personID)
+}
@@ -0,0 +1,156 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/ical"
+	"github.com/gin-gonic/gin"
+)
+
+// Domain that event UIDs are made unique with, so calendar apps can tell our events apart from others
+var calendarDomain = func() string {
+	site, err := url.Parse(database.SiteURL)
+	if err != nil || site.Hostname() == "" {
+		return "localhost"
+	}
+	return site.Hostname()
+}()
+
+// calendarEvent describes an event for calendar apps. Events with a date or meet time that can't
+// be read have no start time and are left out of calendars.
+func calendarEvent(event database.Event) (ical.Event, bool) {
+	start, err := event.StartTime()
+	if err != nil {
+		return ical.Event{}, false
+	}
+
+	description := fmt.Sprintf("Meet at %s at %s.\n\nRegister or check your seat: %s", event.MeetLocation, event.MeetTime, event.GetLink())
+	if event.RequireMember {
+		description += "\n\nThis session is for paid members only."
+	}
+	cancelled := event.EventStatus == database.EventStatusCancelled
+
+	end := event.SessionEnd
+	if !end.After(start) {
+		end = start.Add(database.DefaultSessionLength)
+	}
+	if cancelled {
+		description = "This session has been cancelled. " + event.CancellationReason
+	}
+
+	return ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", event.EventID, calendarDomain),
+		Summary:     "Climbing: " + event.EventLocation,
+		Location:    event.MeetLocation,
+		Description: description,
+		URL:         event.GetLink(),
+		Start:       start,
+		End:         end,
+		Cancelled:   cancelled,
+	}, true
+}
+
+func sendCalendar(c *gin.Context, name string, filename string, events []database.Event) {
+	var entries []ical.Event
+	for _, event := range events {
+		if entry, ok := calendarEvent(event); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	c.Header("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	c.Status(http.StatusOK)
+	if err := ical.Write(c.Writer, name, entries); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to write calendar", "error", err)
+	}
+}
+
+// handleCalendarFeed serves every upcoming session as a feed calendar apps can subscribe to
+func handleCalendarFeed(c *gin.Context) {
+	year, month, day := time.Now().Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+
+	events, err := database.GetEvents(c.Request.Context(), database.EventQuery{From: today, Order: database.OrderByStart})
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get events: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	var upcoming []database.Event
+	for _, event := range events {
+		if event.EventStatus != database.EventStatusDraft {
+			upcoming = append(upcoming, event)
+		}
+	}
+
+	sendCalendar(c, "UoW Climbing Society", "", upcoming)
+}
+
+// handleEventCalendar downloads a single session to add to a calendar
+func handleEventCalendar(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	event, err := database.GetEventByID(c.Request.Context(), eventID)
+	if err == nil && event.EventStatus == database.EventStatusDraft {
+		err = database.ErrEventNotFound
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get event: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusNotFound)
+		return
+	}
+	if _, ok := calendarEvent(*event); !ok {
+		msg := "Event has no valid date or meet time"
+		logger.WarnContext(c.Request.Context(), msg, "event_id", eventID)
+		sendResponse(c, false, msg, http.StatusNotFound)
+		return
+	}
+
+	sendCalendar(c, "UoW Climbing Society", fmt.Sprintf("climbing-%d.ics", eventID), []database.Event{*event})
+}
+
+// handlePersonalCalendar serves a feed of only the sessions someone has a seat on. The token in
+// the link is the only thing identifying them, so it is kept out of the logs.
+func handlePersonalCalendar(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	events, err := database.GetCalendarEvents(c.Request.Context(), token)
+	if errors.Is(err, database.ErrPersonNotFound) {
+		sendResponse(c, false, "Calendar not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get calendar: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	sendCalendar(c, "My climbing sessions", "", events)
+}
+
+// personalCalendarLink returns the link to a person's private calendar feed, or nothing if it
+// couldn't be made, since registering shouldn't fail because of it
+func personalCalendarLink(c *gin.Context, personID int) string {
+	token, err := database.CalendarToken(c.Request.Context(), personID)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to get calendar token", "person_id", personID, "error", err)
+		return ""
+	}
+	return fmt.Sprintf("%s/calendar/person/%s.ics", database.SiteURL, token)
+}
@@ -0,0 +1,75 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/emailer"
+	"github.com/gin-gonic/gin"
+)
+
+// Sends emails, swapped out by tests
+var sendEmail = emailer.SendEmail
+
+// How long a confirmation email has to send once the registrant has had their reply
+const confirmationTimeout = time.Minute
+
+var confirmationTemplate = template.Must(template.New("confirmation").Parse(`
+Hi {{ .Participant.DisplayName }},
+
+Thanks for signing up for the climbing session at {{ .Event.EventLocation }} on {{ .Event.EventDate }}.
+{{ .Message }}
+
+Meet at {{ .Event.MeetLocation }} at {{ .Event.MeetTime }}.
+{{- if .Calendar }}
+
+Keep your sessions in your calendar by subscribing to this link, which is only for you:
+{{ .Calendar }}
+{{- end }}
+
+UoW Climbing Society
+`))
+
+// sendRegistered replies to a successful registration and emails the registrant a confirmation
+// with the link to their calendar feed, which gains the session once they have a seat. The link
+// lets anyone holding it see where they'll be, so it only goes to their inbox.
+func sendRegistered(c *gin.Context, event *database.Event, participant *database.Participant, message string) {
+	sendResponse(c, true, message, http.StatusOK)
+
+	if participant.Email == "" {
+		return
+	}
+
+	output := &strings.Builder{}
+	err := confirmationTemplate.Execute(output, struct {
+		Event       *database.Event
+		Participant *database.Participant
+		Message     string
+		Calendar    string
+	}{
+		Event:       event,
+		Participant: participant,
+		Message:     message,
+		Calendar:    personalCalendarLink(c, participant.PersonID),
+	})
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to render confirmation", "participant_id", participant.ParticipantID, "error", err)
+		return
+	}
+
+	// The reply has gone, so the email carries on without the request
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), confirmationTimeout)
+	subject := fmt.Sprintf("Climbing Session Signup - %s %s", event.EventLocation, event.EventDate)
+	send := sendEmail
+	go func() {
+		defer cancel()
+		if err := send(ctx, participant.Email, subject, output.String()); err != nil {
+			logger.ErrorContext(ctx, "Failed to send confirmation", "participant_id", participant.ParticipantID, "error", err)
+		}
+	}()
+}
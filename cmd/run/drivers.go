@@ -0,0 +1,221 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Most passenger seats a driver can offer, anything more is almost certainly a typo
+const maxOfferedSeats = 8
+
+type DriverOfferData struct {
+	RegistrationData
+	VehicleName    string `json:"vehicle_name"`
+	Capacity       int    `json:"capacity"`
+	DeparturePoint string `json:"departure_point"`
+}
+
+// sendOfferError replies with the status that fits a failed driver offer change
+func sendOfferError(c *gin.Context, action string, err error) {
+	msg := fmt.Sprintf("Failed to %s: %s", action, err)
+	switch {
+	case errors.Is(err, database.ErrOfferNotFound):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusNotFound)
+	case errors.Is(err, database.ErrOfferDecided), errors.Is(err, database.ErrNotEnoughSeats):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusConflict)
+	default:
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+	}
+}
+
+// handleOfferToDrive takes an offer from a qualified driver to bring their vehicle, which the
+// committee approves before its seats are added to the event
+func handleOfferToDrive(c *gin.Context) {
+	var offerData DriverOfferData
+	if err := c.ShouldBindJSON(&offerData); err != nil {
+		msg := fmt.Sprintf("Invalid offer: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	if !pathEventID(c, &offerData.EventID) {
+		return
+	}
+
+	firstName, surname, preferredName, err := registrationNames(offerData.RegistrationData)
+	if err != nil {
+		msg := fmt.Sprintf("Invalid name, please check your given and family name (%v)", err)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
+
+	// Drivers are sent their passenger list, so an email address is needed
+	address, err := mail.ParseAddress(strings.TrimSpace(offerData.Email))
+	if err != nil {
+		sendResponse(c, false, "A valid email address is required to offer to drive", http.StatusBadRequest)
+		return
+	}
+
+	if offerData.Capacity < 1 || offerData.Capacity > maxOfferedSeats {
+		msg := fmt.Sprintf("Please offer between 1 and %d passenger seats", maxOfferedSeats)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	event, ok := publicEventByID(c, offerData.EventID)
+	if !ok {
+		return
+	}
+
+	openTime, err := event.OpenTime()
+	if err != nil {
+		msg := "Unable to parse event open date"
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+	closeTime, err := event.CloseTime()
+	if err != nil {
+		msg := "Unable to parse event close date"
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+	now := time.Now()
+	if !event.EventStatus.AcceptingRegistrations() || now.Before(openTime) || !now.Before(closeTime) {
+		msg := "The event is not currently open for registration"
+		sendError(c, http.StatusConflict, codeRegistrationClosed, msg)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
+
+	registrant := database.Registrant{
+		FirstName:     firstName,
+		LastName:      surname,
+		PreferredName: preferredName,
+		Email:         address.Address,
+	}
+	offer, err := database.OfferToDrive(c.Request.Context(), registrant, database.DriverOffer{
+		EventID:        event.EventID,
+		VehicleName:    strings.TrimSpace(offerData.VehicleName),
+		Capacity:       offerData.Capacity,
+		DeparturePoint: strings.TrimSpace(offerData.DeparturePoint),
+	})
+	if errors.Is(err, database.ErrNotQualifiedDriver) {
+		msg := "Only drivers approved by the committee can offer to drive, please speak to the committee"
+		sendResponse(c, false, msg, http.StatusForbidden)
+		logger.WarnContext(c.Request.Context(), "Driver offer from unqualified driver", "first_name", firstName, "last_name", surname, "event_id", event.EventID)
+		return
+	}
+	if errors.Is(err, database.ErrDuplicateOffer) {
+		sendError(c, http.StatusConflict, codeAlreadyRegistered, "You have already offered to drive to this event")
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to update database: %v", err)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Driver offered vehicle", "offer_id", offer.OfferID, "event_id", event.EventID, "capacity", offer.Capacity)
+	sendResponse(c, true, "Thanks for offering to drive! The committee will confirm your vehicle soon", http.StatusOK)
+}
+
+func handleGetDriverOffers(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+	if _, ok := eventByID(c, eventID); !ok {
+		return
+	}
+
+	offers, err := database.GetDriverOffers(c.Request.Context(), eventID)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get driver offers: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, offers)
+}
+
+// handleApproveDriverOffer adds the offered vehicle to the event and gives its seats to the waitlist
+func handleApproveDriverOffer(c *gin.Context) {
+	offerID, ok := idParam(c, "offer")
+	if !ok {
+		return
+	}
+
+	offer, err := database.ApproveDriverOffer(c.Request.Context(), offerID)
+	if err != nil {
+		sendOfferError(c, "approve driver offer", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Approved driver offer", "offer_id", offerID, "vehicle_id", offer.VehicleID, "event_id", offer.EventID)
+	vehiclesChanged(c.Request.Context(), offer.EventID)
+
+	sendResponse(c, true, "Driver approved, their vehicle has been added", http.StatusOK)
+}
+
+func handleDeclineDriverOffer(c *gin.Context) {
+	offerID, ok := idParam(c, "offer")
+	if !ok {
+		return
+	}
+
+	if err := database.DeclineDriverOffer(c.Request.Context(), offerID); err != nil {
+		sendOfferError(c, "decline driver offer", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Declined driver offer", "offer_id", offerID)
+	sendResponse(c, true, "Driver offer declined", http.StatusOK)
+}
+
+// handleSetQualifiedDriver marks whether a person is allowed to offer to drive
+func handleSetQualifiedDriver(c *gin.Context) {
+	personID, ok := idParam(c, "person")
+	if !ok {
+		return
+	}
+
+	var driverData struct {
+		Qualified bool `json:"qualified"`
+	}
+	if err := c.ShouldBindJSON(&driverData); err != nil {
+		msg := fmt.Sprintf("Invalid driver: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	err := database.SetQualifiedDriver(c.Request.Context(), personID, driverData.Qualified)
+	if errors.Is(err, database.ErrPersonNotFound) {
+		sendResponse(c, false, "Person not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to update person: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Updated qualified driver", "person_id", personID, "qualified", driverData.Qualified)
+	sendResponse(c, true, "Driver updated", http.StatusOK)
+}
@@ -0,0 +1,80 @@
+package run
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/export"
+	"github.com/gin-gonic/gin"
+)
+
+// exportFormat reads the format query param, defaulting to CSV
+func exportFormat(c *gin.Context) (export.Format, error) {
+	format := export.Format(c.DefaultQuery("format", string(export.FormatCSV)))
+	if !format.Valid() {
+		return "", fmt.Errorf("unknown export format %q, use csv or xlsx", format)
+	}
+	return format, nil
+}
+
+func sendExport(c *gin.Context, table export.Table, format export.Format, filename string) {
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+"."+string(format)))
+	c.Status(http.StatusOK)
+	if err := table.Write(c.Writer, format); err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to write export", "error", err)
+	}
+}
+
+func handleExportParticipants(c *gin.Context) {
+	format, err := exportFormat(c)
+	if err != nil {
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	event, ok := eventByID(c, eventID)
+	if !ok {
+		return
+	}
+
+	participants, err := event.GetParticipants(c.Request.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get event participants: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	sendExport(c, export.ParticipantsTable(*event, participants), format, fmt.Sprintf("event-%d-participants", eventID))
+}
+
+func handleExportEvents(c *gin.Context) {
+	format, err := exportFormat(c)
+	if err != nil {
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := export.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, err := database.GetEvents(c.Request.Context(), database.EventQuery{})
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get events: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	sendExport(c, export.EventsTable(export.EventsBetween(events, from, to)), format, "events")
+}
@@ -0,0 +1,68 @@
+package run
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/eventimport"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/scheduler"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest schedule upload accepted, a term of events is a few kilobytes
+const maxScheduleSize = 1 << 20
+
+func handleImportEvents(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	body, filename, err := readUpload(c, maxScheduleSize)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to read schedule upload: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	format := eventimport.Format(c.Query("format"))
+	if format == "" {
+		format, err = eventimport.FormatFor(filename, c.ContentType())
+		if err != nil {
+			sendResponse(c, false, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := eventimport.Parse(body, format)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to parse schedule: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	report, err := eventimport.Import(c.Request.Context(), rows, dryRun, adminUsername(c))
+	if err != nil {
+		msg := fmt.Sprintf("Failed to import events: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	for _, row := range report.Rows {
+		if row.EventID != 0 {
+			scheduler.RescheduleEvent(c.Request.Context(), row.EventID)
+		}
+	}
+	if report.Created > 0 {
+		invalidateUpcoming()
+	}
+
+	status := http.StatusOK
+	if !report.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	logger.InfoContext(c.Request.Context(), "Imported events", "rows", len(report.Rows), "created", report.Created, "dry_run", dryRun, "valid", report.Valid)
+	c.JSON(status, report)
+}
@@ -0,0 +1,201 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+// Longest cancellation reason accepted, it's sent in emails and shown on the register page
+const maxCancellationReason = 500
+
+// handleTransition updates everything showing an event when its status changes
+func handleTransition(ctx context.Context, transition database.Transition) {
+	eventID := transition.Event.EventID
+	logger.InfoContext(ctx, "Event changed status", "event_id", eventID, "from", transition.From, "to", transition.To)
+
+	invalidateUpcoming()
+
+	change := live.ChangeUpdated
+	switch transition.To {
+	case database.EventStatusClosed:
+		change = live.ChangeClosed
+	case database.EventStatusCancelled:
+		change = live.ChangeCancelled
+	}
+	live.Publish(ctx, eventID, change)
+
+	err := webhook.Send(ctx, webhook.KindEventStatusChanged, struct {
+		EventID  int                  `json:"event_id"`
+		Location string               `json:"session_location"`
+		Date     string               `json:"session_date"`
+		From     database.EventStatus `json:"from"`
+		To       database.EventStatus `json:"to"`
+	}{
+		EventID:  eventID,
+		Location: transition.Event.EventLocation,
+		Date:     transition.Event.EventDate,
+		From:     transition.From,
+		To:       transition.To,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to send status change webhook", "event_id", eventID, "error", err)
+	}
+}
+
+// sendTransitionError replies with the status that fits a failed status change
+func sendTransitionError(c *gin.Context, action string, err error) {
+	msg := fmt.Sprintf("Failed to %s: %s", action, err)
+	switch {
+	case errors.Is(err, database.ErrEventNotFound):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusNotFound)
+	case errors.Is(err, database.ErrInvalidTransition):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendError(c, http.StatusConflict, codeInvalidTransition, msg)
+	case errors.Is(err, database.ErrApprovalRequired):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendError(c, http.StatusConflict, codeApprovalRequired, msg)
+	case errors.Is(err, database.ErrSelfApproval):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendError(c, http.StatusForbidden, codeSelfApproval, msg)
+	default:
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+	}
+}
+
+// handleCancelEvent cancels an event and lets everyone registered know. Unlike deleting, the
+// event and its registrations are kept and the register page shows the cancellation.
+func handleCancelEvent(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	var cancelData struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&cancelData); err != nil {
+		msg := fmt.Sprintf("Invalid cancellation: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(cancelData.Reason)
+	if len(reason) > maxCancellationReason {
+		msg := fmt.Sprintf("Cancellation reason must be at most %d characters", maxCancellationReason)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	// The scheduler sends the cancellation notices once it hears about the change
+	if _, err := database.CancelEvent(c.Request.Context(), eventID, reason); err != nil {
+		sendTransitionError(c, "cancel event", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Cancelled event", "event_id", eventID, "reason", reason)
+	sendResponse(c, true, "Event cancelled, everyone registered will be emailed", http.StatusOK)
+}
+
+func handleGetPendingEvents(c *gin.Context) {
+	events, err := database.GetPendingEvents(c.Request.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get pending events: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// handleApproveEvent schedules a draft event so it's announced when signups open. It has to be
+// approved by a different admin to the one who created it.
+func handleApproveEvent(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	approver := adminUsername(c)
+	event, err := database.ApproveEvent(c.Request.Context(), eventID, approver)
+	if err != nil {
+		sendTransitionError(c, "approve event", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Approved event", "event_id", eventID, "created_by", event.CreatedBy, "approved_by", approver)
+	sendResponse(c, true, "Event approved, it will be announced when signups open", http.StatusOK)
+}
+
+// handleReopenEvent takes registrations for a closed event again until a new close time, for when
+// the committee finds more seats after signups close
+func handleReopenEvent(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	var reopenData struct {
+		CloseDatetime string `json:"close_date"`
+	}
+	if err := c.ShouldBindJSON(&reopenData); err != nil {
+		msg := fmt.Sprintf("Invalid reopen: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	closeTime, err := time.ParseInLocation(database.DatetimeFormat, strings.TrimSpace(reopenData.CloseDatetime), time.Local)
+	if err != nil {
+		msg := fmt.Sprintf("Close date must look like %s", database.DatetimeFormat)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	if !closeTime.After(time.Now()) {
+		sendResponse(c, false, "Close date must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := database.ReopenEvent(c.Request.Context(), eventID, closeTime.Format(database.DatetimeFormat)); err != nil {
+		sendTransitionError(c, "reopen event", err)
+		return
+	}
+
+	// Seats freed since closing go to the waitlist before anyone new registers
+	promoted, err := database.PromoteFromWaitlist(c.Request.Context(), eventID, false)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to promote waitlisted participants", "event_id", eventID, "error", err)
+	}
+	for _, participant := range promoted {
+		logger.InfoContext(c.Request.Context(), "Promoted participant from waitlist", "participant_id", participant.ParticipantID, "event_id", eventID)
+	}
+
+	logger.InfoContext(c.Request.Context(), "Reopened event", "event_id", eventID, "close_date", reopenData.CloseDatetime)
+	sendResponse(c, true, "Event reopened", http.StatusOK)
+}
+
+// handleCompleteEvent marks a closed event as having taken place without waiting for the scheduler
+func handleCompleteEvent(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	if _, err := database.TransitionEvent(c.Request.Context(), eventID, database.EventStatusCompleted); err != nil {
+		sendTransitionError(c, "complete event", err)
+		return
+	}
+
+	sendResponse(c, true, "Event completed", http.StatusOK)
+}
@@ -0,0 +1,65 @@
+package run
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/gin-gonic/gin"
+)
+
+// How often an idle stream sends a comment, so proxies and phones don't drop the connection
+const streamKeepAlive = 30 * time.Second
+
+// handleSeatStream sends an event's seats as Server-Sent Events, starting with the current state
+// and then whenever someone registers, is removed or the event changes
+func handleSeatStream(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	event, ok := publicEventByID(c, eventID)
+	if !ok {
+		return
+	}
+
+	updates, unsubscribe, err := live.Subscribe(eventID)
+	if errors.Is(err, live.ErrTooManySubscribers) {
+		logger.WarnContext(c.Request.Context(), "Refused live updates", "event_id", eventID, "error", err)
+		sendResponse(c, false, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		sendResponse(c, false, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Cache-Control", "no-cache")
+	// Stops nginx buffering the stream if the Pi is ever put behind it
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("seats", live.Snapshot(*event, live.ChangeCurrent))
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return false
+			}
+			c.SSEvent("seats", update)
+			return update.Change != live.ChangeDeleted
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
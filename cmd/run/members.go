@@ -0,0 +1,95 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/roster"
+	"github.com/gin-gonic/gin"
+)
+
+// Largest roster upload accepted, well above the size of the full students' union export
+const maxRosterSize = 5 << 20
+
+func handleImportMembers(c *gin.Context) {
+	body, _, err := readUpload(c, maxRosterSize)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to read roster upload: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	members, err := roster.Parse(body)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to parse roster: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := database.ReplaceMembers(c.Request.Context(), members); err != nil {
+		msg := fmt.Sprintf("Failed to import members: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Imported membership roster", "members", len(members))
+	sendResponse(c, true, fmt.Sprintf("Imported %d members", len(members)), http.StatusOK)
+}
+
+func handleGetMembers(c *gin.Context) {
+	members, err := database.GetMembers(c.Request.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get members: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// verifyMembership checks someone registering against the membership roster, filling in their
+// membership and student ID from it and returning a note for admins when that doesn't match what
+// they declared. Until a roster has been imported the declared membership is trusted.
+func verifyMembership(ctx context.Context, registrant *database.Registrant) (string, error) {
+	count, err := database.CountMembers(ctx)
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return "", nil
+	}
+
+	declared := registrant.Member
+	registrant.Member = false
+
+	member, err := database.FindMember(ctx, registrant.FirstName, registrant.LastName, registrant.Email)
+	if errors.Is(err, database.ErrMemberNotFound) {
+		if declared {
+			return "declared member but not on the roster", nil
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	registrant.StudentID = member.StudentID
+
+	if !member.Active(time.Now()) {
+		if declared {
+			return fmt.Sprintf("declared member but membership expired %s", member.ExpiresAt), nil
+		}
+		return "", nil
+	}
+
+	registrant.Member = true
+	return "", nil
+}
@@ -0,0 +1,35 @@
+package run
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/names"
+)
+
+// registrationNames validates and tidies the names someone registered with, returning their
+// given, family and preferred names. Older copies of the register page send a single name
+// instead, which is split at its first space.
+func registrationNames(registrationData RegistrationData) (string, string, string, error) {
+	givenName := names.Normalise(registrationData.GivenName)
+	familyName := names.Normalise(registrationData.FamilyName)
+	if givenName == "" && familyName == "" {
+		givenName, familyName, _ = strings.Cut(names.Normalise(registrationData.Name), " ")
+	}
+
+	if err := names.Validate(givenName); err != nil {
+		return "", "", "", fmt.Errorf("given name: %v", err)
+	}
+	if err := names.Validate(familyName); err != nil {
+		return "", "", "", fmt.Errorf("family name: %v", err)
+	}
+
+	preferredName := names.Normalise(registrationData.PreferredName)
+	if preferredName != "" {
+		if err := names.Validate(preferredName); err != nil {
+			return "", "", "", fmt.Errorf("preferred name: %v", err)
+		}
+	}
+
+	return names.Capitalise(givenName), names.Capitalise(familyName), names.Capitalise(preferredName), nil
+}
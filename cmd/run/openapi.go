@@ -0,0 +1,705 @@
+package run
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/allocation"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/eventimport"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// Routes serving pages and files rather than the API, which are left out of the API document
+var pageRoutes = map[string]bool{
+	"/":                    true,
+	"/events":              true,
+	"/cancel":              true,
+	"/admin":               true,
+	"/admin/dashboard":     true,
+	"/admin/checkin":       true,
+	"/resources/*filepath": true,
+	"/register/*filepath":  true,
+}
+
+// apiRoute is an /api/v1 route in the API document, along with the route it replaced
+type apiRoute struct {
+	method  string
+	path    string
+	summary string
+	tag     string
+	admin   bool
+	query   []openapi.Parameter
+	body    *openapi.RequestBody
+	status  int
+	reply   *openapi.Response
+	errors  []int
+	// Replies for other statuses that aren't sent as errors
+	others map[int]*openapi.Response
+
+	// The route before /api/v1. It takes the last ID in the path from the query string, or from
+	// legacyBody when that is given.
+	legacyMethod string
+	legacyPath   string
+	legacyBody   *openapi.RequestBody
+}
+
+var apiDocument = newAPIDocument()
+
+func handleAPIDocument(c *gin.Context) {
+	c.JSON(http.StatusOK, apiDocument)
+}
+
+// undocumentedRoutes lists the routes on the router missing from the API document, so a new
+// route can't be added without describing it
+func undocumentedRoutes(routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, route := range routes {
+		if pageRoutes[route.Path] || route.Method == http.MethodHead {
+			continue
+		}
+		if apiDocument.Operation(route.Method, openapi.Path(route.Path)) == nil {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func newAPIDocument() *openapi.Document {
+	doc := openapi.New(openapi.Info{
+		Title:   "Climbing Society Seats",
+		Version: "1",
+		Description: "Registration and seat allocation for climbing society sessions. Failed requests to /api/v1 " +
+			"are answered with an APIError, whose code says what went wrong. The routes before /api/v1 are " +
+			"deprecated and answer failures with an APIMessage.",
+	})
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"admin": {
+			Type:        "apiKey",
+			In:          "cookie",
+			Name:        "token",
+			Description: "Set by logging in, admin routes answer 404 without it",
+		},
+	}
+
+	doc.Schema(APIError{})
+	doc.Components.Schemas["APIErrorDetail"].Properties["code"].Enum = []string{
+		codeInvalidRequest, codeInvalidID, codeForbidden, codeNotFound, codeConflict, codeUnavailable,
+		codeInternal, codeRegistrationClosed, codeAlreadyRegistered, codeInvalidTransition,
+		codeApprovalRequired, codeSelfApproval,
+	}
+
+	for _, route := range apiRoutes(doc) {
+		addAPIRoute(doc, route)
+	}
+	addUnversionedRoutes(doc)
+	return doc
+}
+
+func pathParam(name string, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "path", Description: description, Required: true, Schema: &openapi.Schema{Type: "integer"}}
+}
+
+func queryParam(name string, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: openapi.JSON(schema)}
+}
+
+// uploadBody is a file sent to an import route, as a form upload named file or the raw body
+func uploadBody(types ...string) *openapi.RequestBody {
+	file := &openapi.Schema{Type: "string", Format: "binary"}
+	content := map[string]openapi.MediaType{
+		"multipart/form-data": {Schema: &openapi.Schema{
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"file": file},
+			Required:   []string{"file"},
+		}},
+	}
+	for _, contentType := range types {
+		content[contentType] = openapi.MediaType{Schema: file}
+	}
+	return &openapi.RequestBody{Required: true, Content: content}
+}
+
+func jsonReply(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: openapi.JSON(schema)}
+}
+
+// exportReply is a CSV or XLSX download, picked with the format query param
+func exportReply(description string) *openapi.Response {
+	file := &openapi.Schema{Type: "string", Format: "binary"}
+	return &openapi.Response{
+		Description: description,
+		Content: map[string]openapi.MediaType{
+			"text/csv": {Schema: file},
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": {Schema: file},
+		},
+	}
+}
+
+func calendarReply(description string) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]openapi.MediaType{"text/calendar": {Schema: &openapi.Schema{Type: "string"}}},
+	}
+}
+
+func apiRoutes(doc *openapi.Document) []apiRoute {
+	message := doc.Schema(APIMessage{})
+	events := doc.Schema([]database.Event{})
+	eventInput := jsonBody(doc.Input(database.Event{}))
+	exportFormat := queryParam("format", "Format of the download, csv by default", &openapi.Schema{Type: "string", Enum: []string{"csv", "xlsx"}})
+	dateParam := func(name string, description string) openapi.Parameter {
+		return queryParam(name, description, &openapi.Schema{Type: "string", Format: "date"})
+	}
+
+	registrationBody := jsonBody(doc.Input(RegistrationData{}))
+	offerBody := jsonBody(doc.Input(DriverOfferData{}))
+	vehicleBody := jsonBody(doc.Input(database.Vehicle{}))
+
+	return []apiRoute{
+		{
+			method: http.MethodPost, path: "/api/v1/login", tag: "Admin",
+			summary: "Log in as an admin, setting the token cookie the admin routes need",
+			body:    jsonBody(doc.Input(LoginData{})),
+			status:  http.StatusAccepted, reply: jsonReply("Logged in", message),
+			errors:       []int{http.StatusBadRequest, http.StatusForbidden},
+			legacyMethod: http.MethodPost, legacyPath: "/api/login",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/events/upcoming", tag: "Events",
+			summary: "List the events taking registrations or yet to open, soonest first",
+			status:  http.StatusOK, reply: jsonReply("Upcoming events", doc.Schema([]upcomingEvent{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/events/upcoming",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}", tag: "Events",
+			summary: "Get an event, drafts are only visible to admins through the events list",
+			status:  http.StatusOK, reply: jsonReply("The event", doc.Schema(publicEvent{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/event",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}/stream", tag: "Events",
+			summary: "Follow an event's seats as Server-Sent Events",
+			status:  http.StatusOK,
+			reply: &openapi.Response{
+				Description: "A seats event with the current " + componentLink(doc, live.SeatUpdate{}) + ", then another whenever the seats change",
+				Content:     map[string]openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}},
+			},
+			errors:       []int{http.StatusServiceUnavailable},
+			legacyMethod: http.MethodGet, legacyPath: "/api/events/stream",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/registrations", tag: "Registration",
+			summary: "Register for an event, getting a seat, a place on the waitlist or a ballot entry",
+			body:    registrationBody,
+			status:  http.StatusOK, reply: jsonReply("Registered, with a confirmation emailed", message),
+			errors:       []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/register", legacyBody: registrationBody,
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/driver-offers", tag: "Registration",
+			summary: "Offer to drive to an event, which the committee approves",
+			body:    offerBody,
+			status:  http.StatusOK, reply: jsonReply("Offer received", message),
+			errors:       []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/drivers", legacyBody: offerBody,
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/registrations/{token}", tag: "Registration",
+			summary: "Get the registration a manage link was sent for",
+			status:  http.StatusOK, reply: jsonReply("The registration", doc.Schema(ManagedRegistration{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/registration",
+		},
+		{
+			method: http.MethodDelete, path: "/api/v1/registrations/{token}", tag: "Registration",
+			summary: "Cancel a registration from its manage link, giving the seat to the waitlist",
+			status:  http.StatusOK, reply: jsonReply("Cancelled", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/registration/cancel",
+			legacyBody: jsonBody(doc.Input(registrationTokenData{})),
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/registrations/{token}/reminders", tag: "Registration",
+			summary: "Turn reminder emails on or off from a manage link",
+			body: jsonBody(doc.Input(struct {
+				Enabled bool `json:"enabled"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Preference saved", message),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPut, legacyPath: "/api/registration/reminders",
+			legacyBody: jsonBody(doc.Input(struct {
+				Token   string `json:"token"`
+				Enabled bool   `json:"enabled"`
+			}{})),
+		},
+
+		{
+			method: http.MethodGet, path: "/api/v1/events", tag: "Events", admin: true,
+			summary: "List events, filtered and a page at a time",
+			query: []openapi.Parameter{
+				queryParam("status", "Comma separated statuses to include", &openapi.Schema{Type: "string"}),
+				queryParam("location", "Only events at a location containing this", &openapi.Schema{Type: "string"}),
+				dateParam("from", "Only sessions on or after this date"),
+				dateParam("to", "Only sessions on or before this date"),
+				queryParam("order", "Sort order, id by default", &openapi.Schema{Type: "string", Enum: []string{
+					string(database.OrderByID), string(database.OrderByIDDesc), string(database.OrderByStart), string(database.OrderByStartDesc),
+				}}),
+				queryParam("cursor", "The X-Next-Cursor of the previous page", &openapi.Schema{Type: "string"}),
+				queryParam("limit", fmt.Sprintf("Events in a page, %d by default and at most %d", defaultEventPageSize, maxEventPageSize), &openapi.Schema{Type: "integer"}),
+			},
+			status: http.StatusOK,
+			reply: &openapi.Response{
+				Description: "A page of events",
+				Headers: map[string]openapi.Header{
+					"X-Next-Cursor": {Description: "Cursor for the next page, left out on the last page", Schema: &openapi.Schema{Type: "string"}},
+				},
+				Content: openapi.JSON(events),
+			},
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodGet, legacyPath: "/api/events",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events", tag: "Events", admin: true,
+			summary: "Create a draft event, which another admin has to approve",
+			body:    eventInput,
+			status:  http.StatusCreated,
+			reply: &openapi.Response{
+				Description: "Created",
+				Headers: map[string]openapi.Header{
+					"Location": {Description: "The new event", Schema: &openapi.Schema{Type: "string"}},
+				},
+				Content: openapi.JSON(doc.Schema(struct {
+					Success bool   `json:"success"`
+					Message string `json:"message"`
+					EventID int    `json:"event_id"`
+				}{})),
+			},
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPost, legacyPath: "/api/events",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/import", tag: "Events", admin: true,
+			summary: "Create draft events from a CSV or YAML schedule, only if every event is valid",
+			query: []openapi.Parameter{
+				queryParam("dry_run", "Check the schedule without creating anything", &openapi.Schema{Type: "boolean"}),
+				queryParam("format", "Format of the schedule, worked out from the upload when left out", &openapi.Schema{
+					Type: "string", Enum: []string{string(eventimport.FormatCSV), string(eventimport.FormatYAML)},
+				}),
+			},
+			body:   uploadBody("text/csv", "application/yaml"),
+			status: http.StatusOK, reply: jsonReply("The schedule is valid", doc.Schema(eventimport.Report{})),
+			others: map[int]*openapi.Response{
+				http.StatusUnprocessableEntity: jsonReply("Some events aren't valid, nothing was created", doc.Schema(eventimport.Report{})),
+			},
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPost, legacyPath: "/api/events/import",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/events/pending", tag: "Events", admin: true,
+			summary: "List the drafts waiting for approval",
+			status:  http.StatusOK, reply: jsonReply("Draft events", events),
+			legacyMethod: http.MethodGet, legacyPath: "/api/events/pending",
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/events/{event}", tag: "Events", admin: true,
+			summary: "Update an event",
+			body:    eventInput,
+			status:  http.StatusOK, reply: jsonReply("Updated", message),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPut, legacyPath: "/api/events",
+		},
+		{
+			method: http.MethodDelete, path: "/api/v1/events/{event}", tag: "Events", admin: true,
+			summary: "Delete an event and its registrations",
+			status:  http.StatusOK, reply: jsonReply("Deleted", message),
+			legacyMethod: http.MethodDelete, legacyPath: "/api/event",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/cancel", tag: "Lifecycle", admin: true,
+			summary: "Cancel an event and email everyone registered",
+			body: jsonBody(doc.Input(struct {
+				Reason string `json:"reason"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Cancelled", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/event/cancel",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/approve", tag: "Lifecycle", admin: true,
+			summary: "Approve another admin's draft event",
+			status:  http.StatusOK, reply: jsonReply("Approved", message),
+			errors:       []int{http.StatusForbidden, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/event/approve",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/reopen", tag: "Lifecycle", admin: true,
+			summary: "Reopen a closed event's signups until a new close date",
+			body: jsonBody(doc.Input(struct {
+				CloseDatetime string `json:"close_date"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Reopened", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/event/reopen",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/complete", tag: "Lifecycle", admin: true,
+			summary: "Mark an event's session as having taken place",
+			status:  http.StatusOK, reply: jsonReply("Completed", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/event/complete",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}/export", tag: "Export", admin: true,
+			summary: "Download an event's participants",
+			query:   []openapi.Parameter{exportFormat},
+			status:  http.StatusOK, reply: exportReply("The participants"),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodGet, legacyPath: "/api/export/participants",
+		},
+
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}/participants", tag: "Participants", admin: true,
+			summary: "List an event's participants, seated first and then the waitlist in order",
+			status:  http.StatusOK, reply: jsonReply("The participants", doc.Schema([]database.Participant{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/participants",
+		},
+		{
+			method: http.MethodDelete, path: "/api/v1/events/{event}/participants/{participant}", tag: "Participants", admin: true,
+			summary: "Remove a participant, giving their seat to the waitlist",
+			status:  http.StatusOK, reply: jsonReply("Removed", message),
+			legacyMethod: http.MethodDelete, legacyPath: "/api/participant",
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/events/{event}/participants/{participant}/attendance", tag: "Participants", admin: true,
+			summary: "Record whether a participant turned up",
+			body: jsonBody(doc.Input(struct {
+				Attendance database.AttendanceStatus `json:"attendance"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Recorded", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPut, legacyPath: "/api/participant/attendance",
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/events/{event}/participants/{participant}/vehicle", tag: "Vehicles", admin: true,
+			summary: "Put a participant in a vehicle, or take them out with vehicle 0",
+			body: jsonBody(doc.Input(struct {
+				VehicleID int `json:"vehicle_id"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Assigned", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPut, legacyPath: "/api/participant/vehicle",
+		},
+
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}/vehicles", tag: "Vehicles", admin: true,
+			summary: "List an event's vehicles",
+			status:  http.StatusOK, reply: jsonReply("The vehicles", doc.Schema([]database.Vehicle{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/vehicles",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/vehicles", tag: "Vehicles", admin: true,
+			summary: "Add a vehicle, whose seats go to the waitlist",
+			body:    vehicleBody,
+			status:  http.StatusOK, reply: jsonReply("Added", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/vehicles",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/vehicles/assign", tag: "Vehicles", admin: true,
+			summary: "Fill the vehicles with everyone seated but not yet in one",
+			status:  http.StatusOK, reply: jsonReply("Assigned", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/vehicles/assign",
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/events/{event}/vehicles/{vehicle}", tag: "Vehicles", admin: true,
+			summary: "Update a vehicle",
+			body:    vehicleBody,
+			status:  http.StatusOK, reply: jsonReply("Updated", message),
+			errors:       []int{http.StatusBadRequest, http.StatusConflict},
+			legacyMethod: http.MethodPut, legacyPath: "/api/vehicles",
+		},
+		{
+			method: http.MethodDelete, path: "/api/v1/events/{event}/vehicles/{vehicle}", tag: "Vehicles", admin: true,
+			summary: "Remove a vehicle",
+			status:  http.StatusOK, reply: jsonReply("Removed", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodDelete, legacyPath: "/api/vehicle",
+		},
+
+		{
+			method: http.MethodGet, path: "/api/v1/events/{event}/driver-offers", tag: "Drivers", admin: true,
+			summary: "List the offers to drive to an event",
+			status:  http.StatusOK, reply: jsonReply("The offers", doc.Schema([]database.DriverOffer{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/drivers",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/driver-offers/{offer}/approve", tag: "Drivers", admin: true,
+			summary: "Approve an offer, adding its vehicle to the event",
+			status:  http.StatusOK, reply: jsonReply("Approved", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/drivers/approve",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/events/{event}/driver-offers/{offer}/decline", tag: "Drivers", admin: true,
+			summary: "Decline an offer",
+			status:  http.StatusOK, reply: jsonReply("Declined", message),
+			errors:       []int{http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/drivers/decline",
+		},
+
+		{
+			method: http.MethodGet, path: "/api/v1/attendance", tag: "People", admin: true,
+			summary: "Get a person's attendance history and how the allocation policy treats them",
+			query: []openapi.Parameter{
+				queryParam("person", "The person, or give their name instead", &openapi.Schema{Type: "integer"}),
+				queryParam("first_name", "Given name of someone without their person ID", &openapi.Schema{Type: "string"}),
+				queryParam("last_name", "Family name of someone without their person ID", &openapi.Schema{Type: "string"}),
+			},
+			status: http.StatusOK,
+			reply: jsonReply("Their history", doc.Schema(struct {
+				History    *database.AttendanceHistory `json:"history"`
+				Allocation allocation.Decision         `json:"allocation"`
+			}{})),
+			errors:       []int{http.StatusBadRequest, http.StatusNotFound},
+			legacyMethod: http.MethodGet, legacyPath: "/api/attendance",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/members", tag: "People", admin: true,
+			summary: "List the membership roster",
+			status:  http.StatusOK, reply: jsonReply("The members", doc.Schema([]database.Member{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/members",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/members", tag: "People", admin: true,
+			summary: "Replace the membership roster with a students' union CSV export",
+			body:    uploadBody("text/csv"),
+			status:  http.StatusOK, reply: jsonReply("Imported", message),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPost, legacyPath: "/api/members",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/people", tag: "People", admin: true,
+			summary: "List everyone who has registered, with a summary of their attendance",
+			status:  http.StatusOK, reply: jsonReply("The people", doc.Schema([]database.PersonSummary{})),
+			legacyMethod: http.MethodGet, legacyPath: "/api/people",
+		},
+		{
+			method: http.MethodPost, path: "/api/v1/people/merge", tag: "People", admin: true,
+			summary: "Merge two records of the same person",
+			body: jsonBody(doc.Input(struct {
+				From int `json:"from"`
+				Into int `json:"into"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Merged", message),
+			errors:       []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+			legacyMethod: http.MethodPost, legacyPath: "/api/people/merge",
+		},
+		{
+			method: http.MethodPut, path: "/api/v1/people/{person}/driver", tag: "Drivers", admin: true,
+			summary: "Set whether a person can offer to drive",
+			body: jsonBody(doc.Input(struct {
+				Qualified bool `json:"qualified"`
+			}{})),
+			status: http.StatusOK, reply: jsonReply("Updated", message),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodPut, legacyPath: "/api/people/driver",
+		},
+		{
+			method: http.MethodGet, path: "/api/v1/export/events", tag: "Export", admin: true,
+			summary: "Download every event with a summary of its registrations",
+			query: []openapi.Parameter{
+				exportFormat,
+				dateParam("from", "Only sessions on or after this date"),
+				dateParam("to", "Only sessions on or before this date"),
+			},
+			status: http.StatusOK, reply: exportReply("The events"),
+			errors:       []int{http.StatusBadRequest},
+			legacyMethod: http.MethodGet, legacyPath: "/api/export/events",
+		},
+	}
+}
+
+// componentLink names a type's schema in a description
+func componentLink(doc *openapi.Document, v any) string {
+	ref := doc.Schema(v).Ref
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// pathParams returns the {params} in a path in order
+func pathParams(path string) []string {
+	var params []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, strings.Trim(segment, "{}"))
+		}
+	}
+	return params
+}
+
+// addAPIRoute adds an /api/v1 route and the deprecated route it replaced to the document
+func addAPIRoute(doc *openapi.Document, route apiRoute) {
+	params := pathParams(route.path)
+
+	operation := &openapi.Operation{
+		Summary:     route.summary,
+		Tags:        []string{route.tag},
+		Parameters:  append([]openapi.Parameter{}, route.query...),
+		RequestBody: route.body,
+	}
+	for _, name := range params {
+		if name == "token" {
+			operation.Parameters = append(operation.Parameters, openapi.Parameter{
+				Name: name, In: "path", Description: "Token from the registration's manage link", Required: true,
+				Schema: &openapi.Schema{Type: "string"},
+			})
+			continue
+		}
+		operation.Parameters = append(operation.Parameters, pathParam(name, "ID of the "+name))
+	}
+	doc.Add(route.method, route.path, withResponses(operation, route, params, doc.Schema(APIError{})))
+
+	if route.legacyPath == "" {
+		return
+	}
+	legacy := &openapi.Operation{
+		Summary:     route.summary,
+		Description: "Deprecated, use " + route.method + " " + route.path,
+		Tags:        operation.Tags,
+		Deprecated:  true,
+		Parameters:  append([]openapi.Parameter{}, route.query...),
+		RequestBody: route.body,
+	}
+	if route.legacyBody != nil {
+		legacy.RequestBody = route.legacyBody
+	} else if len(params) > 0 {
+		last := params[len(params)-1]
+		parameter := pathParam(last, "ID of the "+last)
+		if last == "token" {
+			parameter.Description = "Token from the registration's manage link"
+			parameter.Schema = &openapi.Schema{Type: "string"}
+		}
+		parameter.In = "query"
+		legacy.Parameters = append(legacy.Parameters, parameter)
+	}
+	doc.Add(route.legacyMethod, route.legacyPath, withResponses(legacy, route, params, doc.Schema(APIMessage{})))
+}
+
+// withResponses fills in an operation's responses, with failures sent as errorSchema
+func withResponses(operation *openapi.Operation, route apiRoute, params []string, errorSchema *openapi.Schema) *openapi.Operation {
+	operation.Responses = map[string]*openapi.Response{
+		strconv.Itoa(route.status): route.reply,
+	}
+
+	failures := map[int]string{http.StatusInternalServerError: "Something went wrong on the server"}
+	for _, status := range route.errors {
+		failures[status] = http.StatusText(status)
+	}
+	for _, name := range params {
+		if name != "token" {
+			failures[http.StatusBadRequest] = "The request or an ID in it isn't valid"
+		}
+		failures[http.StatusNotFound] = "Nothing with that ID"
+	}
+	if operation.RequestBody != nil {
+		failures[http.StatusBadRequest] = "The request or an ID in it isn't valid"
+	}
+	if route.admin {
+		operation.Security = []map[string][]string{{"admin": {}}}
+		failures[http.StatusNotFound] = "Nothing with that ID, or not logged in as an admin"
+	}
+
+	for status, description := range failures {
+		operation.Responses[strconv.Itoa(status)] = jsonReply(description, errorSchema)
+	}
+	for status, reply := range route.others {
+		operation.Responses[strconv.Itoa(status)] = reply
+	}
+	return operation
+}
+
+// addUnversionedRoutes adds the routes outside /api, which aren't versioned
+func addUnversionedRoutes(doc *openapi.Document) {
+	serverError := jsonReply("Something went wrong on the server", doc.Schema(APIMessage{}))
+
+	doc.Add(http.MethodGet, "/api/openapi.json", &openapi.Operation{
+		Summary: "This document",
+		Tags:    []string{"Meta"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The OpenAPI document", Content: openapi.JSON(&openapi.Schema{Type: "object"})},
+		},
+	})
+
+	doc.Add(http.MethodGet, "/calendar.ics", &openapi.Operation{
+		Summary: "Subscribe to every upcoming session",
+		Tags:    []string{"Calendar"},
+		Responses: map[string]*openapi.Response{
+			"200": calendarReply("The sessions"),
+			"500": serverError,
+		},
+	})
+	doc.Add(http.MethodGet, "/calendar/event.ics", &openapi.Operation{
+		Summary:    "Add a session to a calendar",
+		Tags:       []string{"Calendar"},
+		Parameters: []openapi.Parameter{{Name: "event", In: "query", Description: "ID of the event", Required: true, Schema: &openapi.Schema{Type: "integer"}}},
+		Responses: map[string]*openapi.Response{
+			"200": calendarReply("The session"),
+			"400": jsonReply("The event ID isn't valid", doc.Schema(APIMessage{})),
+			"404": jsonReply("No event with that ID", doc.Schema(APIMessage{})),
+			"500": serverError,
+		},
+	})
+	doc.Add(http.MethodGet, "/calendar/person/{token}", &openapi.Operation{
+		Summary: "Subscribe to the sessions someone has a seat on, from the link sent when they register",
+		Tags:    []string{"Calendar"},
+		Parameters: []openapi.Parameter{{
+			Name: "token", In: "path", Description: "Token from their calendar link, with or without .ics", Required: true,
+			Schema: &openapi.Schema{Type: "string"},
+		}},
+		Responses: map[string]*openapi.Response{
+			"200": calendarReply("Their sessions"),
+			"404": jsonReply("No calendar with that token", doc.Schema(APIMessage{})),
+			"500": serverError,
+		},
+	})
+
+	doc.Add(http.MethodGet, "/healthz", &openapi.Operation{
+		Summary: "Check the server is running",
+		Tags:    []string{"Meta"},
+		Responses: map[string]*openapi.Response{
+			"200": jsonReply("Running", doc.Schema(struct {
+				Status string `json:"status"`
+			}{})),
+		},
+	})
+	readiness := doc.Schema(struct {
+		Ready  bool              `json:"ready"`
+		Checks map[string]string `json:"checks"`
+	}{})
+	doc.Add(http.MethodGet, "/readyz", &openapi.Operation{
+		Summary: "Check the server can take requests",
+		Tags:    []string{"Meta"},
+		Responses: map[string]*openapi.Response{
+			"200": jsonReply("Ready", readiness),
+			"503": jsonReply("Not ready, or shutting down", readiness),
+		},
+	})
+	doc.Add(http.MethodGet, "/metrics", &openapi.Operation{
+		Summary:     "Prometheus metrics",
+		Description: "Served on the metrics address instead when one is set, and only to admins with metrics auth turned on",
+		Tags:        []string{"Meta"},
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "The metrics", Content: map[string]openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}}},
+		},
+	})
+}
@@ -0,0 +1,776 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/openapi"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/scheduler"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/token"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// An ID no event, participant or vehicle will have
+const missingID = "999999999"
+
+// apiTest sends requests through the router and checks every reply against the API document
+type apiTest struct {
+	t      *testing.T
+	ctx    context.Context
+	router *gin.Engine
+	// Token cookie of each admin, once logged in
+	tokens map[string]string
+	// The statuses each documented operation has replied with, keyed by method and path
+	replied map[string]map[int]bool
+	// Emails sent to registrants, which go out after the reply
+	emails chan sentEmail
+}
+
+type sentEmail struct {
+	address string
+	subject string
+	message string
+}
+
+type apiRequest struct {
+	method string
+	target string
+	// Admin whose token is sent, if any
+	admin string
+	// Sent as JSON, or as it is when a string with contentType
+	body        any
+	contentType string
+	// Sent as a form upload named file instead of the body when set
+	upload string
+	// Streams are read for a moment and then dropped
+	stream bool
+	status int
+}
+
+// streamRecorder lets gin stream to a recorder, which can't tell it the client has gone itself
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (streamRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// newAPITest sets up the router on a new database, with the admins alice and bob logged in
+func newAPITest(t *testing.T) *apiTest {
+	dir := t.TempDir()
+	previousDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The token key is kept in the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	previousPath := database.Path
+	database.Path = filepath.Join(dir, "database.db")
+	emails := make(chan sentEmail, 100)
+	previousSend := sendEmail
+	sendEmail = func(ctx context.Context, address string, subject string, message string) error {
+		select {
+		case emails <- sentEmail{address: address, subject: subject, message: message}:
+		default:
+			t.Errorf("too many emails sent to keep, dropped one to %s", address)
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		database.Path = previousPath
+		sendEmail = previousSend
+		os.Chdir(previousDir)
+	})
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", database.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := db.ExecContext(ctx, "INSERT INTO users (username, password_hash) VALUES (?, ?)", username, hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	encryptionPassPhrase = "0123456789abcdef"
+	if err := token.GenerateNewEncryptedToken(encryptionPassPhrase, 32); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &apiTest{
+		t:       t,
+		ctx:     ctx,
+		router:  newRouter(encryptionPassPhrase, gin.WrapH(promhttp.Handler())),
+		tokens:  map[string]string{},
+		replied: map[string]map[int]bool{},
+		emails:  emails,
+	}
+
+	// One admin logs in through /api/v1 and the other through the older route
+	for username, target := range map[string]string{"alice": "/api/v1/login", "bob": "/api/login"} {
+		reply := a.send(apiRequest{
+			method: http.MethodPost, target: target,
+			body:   map[string]string{"Username": username, "Password": "password"},
+			status: http.StatusAccepted,
+		})
+		for _, cookie := range reply.Result().Cookies() {
+			if cookie.Name == "token" {
+				a.tokens[username] = cookie.Value
+			}
+		}
+		if a.tokens[username] == "" {
+			t.Fatalf("logging in as %s didn't set a token", username)
+		}
+	}
+	return a
+}
+
+// documentedPath finds the path in the API document a request is for, preferring fixed segments
+// over parameters so /api/v1/events/upcoming isn't taken for /api/v1/events/{event}
+func documentedPath(method string, target string) string {
+	segments := strings.Split(target, "/")
+	best, bestParams := "", len(segments)+1
+	for path := range apiDocument.Paths {
+		if apiDocument.Operation(method, path) == nil {
+			continue
+		}
+		pathSegments := strings.Split(path, "/")
+		if len(pathSegments) != len(segments) {
+			continue
+		}
+		params := 0
+		for i, segment := range pathSegments {
+			if strings.HasPrefix(segment, "{") {
+				params++
+			} else if segment != segments[i] {
+				params = -1
+				break
+			}
+		}
+		if params >= 0 && params < bestParams {
+			best, bestParams = path, params
+		}
+	}
+	return best
+}
+
+// send makes a request, checks the reply against the API document and its status against the
+// one wanted, and returns the reply
+func (a *apiTest) send(request apiRequest) *httptest.ResponseRecorder {
+	a.t.Helper()
+
+	var body io.Reader = http.NoBody
+	contentType := request.contentType
+	switch {
+	case request.upload != "":
+		var form bytes.Buffer
+		writer := multipart.NewWriter(&form)
+		part, err := writer.CreateFormFile("file", "upload.csv")
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		io.WriteString(part, request.upload)
+		writer.Close()
+		body, contentType = &form, writer.FormDataContentType()
+	case contentType != "":
+		body = strings.NewReader(request.body.(string))
+	case request.body != nil:
+		encoded, err := json.Marshal(request.body)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		body, contentType = bytes.NewReader(encoded), "application/json"
+	}
+
+	ctx := a.ctx
+	if request.stream {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+	}
+	httpRequest := httptest.NewRequest(request.method, request.target, body).WithContext(ctx)
+	if contentType != "" {
+		httpRequest.Header.Set("Content-Type", contentType)
+	}
+	if request.admin != "" {
+		httpRequest.AddCookie(&http.Cookie{Name: "token", Value: a.tokens[request.admin]})
+	}
+
+	recorder := httptest.NewRecorder()
+	a.router.ServeHTTP(streamRecorder{recorder}, httpRequest)
+
+	path := documentedPath(request.method, httpRequest.URL.Path)
+	key := request.method + " " + path
+	if a.replied[key] == nil {
+		a.replied[key] = map[int]bool{}
+	}
+	a.replied[key][recorder.Code] = true
+
+	if problem := replyProblem(request.method, path, recorder); problem != nil {
+		a.t.Errorf("%s %s (%d) doesn't match the API document:\n%v\n%s", request.method, request.target, recorder.Code, problem, recorder.Body)
+	}
+	if request.status != 0 && recorder.Code != request.status {
+		a.t.Fatalf("%s %s: status %d, want %d: %s", request.method, request.target, recorder.Code, request.status, recorder.Body)
+	}
+	return recorder
+}
+
+// emailTo waits for the next email sent to an address, passing over any sent to others
+func (a *apiTest) emailTo(address string) sentEmail {
+	a.t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case email := <-a.emails:
+			if email.address == address {
+				return email
+			}
+		case <-timeout:
+			a.t.Fatalf("no email sent to %s", address)
+		}
+	}
+}
+
+func (a *apiTest) get(admin string, target string, status int) *httptest.ResponseRecorder {
+	a.t.Helper()
+	return a.send(apiRequest{method: http.MethodGet, target: target, admin: admin, status: status})
+}
+
+// replyProblem returns how a reply differs from the API document, or nil if it doesn't
+func replyProblem(method string, path string, recorder *httptest.ResponseRecorder) error {
+	operation := apiDocument.Operation(method, path)
+	if operation == nil {
+		return fmt.Errorf("%s isn't in the API document", method)
+	}
+	documented, ok := operation.Responses[strconv.Itoa(recorder.Code)]
+	if !ok {
+		return fmt.Errorf("status %d isn't documented", recorder.Code)
+	}
+	if len(documented.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(recorder.Header().Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("unreadable content type %q", recorder.Header().Get("Content-Type"))
+	}
+	content, ok := documented.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %s isn't documented for status %d", mediaType, recorder.Code)
+	}
+	// Streams and downloads are only checked for their content type
+	if mediaType != "application/json" || content.Schema == nil {
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		return fmt.Errorf("unreadable JSON: %v", err)
+	}
+	return apiDocument.Validate(content.Schema, value)
+}
+
+func decodeReply[T any](t *testing.T, recorder *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(recorder.Body.Bytes(), &value); err != nil {
+		t.Fatalf("unreadable reply %q: %v", recorder.Body, err)
+	}
+	return value
+}
+
+// successStatus is the status an operation answers with when it works
+func successStatus(operation *openapi.Operation) int {
+	best := 0
+	for code := range operation.Responses {
+		status, _ := strconv.Atoi(code)
+		if status >= 200 && status < 300 && (best == 0 || status < best) {
+			best = status
+		}
+	}
+	return best
+}
+
+func sortedOperations() []string {
+	var keys []string
+	for path, item := range apiDocument.Paths {
+		for method := range item {
+			keys = append(keys, strings.ToUpper(method)+" "+path)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDocumentCoversRoutes(t *testing.T) {
+	router := newRouter("0123456789abcdef", gin.WrapH(promhttp.Handler()))
+	if missing := undocumentedRoutes(router.Routes()); len(missing) > 0 {
+		t.Errorf("routes missing from the API document: %s", strings.Join(missing, ", "))
+	}
+
+	for _, key := range sortedOperations() {
+		method, path, _ := strings.Cut(key, " ")
+		found := false
+		for _, route := range router.Routes() {
+			found = found || (route.Method == method && openapi.Path(route.Path) == path)
+		}
+		if !found {
+			t.Errorf("%s is documented but has no route", key)
+		}
+	}
+}
+
+// TestAPIErrors sends every documented operation requests it must turn away, checking each
+// error is one the document describes
+func TestAPIErrors(t *testing.T) {
+	a := newAPITest(t)
+
+	for _, key := range sortedOperations() {
+		method, path, _ := strings.Cut(key, " ")
+		operation := apiDocument.Operation(method, path)
+
+		// target fills the operation's required parameters, with value for the IDs
+		target := func(value string) string {
+			filled := path
+			query := []string{}
+			for _, parameter := range operation.Parameters {
+				if !parameter.Required {
+					continue
+				}
+				id := value
+				if parameter.Schema != nil && parameter.Schema.Type == "string" {
+					id = "missing-token"
+				}
+				if parameter.In == "path" {
+					filled = strings.Replace(filled, "{"+parameter.Name+"}", id, 1)
+				} else {
+					query = append(query, parameter.Name+"="+id)
+				}
+			}
+			if len(query) > 0 {
+				filled += "?" + strings.Join(query, "&")
+			}
+			return filled
+		}
+
+		hasID, hasToken := false, false
+		for _, parameter := range operation.Parameters {
+			if parameter.Required && parameter.Schema != nil {
+				hasID = hasID || parameter.Schema.Type == "integer"
+				hasToken = hasToken || parameter.Schema.Type == "string"
+			}
+		}
+
+		t.Run(key, func(t *testing.T) {
+			a.t = t
+			if len(operation.Security) > 0 {
+				// Admin routes are hidden from anyone not logged in
+				a.send(apiRequest{method: method, target: target("1"), status: http.StatusNotFound})
+			}
+			if hasID {
+				a.send(apiRequest{method: method, target: target("NaN"), admin: "alice", status: http.StatusBadRequest})
+
+				// A route that reads its body first may turn away the empty body before the ID
+				reply := a.send(apiRequest{method: method, target: target(missingID), admin: "alice", body: map[string]any{}})
+				if reply.Code != http.StatusNotFound && (operation.RequestBody == nil || reply.Code != http.StatusBadRequest) {
+					t.Errorf("missing ID: status %d: %s", reply.Code, reply.Body)
+				}
+			}
+			if hasToken && !hasID {
+				reply := a.send(apiRequest{method: method, target: target(missingID), body: map[string]any{"token": "missing-token"}})
+				if reply.Code != http.StatusNotFound && reply.Code != http.StatusBadRequest {
+					t.Errorf("missing token: status %d: %s", reply.Code, reply.Body)
+				}
+			}
+		})
+	}
+
+	a.t = t
+	// Failed /api/v1 requests are answered with the error envelope, the older routes with a message
+	reply := a.get("alice", "/api/v1/events/NaN/participants", http.StatusBadRequest)
+	if code, _ := errorReply(t, reply); code != codeInvalidID {
+		t.Errorf("code = %q, want %q", code, codeInvalidID)
+	}
+	reply = a.get("alice", "/api/participants?event=NaN", http.StatusBadRequest)
+	if code, message := errorReply(t, reply); code != "" || message == "" {
+		t.Errorf("older route replied with code %q and message %q", code, message)
+	}
+}
+
+// TestAPIDocument runs through the life of some events using every documented operation,
+// checking each reply against the API document
+func TestAPIDocument(t *testing.T) {
+	a := newAPITest(t)
+	now := time.Now()
+	date := now.AddDate(0, 0, 7).Format(database.DateFormat)
+	opens := now.Add(-time.Hour).Format(database.DatetimeFormat)
+	closes := now.AddDate(0, 0, 2).Format(database.DatetimeFormat)
+
+	// Meta
+	a.get("", "/api/openapi.json", http.StatusOK)
+	a.get("", "/healthz", http.StatusOK)
+	// The server is only ready while the scheduler runs, which is briefly started with nothing to do
+	a.get("", "/readyz", http.StatusServiceUnavailable)
+	if err := scheduler.InitialiseScheduler(a.ctx); err != nil {
+		t.Fatal(err)
+	}
+	a.get("", "/readyz", http.StatusOK)
+	if err := scheduler.Stop(a.ctx); err != nil {
+		t.Fatal(err)
+	}
+	a.get("", "/metrics", http.StatusOK)
+
+	// Logging in
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/login", body: map[string]string{"Username": "alice", "Password": "wrong"}, status: http.StatusForbidden})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/login", body: "{", contentType: "application/json", status: http.StatusBadRequest})
+
+	// Creating events, which start as drafts
+	newEvent := func(location string, seats int) map[string]any {
+		return map[string]any{
+			"session_location": location, "session_date": date, "meet_point": "Union", "meet_time": "18:00",
+			"total_seats": seats, "open_date": opens, "close_date": closes,
+		}
+	}
+	createEvent := func(admin string, target string, location string, seats int) string {
+		reply := a.send(apiRequest{method: http.MethodPost, target: target, admin: admin, body: newEvent(location, seats), status: http.StatusCreated})
+		eventID := decodeReply[struct {
+			EventID int `json:"event_id"`
+		}](t, reply).EventID
+		if eventID == 0 {
+			t.Fatalf("no event ID in %s", reply.Body)
+		}
+		return strconv.Itoa(eventID)
+	}
+	event := createEvent("alice", "/api/v1/events", "The Wall", 2)
+	other := createEvent("bob", "/api/events", "The Arch", 1)
+	toCancel := createEvent("alice", "/api/v1/events", "The Cave", 4)
+	toCancelLegacy := createEvent("alice", "/api/v1/events", "The Barn", 4)
+	toDelete := createEvent("alice", "/api/v1/events", "The Shed", 4)
+	toDeleteLegacy := createEvent("alice", "/api/v1/events", "The Hut", 4)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events", admin: "alice", body: newEvent("Nowhere", 0), status: http.StatusBadRequest})
+
+	a.get("alice", "/api/v1/events/pending", http.StatusOK)
+	a.get("alice", "/api/events/pending", http.StatusOK)
+	// Drafts aren't public
+	a.get("", "/api/v1/events/"+event, http.StatusNotFound)
+	a.send(apiRequest{method: http.MethodGet, target: "/api/v1/events/" + event + "/stream", stream: true, status: http.StatusNotFound})
+
+	// Approving them, which has to be done by someone else
+	reply := a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/approve", admin: "alice", status: http.StatusForbidden})
+	if code, _ := errorReply(t, reply); code != codeSelfApproval {
+		t.Errorf("code = %q, want %q", code, codeSelfApproval)
+	}
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/approve", admin: "bob", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/event/approve?event=" + other, admin: "alice", status: http.StatusOK})
+	for _, eventID := range []string{toCancel, toCancelLegacy, toDelete, toDeleteLegacy} {
+		a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + eventID + "/approve", admin: "bob", status: http.StatusOK})
+	}
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/approve", admin: "bob", status: http.StatusConflict})
+
+	// Listing events a page at a time
+	reply = a.get("alice", "/api/v1/events?order=-start&limit=2", http.StatusOK)
+	cursor := reply.Header().Get("X-Next-Cursor")
+	if cursor == "" {
+		t.Fatalf("no X-Next-Cursor on the first page of events")
+	}
+	a.get("alice", "/api/v1/events?order=-start&limit=2&cursor="+cursor, http.StatusOK)
+	a.get("alice", "/api/v1/events?status=scheduled&location=wall&from=2000-01-01&to=2100-01-01", http.StatusOK)
+	a.get("alice", "/api/v1/events?order=name", http.StatusBadRequest)
+	a.get("alice", "/api/events", http.StatusOK)
+
+	// The ballot seed would let anyone work out a draw before it's made, and which admins ran an
+	// event is only for the committee
+	public := a.get("", "/api/v1/events/"+event, http.StatusOK).Body.String()
+	for _, field := range []string{"ballot_seed", "created_by", "approved_by", "approved_at"} {
+		if strings.Contains(public, field) {
+			t.Errorf("public event details include %s: %s", field, public)
+		}
+	}
+	if admin := a.get("alice", "/api/v1/events", http.StatusOK).Body.String(); !strings.Contains(admin, `"approved_by":"bob"`) {
+		t.Errorf("admin events list doesn't say who approved them: %s", admin)
+	}
+	a.get("", "/api/event?event="+event, http.StatusOK)
+	a.get("", "/api/v1/events/upcoming", http.StatusOK)
+	a.get("", "/api/events/upcoming", http.StatusOK)
+	a.send(apiRequest{method: http.MethodGet, target: "/api/v1/events/" + event + "/stream", stream: true, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodGet, target: "/api/events/stream?event=" + event, stream: true, status: http.StatusOK})
+
+	// Registering, two get seats and the third is waitlisted
+	register := func(target string, eventID string, given string, family string) *httptest.ResponseRecorder {
+		id, _ := strconv.Atoi(eventID)
+		return a.send(apiRequest{method: http.MethodPost, target: target, body: map[string]any{
+			"event": id, "given_name": given, "family_name": family,
+			"email": strings.ToLower(given) + "@example.com",
+		}})
+	}
+	for _, reply := range []*httptest.ResponseRecorder{
+		register("/api/v1/events/"+event+"/registrations", event, "Alex", "Smith"),
+		register("/api/register", event, "Sam", "Jones"),
+		register("/api/v1/events/"+event+"/registrations", event, "Robin", "Brown"),
+		register("/api/v1/events/"+other+"/registrations", other, "Dana", "Driver"),
+		register("/api/v1/events/"+other+"/registrations", other, "Jo", "Bloggs"),
+		register("/api/v1/events/"+toCancel+"/registrations", toCancel, "Joanne", "Bloggs"),
+		register("/api/register", other, "Kim", "Lee"),
+		register("/api/register", toCancel, "Kimberley", "Lee"),
+	} {
+		if reply.Code != http.StatusOK {
+			t.Fatalf("registration failed: %d %s", reply.Code, reply.Body)
+		}
+	}
+	reply = register("/api/v1/events/"+event+"/registrations", event, "Alex", "Smith")
+	if code, _ := errorReply(t, reply); reply.Code != http.StatusConflict || code != codeAlreadyRegistered {
+		t.Errorf("registering twice: %d %q", reply.Code, code)
+	}
+
+	participants := map[string]database.Participant{}
+	for _, target := range []string{"/api/v1/events/" + event + "/participants", "/api/participants?event=" + other} {
+		for _, participant := range decodeReply[[]database.Participant](t, a.get("alice", target, http.StatusOK)) {
+			participants[participant.FirstName] = participant
+		}
+	}
+	participantID := func(name string) string {
+		return strconv.Itoa(participants[name].ParticipantID)
+	}
+	if participants["Robin"].SeatStatus != database.SeatWaitlisted {
+		t.Fatalf("Robin should be waitlisted, is %s", participants["Robin"].SeatStatus)
+	}
+
+	// Managing a registration from its link
+	manageToken := func(name string) string {
+		token, err := database.CancelToken(a.ctx, participants[name].ParticipantID)
+		if err != nil {
+			t.Fatalf("no manage token for %s: %v", name, err)
+		}
+		return token
+	}
+	alexToken, danaToken := manageToken("Alex"), manageToken("Dana")
+	a.get("", "/api/v1/registrations/"+alexToken, http.StatusOK)
+	a.get("", "/api/registration?token="+alexToken, http.StatusOK)
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/registrations/" + alexToken + "/reminders", body: map[string]bool{"enabled": false}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/registration/reminders", body: map[string]any{"token": alexToken, "enabled": true}, status: http.StatusOK})
+
+	// Calendars
+	a.get("", "/calendar.ics", http.StatusOK)
+	a.get("", "/calendar/event.ics?event="+event, http.StatusOK)
+	// The calendar link shows where someone will be, so it's emailed rather than in the reply
+	if reply := register("/api/v1/events/"+toDelete+"/registrations", toDelete, "Alex", "Smith"); strings.Contains(reply.Body.String(), "/calendar/person/") {
+		t.Errorf("registration reply %s has the calendar link", reply.Body)
+	}
+	confirmation := a.emailTo("alex@example.com").message
+	start := strings.Index(confirmation, "/calendar/person/")
+	if start < 0 {
+		t.Fatalf("no calendar link in the confirmation:\n%s", confirmation)
+	}
+	calendar := strings.Fields(confirmation[start:])[0]
+	a.get("", "/calendar/person/"+strings.TrimPrefix(calendar, "/calendar/person/"), http.StatusOK)
+
+	// Attendance, which is only taken for people with a seat
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event + "/participants/" + participantID("Alex") + "/attendance", admin: "alice", body: map[string]string{"attendance": "attended"}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/participant/attendance?participant=" + participantID("Sam"), admin: "alice", body: map[string]string{"attendance": "no_show"}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event + "/participants/" + participantID("Robin") + "/attendance", admin: "alice", body: map[string]string{"attendance": "attended"}, status: http.StatusConflict})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event + "/participants/" + participantID("Alex") + "/attendance", admin: "alice", body: map[string]string{"attendance": "asleep"}, status: http.StatusBadRequest})
+	// A participant is only found through the event they registered for
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + other + "/participants/" + participantID("Alex") + "/attendance", admin: "alice", body: map[string]string{"attendance": "attended"}, status: http.StatusNotFound})
+
+	// People and their history
+	people := map[string]database.PersonSummary{}
+	for _, person := range decodeReply[[]database.PersonSummary](t, a.get("alice", "/api/v1/people", http.StatusOK)) {
+		people[person.FirstName] = person
+	}
+	a.get("alice", "/api/people", http.StatusOK)
+	personID := func(name string) string {
+		return strconv.Itoa(people[name].PersonID)
+	}
+	a.get("alice", "/api/v1/attendance?person="+personID("Alex"), http.StatusOK)
+	a.get("alice", "/api/attendance?first_name=Sam&last_name=Jones", http.StatusOK)
+	a.get("alice", "/api/v1/attendance", http.StatusBadRequest)
+	a.get("alice", "/api/v1/attendance?first_name=Nobody&last_name=Here", http.StatusNotFound)
+
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/people/" + personID("Dana") + "/driver", admin: "alice", body: map[string]bool{"qualified": true}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/people/driver?person=" + personID("Dana"), admin: "alice", body: map[string]bool{"qualified": true}, status: http.StatusOK})
+
+	// Jo and Joanne, and Kim and Kimberley, registered for different events so can be merged
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/people/merge", admin: "alice", body: map[string]int{"from": people["Joanne"].PersonID, "into": people["Jo"].PersonID}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/people/merge", admin: "alice", body: map[string]int{"from": people["Kimberley"].PersonID, "into": people["Kim"].PersonID}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/people/merge", admin: "alice", body: map[string]int{"from": people["Joanne"].PersonID, "into": people["Jo"].PersonID}, status: http.StatusNotFound})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/people/merge", admin: "alice", body: map[string]int{"from": people["Sam"].PersonID, "into": people["Alex"].PersonID}, status: http.StatusConflict})
+
+	// Offering to drive, which only qualified drivers can do
+	offer := func(target string, eventID string, given string, family string) *httptest.ResponseRecorder {
+		id, _ := strconv.Atoi(eventID)
+		return a.send(apiRequest{method: http.MethodPost, target: target, body: map[string]any{
+			"event": id, "given_name": given, "family_name": family, "email": strings.ToLower(given) + "@example.com",
+			"vehicle_name": "Blue Van", "capacity": 3,
+		}})
+	}
+	// Dana offers through each route for two events, one offer to approve and one to decline
+	offerID := func(target string, eventID string) string {
+		if reply := offer(target, eventID, "Dana", "Driver"); reply.Code != http.StatusOK {
+			t.Fatalf("offer to drive failed: %d %s", reply.Code, reply.Body)
+		}
+		offers := decodeReply[[]database.DriverOffer](t, a.get("alice", "/api/drivers?event="+eventID, http.StatusOK))
+		if len(offers) != 1 {
+			t.Fatalf("got %d offers for event %s, want one", len(offers), eventID)
+		}
+		return strconv.Itoa(offers[0].OfferID)
+	}
+	approved := offerID("/api/v1/events/"+event+"/driver-offers", event)
+	declined := offerID("/api/v1/events/"+toCancel+"/driver-offers", toCancel)
+	legacyApproved := offerID("/api/drivers", toCancelLegacy)
+	legacyDeclined := offerID("/api/drivers", toDelete)
+	a.get("alice", "/api/v1/events/"+event+"/driver-offers", http.StatusOK)
+	if reply := offer("/api/v1/events/"+event+"/driver-offers", event, "Robin", "Brown"); reply.Code != http.StatusForbidden {
+		t.Errorf("offer from an unqualified driver: %d %s", reply.Code, reply.Body)
+	}
+
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/driver-offers/" + approved + "/approve", admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + toCancel + "/driver-offers/" + declined + "/decline", admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/drivers/approve?offer=" + legacyApproved, admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/drivers/decline?offer=" + legacyDeclined, admin: "alice", status: http.StatusOK})
+	// An offer is only answered once, and only through its own event
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/driver-offers/" + approved + "/decline", admin: "alice", status: http.StatusConflict})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/drivers/approve?offer=" + legacyDeclined, admin: "alice", status: http.StatusConflict})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + other + "/driver-offers/" + approved + "/approve", admin: "alice", status: http.StatusNotFound})
+
+	// Vehicles
+	vehicle := map[string]any{"name": "Minibus", "driver_name": "Pat", "capacity": 4}
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/vehicles", admin: "alice", body: vehicle, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/vehicles?event=" + event, admin: "alice", body: vehicle, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/vehicles", admin: "alice", body: map[string]any{"name": "Bike", "capacity": 0}, status: http.StatusBadRequest})
+	a.get("alice", "/api/vehicles?event="+event, http.StatusOK)
+	vehicles := decodeReply[[]database.Vehicle](t, a.get("alice", "/api/v1/events/"+event+"/vehicles", http.StatusOK))
+	if len(vehicles) != 3 {
+		t.Fatalf("got %d vehicles, want the approved driver's and two more", len(vehicles))
+	}
+	vehicleID := func(i int) string {
+		return strconv.Itoa(vehicles[i].VehicleID)
+	}
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event + "/vehicles/" + vehicleID(1), admin: "alice", body: map[string]any{"name": "Minibus", "driver_name": "Pat", "capacity": 5}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/vehicles?vehicle=" + vehicleID(2), admin: "alice", body: map[string]any{"name": "Car", "driver_name": "Lee", "capacity": 2}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/vehicles/assign", admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/vehicles/assign?event=" + event, admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event + "/participants/" + participantID("Alex") + "/vehicle", admin: "alice", body: map[string]int{"vehicle_id": vehicles[1].VehicleID}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/participant/vehicle?participant=" + participantID("Alex"), admin: "alice", body: map[string]int{"vehicle_id": 0}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/participant/vehicle?participant=" + participantID("Sam"), admin: "alice", body: map[string]int{"vehicle_id": 0}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + event + "/vehicles/" + vehicleID(1), admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/vehicle?vehicle=" + vehicleID(2), admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + event + "/vehicles/" + vehicleID(2), admin: "alice", status: http.StatusNotFound})
+
+	// Exports
+	a.get("alice", "/api/v1/events/"+event+"/export", http.StatusOK)
+	a.get("alice", "/api/v1/events/"+event+"/export?format=xlsx", http.StatusOK)
+	a.get("alice", "/api/export/participants?event="+event, http.StatusOK)
+	a.get("alice", "/api/v1/events/"+event+"/export?format=pdf", http.StatusBadRequest)
+	a.get("alice", "/api/v1/export/events?format=xlsx&from=2000-01-01", http.StatusOK)
+	a.get("alice", "/api/export/events", http.StatusOK)
+	a.get("alice", "/api/v1/export/events?from=yesterday", http.StatusBadRequest)
+
+	// The membership roster, uploaded as a form or the raw file
+	roster := "First Name,Last Name,Expiry\nAlex,Smith,2099-12-31\nSam,Jones,2000-01-01\n"
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/members", admin: "alice", upload: roster, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/members", admin: "alice", body: roster, contentType: "text/csv", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/members", admin: "alice", body: "Nobody\n", contentType: "text/csv", status: http.StatusBadRequest})
+	a.get("alice", "/api/v1/members", http.StatusOK)
+	a.get("alice", "/api/members", http.StatusOK)
+
+	// Importing a schedule, which is only created if every event in it is valid
+	schedule := "session_location,session_date,meet_point,meet_time,total_seats,open_date,close_date\n" +
+		fmt.Sprintf("The Tower,%s,Union,18:00,6,%s,%s\n", date, opens, closes)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/import?dry_run=true&format=csv", admin: "alice", body: schedule, contentType: "text/csv", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/events/import", admin: "alice", upload: schedule, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/import?format=csv", admin: "alice", body: strings.Replace(schedule, ",6,", ",0,", 1), contentType: "text/csv", status: http.StatusUnprocessableEntity})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/import?format=csv", admin: "alice", body: "nothing useful\n", contentType: "text/csv", status: http.StatusBadRequest})
+
+	// Updating an event, sending back what was fetched with changes
+	details := decodeReply[map[string]any](t, a.get("", "/api/v1/events/"+event, http.StatusOK))
+	details["total_seats"] = 4
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event, admin: "alice", body: details, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPut, target: "/api/events?event=" + event, admin: "alice", body: details, status: http.StatusOK})
+	details["total_seats"] = 0
+	a.send(apiRequest{method: http.MethodPut, target: "/api/v1/events/" + event, admin: "alice", body: details, status: http.StatusBadRequest})
+
+	// Removing participants and cancelling registrations
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + event + "/participants/" + participantID("Robin"), admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/participant?participant=" + participantID("Sam"), admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + other + "/participants/" + participantID("Alex"), admin: "alice", status: http.StatusNotFound})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/registrations/" + alexToken, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/registration/cancel", body: map[string]string{"token": danaToken}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/registrations/" + alexToken, status: http.StatusNotFound})
+
+	// Closing, reopening and completing events. Closing is left to the scheduler, so it's done
+	// directly here.
+	closeEvent := func(eventID string) {
+		id, _ := strconv.Atoi(eventID)
+		if _, err := database.TransitionEvent(a.ctx, id, database.EventStatusClosed); err != nil {
+			t.Fatalf("failed to close event %s: %v", eventID, err)
+		}
+	}
+	reopen := map[string]string{"close_date": now.AddDate(0, 0, 1).Format(database.DatetimeFormat)}
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/complete", admin: "alice", status: http.StatusConflict})
+	closeEvent(event)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/reopen", admin: "alice", body: map[string]string{"close_date": opens}, status: http.StatusBadRequest})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/reopen", admin: "alice", body: reopen, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/reopen", admin: "alice", body: reopen, status: http.StatusConflict})
+	closeEvent(event)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/event/reopen?event=" + event, admin: "alice", body: reopen, status: http.StatusOK})
+	closeEvent(event)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + event + "/complete", admin: "alice", status: http.StatusOK})
+	closeEvent(other)
+	a.send(apiRequest{method: http.MethodPost, target: "/api/event/complete?event=" + other, admin: "alice", status: http.StatusOK})
+
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + toCancel + "/cancel", admin: "alice", body: map[string]string{"reason": "Wall closed"}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/event/cancel?event=" + toCancelLegacy, admin: "alice", body: map[string]string{"reason": "Snow"}, status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodPost, target: "/api/v1/events/" + toCancel + "/cancel", admin: "alice", body: map[string]string{"reason": "Again"}, status: http.StatusConflict})
+	reply = register("/api/v1/events/"+toCancel+"/registrations", toCancel, "Late", "Comer")
+	if code, _ := errorReply(t, reply); reply.Code != http.StatusConflict || code != codeRegistrationClosed {
+		t.Errorf("registering for a cancelled event: %d %q", reply.Code, code)
+	}
+
+	// Deleting events
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + toDelete, admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/event?event=" + toDeleteLegacy, admin: "alice", status: http.StatusOK})
+	a.send(apiRequest{method: http.MethodDelete, target: "/api/v1/events/" + toDelete, admin: "alice", status: http.StatusNotFound})
+
+	if t.Failed() {
+		return
+	}
+	// Every operation in the document must have been seen working
+	for _, key := range sortedOperations() {
+		method, path, _ := strings.Cut(key, " ")
+		if status := successStatus(apiDocument.Operation(method, path)); !a.replied[key][status] {
+			t.Errorf("%s wasn't sent a request that succeeded with %d", key, status)
+		}
+	}
+}
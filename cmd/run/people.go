@@ -0,0 +1,60 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func handleGetPeople(c *gin.Context) {
+	people, err := database.GetPeople(c.Request.Context())
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get people: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, people)
+}
+
+func handleMergePeople(c *gin.Context) {
+	var mergeData struct {
+		From int `json:"from"`
+		Into int `json:"into"`
+	}
+	if err := c.ShouldBindJSON(&mergeData); err != nil {
+		msg := fmt.Sprintf("Invalid merge: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	if mergeData.From == mergeData.Into {
+		sendResponse(c, false, "Cannot merge a person into themselves", http.StatusBadRequest)
+		return
+	}
+
+	err := database.MergePeople(c.Request.Context(), mergeData.From, mergeData.Into)
+	if errors.Is(err, database.ErrPersonNotFound) {
+		sendResponse(c, false, "Failed to find person", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, database.ErrMergeConflict) {
+		msg := "Both people are registered for the same event, delete one of the registrations first"
+		sendResponse(c, false, msg, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to merge people: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Merged people", "from", mergeData.From, "into", mergeData.Into)
+	sendResponse(c, true, "People merged", http.StatusOK)
+}
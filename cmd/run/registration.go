@@ -0,0 +1,185 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/gin-gonic/gin"
+)
+
+// ManagedRegistration is what someone following the link in their reminder email sees about
+// their registration. The link's token is the only thing identifying them, so it is kept out of
+// the logs.
+type ManagedRegistration struct {
+	Name          string               `json:"name"`
+	EventLocation string               `json:"session_location"`
+	EventDate     string               `json:"session_date"`
+	MeetLocation  string               `json:"meet_point"`
+	MeetTime      string               `json:"meet_time"`
+	SeatStatus    database.SeatStatus  `json:"seat_status"`
+	EventStatus   database.EventStatus `json:"status"`
+	Reminders     bool                 `json:"reminders"`
+	// Cancellable is false for drivers, who need to tell the committee so passengers can be moved
+	Cancellable bool `json:"cancellable"`
+}
+
+type registrationTokenData struct {
+	Token string `json:"token"`
+}
+
+// registrationToken reads the manage link's token from the path of /api/v1 routes, or the query
+// string of the older ones
+func registrationToken(c *gin.Context) string {
+	if token := c.Param("token"); token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// registrationByToken looks up the registration a manage link was made for, replying with a 404
+// if there isn't one
+func registrationByToken(c *gin.Context, token string) (*database.Participant, *database.Event, bool) {
+	participant, err := database.GetParticipantByCancelToken(c.Request.Context(), token)
+	if errors.Is(err, database.ErrRegistrationNotFound) {
+		sendResponse(c, false, "Registration not found, it may have already been cancelled", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get registration: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	event, err := database.GetEventByID(c.Request.Context(), participant.EventID)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get event: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return participant, event, true
+}
+
+// cancellable reports whether someone can still cancel their own registration
+func cancellable(participant *database.Participant, event *database.Event) bool {
+	if participant.SeatStatus == database.SeatDriver {
+		return false
+	}
+	switch event.EventStatus {
+	case database.EventStatusCancelled, database.EventStatusCompleted:
+		return false
+	}
+	start, err := event.StartTime()
+	return err != nil || time.Now().Before(start)
+}
+
+func handleGetRegistration(c *gin.Context) {
+	participant, event, ok := registrationByToken(c, registrationToken(c))
+	if !ok {
+		return
+	}
+
+	reminders, err := database.ReminderEmails(c.Request.Context(), participant.PersonID)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get reminder preference: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, ManagedRegistration{
+		Name:          participant.DisplayName(),
+		EventLocation: event.EventLocation,
+		EventDate:     event.EventDate,
+		MeetLocation:  event.MeetLocation,
+		MeetTime:      event.MeetTime,
+		SeatStatus:    participant.SeatStatus,
+		EventStatus:   event.EventStatus,
+		Reminders:     reminders,
+		Cancellable:   cancellable(participant, event),
+	})
+}
+
+// handleCancelRegistration lets someone give up their place from the link in their reminder, so
+// their seat goes to the waitlist
+func handleCancelRegistration(c *gin.Context) {
+	tokenData := registrationTokenData{Token: c.Param("token")}
+	if tokenData.Token == "" {
+		if err := c.ShouldBindJSON(&tokenData); err != nil {
+			msg := fmt.Sprintf("Invalid cancellation: %s", err)
+			logger.WarnContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	participant, event, ok := registrationByToken(c, tokenData.Token)
+	if !ok {
+		return
+	}
+	if participant.SeatStatus == database.SeatDriver {
+		sendResponse(c, false, "You're driving, please let the committee know you can't make it so your passengers can be moved", http.StatusConflict)
+		return
+	}
+	if !cancellable(participant, event) {
+		sendResponse(c, false, "This session can no longer be cancelled", http.StatusConflict)
+		return
+	}
+
+	promoted, err := database.DeleteParticipant(c.Request.Context(), participant.ParticipantID)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to cancel registration: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Participant cancelled their registration", "participant_id", participant.ParticipantID, "event_id", event.EventID)
+	for _, promotedParticipant := range promoted {
+		logger.InfoContext(c.Request.Context(), "Promoted participant from waitlist", "participant_id", promotedParticipant.ParticipantID, "event_id", event.EventID)
+	}
+	live.Publish(c.Request.Context(), event.EventID, live.ChangeRemoved)
+
+	sendResponse(c, true, "Your registration has been cancelled, thanks for letting us know", http.StatusOK)
+}
+
+func handleSetRegistrationReminders(c *gin.Context) {
+	var reminderData struct {
+		registrationTokenData
+		Enabled bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&reminderData); err != nil {
+		msg := fmt.Sprintf("Invalid reminder preference: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	if token := c.Param("token"); token != "" {
+		reminderData.Token = token
+	}
+
+	participant, _, ok := registrationByToken(c, reminderData.Token)
+	if !ok {
+		return
+	}
+
+	if err := database.SetReminderEmails(c.Request.Context(), participant.PersonID, reminderData.Enabled); err != nil {
+		msg := fmt.Sprintf("Failed to update reminder preference: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Updated reminder preference", "person_id", participant.PersonID, "enabled", reminderData.Enabled)
+	msg := "You won't be sent reminders before sessions"
+	if reminderData.Enabled {
+		msg = "You'll be sent reminders before sessions"
+	}
+	sendResponse(c, true, msg, http.StatusOK)
+}
@@ -1,36 +1,109 @@
 package run
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"regexp"
+	"net/mail"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/allocation"
 	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/export"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/logging"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/metrics"
 	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/scheduler"
 	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/token"
 	"github.com/gin-gonic/gin"
 	_ "github.com/glebarez/go-sqlite"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type RegistrationData struct {
-	Name    string `json:"name"`
-	Member  bool   `json:"member"`
-	EventID int    `json:"event"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	PreferredName string `json:"preferred_name"`
+	Member        bool   `json:"member"`
+	Email         string `json:"email"`
+	EventID       int    `json:"event"`
+	// Reminders is whether they want emails before their sessions. It's only saved the first time
+	// someone registers, after that they change it from their registration link.
+	Reminders *bool `json:"reminders"`
+
+	// Deprecated: Name is only sent by older copies of the register page, use GivenName and FamilyName
+	Name string `json:"name"`
 }
 
-type Run struct{}
+type Run struct {
+	Address         string        `default:":8080" help:"Address for the webserver to listen on"`
+	ShutdownTimeout time.Duration `default:"30s" help:"How long to wait for in-flight requests and jobs when shutting down"`
+
+	LogLevel      string `default:"info" enum:"debug,info,warn,error" help:"Minimum level of log messages to output"`
+	LogFormat     string `default:"text" enum:"text,json" help:"Format of log messages"`
+	LogFile       string `help:"Write logs to this file instead of stderr"`
+	LogMaxSize    int    `default:"10" help:"Size in megabytes at which the log file is rotated"`
+	LogMaxBackups int    `default:"5" help:"Number of rotated log files to keep"`
+
+	MetricsAddress string `help:"Serve /metrics on a separate address (e.g. 127.0.0.1:9090) instead of the main webserver"`
+	MetricsAuth    bool   `help:"Require an admin login to view /metrics on the main webserver"`
+
+	Reminders []time.Duration `default:"24h,2h" help:"How long before the meet time everyone with a seat is reminded of a session, one reminder for each"`
+}
 
 var encryptionPassPhrase string
 
+var allocationPolicy = allocation.DefaultPolicy()
+
+var logger = slog.Default()
+
+// Set once a shutdown signal is received so the readiness check fails while requests drain
+var shuttingDown atomic.Bool
+
 func (r *Run) Run() error {
-	err := godotenv.Load("./config.env")
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	configuredLogger, logOutput, err := logging.New(logging.Config{
+		Level:      r.LogLevel,
+		Format:     r.LogFormat,
+		File:       r.LogFile,
+		MaxSizeMB:  r.LogMaxSize,
+		MaxBackups: r.LogMaxBackups,
+	})
 	if err != nil {
 		return err
 	}
+	defer logOutput.Close()
+
+	logger = configuredLogger
+	slog.SetDefault(logger)
+	database.SetLogger(logger)
+	scheduler.SetLogger(logger)
+	live.SetLogger(logger)
+
+	err = godotenv.Load("./config.env")
+	if err != nil {
+		return err
+	}
+
+	allocationPolicy, err = allocation.LoadPolicy()
+	if err != nil {
+		return fmt.Errorf("failed to load allocation policy: %v", err)
+	}
+	scheduler.SetAllocationPolicy(allocationPolicy)
+	scheduler.SetSessionReminders(r.Reminders)
+
 	generatedPassphrase, err := token.GenerateRandomPassphrase(32)
 	if err != nil {
 		return fmt.Errorf("failed to generate secure passphrase for encryption: %v", err)
@@ -42,11 +115,99 @@ func (r *Run) Run() error {
 		return fmt.Errorf("failed to generate new encrypted token: %v", err)
 	}
 
-	scheduler.CheckScheduledEvents()
+	err = database.Migrate(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	// Status changes made anywhere reschedule the event's jobs and update what visitors see
+	database.OnTransition(scheduler.HandleTransition)
+	database.OnTransition(handleTransition)
+
+	err = scheduler.InitialiseScheduler(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialise scheduler: %v", err)
+	}
+
+	var metricsServer *http.Server
+	var metrics []gin.HandlerFunc
+	if r.MetricsAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", promhttp.Handler())
+		metricsServer = &http.Server{
+			Addr:     r.MetricsAddress,
+			Handler:  metricsMux,
+			ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+		}
+	} else if r.MetricsAuth {
+		metrics = []gin.HandlerFunc{authMiddleware(encryptionPassPhrase), gin.WrapH(promhttp.Handler())}
+	} else {
+		metrics = []gin.HandlerFunc{gin.WrapH(promhttp.Handler())}
+	}
+
+	router := newRouter(encryptionPassPhrase, metrics...)
+	for _, route := range undocumentedRoutes(router.Routes()) {
+		logger.Warn("Route is missing from the API document", "route", route)
+	}
+
+	server := &http.Server{
+		Addr:     r.Address,
+		Handler:  router,
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
+	}
 
-	scheduler.InitialiseScheduler()
+	logger.Info("Webserver listening", "address", r.Address)
 
-	router := gin.Default()
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	if metricsServer != nil {
+		logger.Info("Metrics listening", "address", r.MetricsAddress)
+		go func() {
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			scheduler.Stop(context.Background())
+			return fmt.Errorf("webserver failed: %v", err)
+		}
+	case <-ctx.Done():
+	}
+
+	logger.Info("Shutting down, waiting for in-flight requests and jobs")
+	shuttingDown.Store(true)
+	live.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Failed to shut down webserver cleanly", "error", err)
+	}
+
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to shut down metrics server cleanly", "error", err)
+		}
+	}
+
+	if err := scheduler.Stop(shutdownCtx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// newRouter sets up the pages and API, with admin tokens checked against the passphrase they are
+// encrypted with. /metrics is served by the handlers given, and left off when there are none.
+func newRouter(encryptionPassPhrase string, metrics ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	router.Use(requestIDMiddleware(), requestLoggerMiddleware(), metricsMiddleware(), gin.Recovery())
 
 	router.Static("/resources", "./resources")
 	router.Static("/register", "./register")
@@ -57,26 +218,115 @@ func (r *Run) Run() error {
 	router.GET("/admin/dashboard", authMiddleware(encryptionPassPhrase), func(c *gin.Context) {
 		c.File("./admin/dashboard.html")
 	})
+	router.GET("/admin/checkin", authMiddleware(encryptionPassPhrase), func(c *gin.Context) {
+		c.File("./admin/checkin.html")
+	})
 
 	// API Endpoints
-	router.GET("/", func(c *gin.Context) { c.Redirect(http.StatusMovedPermanently, "/register") })
+	router.GET("/", func(c *gin.Context) { c.Redirect(http.StatusFound, "/events") })
+	router.GET("/events", func(c *gin.Context) {
+		c.File("./register/events.html")
+	})
+	router.GET("/cancel", func(c *gin.Context) {
+		c.File("./register/cancel.html")
+	})
 
-	router.POST("/api/register", handleAPIRegister)
+	router.GET("/healthz", handleLiveness)
+	router.GET("/readyz", handleReadiness)
+
+	if len(metrics) > 0 {
+		router.GET("/metrics", metrics...)
+	}
+
+	router.GET("/api/openapi.json", handleAPIDocument)
+	registerAPIv1(router, encryptionPassPhrase)
+	router.NoRoute(handleAPINotFound)
+
+	// The routes before /api/v1, kept for existing clients
+	router.POST("/api/register", deprecated("/api/v1/events/{event}/registrations"), handleAPIRegister)
+	router.POST("/api/drivers", deprecated("/api/v1/events/{event}/driver-offers"), handleOfferToDrive)
+	router.GET("/api/registration", deprecated("/api/v1/registrations/{token}"), handleGetRegistration)
+	router.POST("/api/registration/cancel", deprecated("/api/v1/registrations/{token}"), handleCancelRegistration)
+	router.PUT("/api/registration/reminders", deprecated("/api/v1/registrations/{token}/reminders"), handleSetRegistrationReminders)
+
+	router.GET("/calendar.ics", handleCalendarFeed)
+	router.GET("/calendar/event.ics", handleEventCalendar)
+	router.GET("/calendar/person/:token", handlePersonalCalendar)
+
+	router.POST("/api/login", deprecated("/api/v1/login"), handleAdminLogin)
+
+	router.GET("/api/event", deprecated("/api/v1/events/{event}"), handleEventDetails)
+	router.GET("/api/events/upcoming", deprecated("/api/v1/events/upcoming"), handleUpcomingEvents)
+	router.GET("/api/events/stream", deprecated("/api/v1/events/{event}/stream"), handleSeatStream)
+	router.DELETE("/api/event", deprecated("/api/v1/events/{event}"), authMiddleware(encryptionPassPhrase), handleDeleteEvent)
+	router.POST("/api/event/cancel", deprecated("/api/v1/events/{event}/cancel"), authMiddleware(encryptionPassPhrase), handleCancelEvent)
+	router.POST("/api/event/approve", deprecated("/api/v1/events/{event}/approve"), authMiddleware(encryptionPassPhrase), handleApproveEvent)
+	router.POST("/api/event/reopen", deprecated("/api/v1/events/{event}/reopen"), authMiddleware(encryptionPassPhrase), handleReopenEvent)
+	router.POST("/api/event/complete", deprecated("/api/v1/events/{event}/complete"), authMiddleware(encryptionPassPhrase), handleCompleteEvent)
+
+	router.GET("/api/events", deprecated("/api/v1/events"), authMiddleware(encryptionPassPhrase), handleGetEvents)
+	router.POST("/api/events", deprecated("/api/v1/events"), authMiddleware(encryptionPassPhrase), handleCreateEvent)
+	router.POST("/api/events/import", deprecated("/api/v1/events/import"), authMiddleware(encryptionPassPhrase), handleImportEvents)
+	router.GET("/api/events/pending", deprecated("/api/v1/events/pending"), authMiddleware(encryptionPassPhrase), handleGetPendingEvents)
+	router.PUT("/api/events", deprecated("/api/v1/events/{event}"), authMiddleware(encryptionPassPhrase), handleUpdateEvent)
+
+	router.GET("/api/participants", deprecated("/api/v1/events/{event}/participants"), authMiddleware(encryptionPassPhrase), handleGetEventParticipants)
+	router.DELETE("/api/participant", deprecated("/api/v1/events/{event}/participants/{participant}"), authMiddleware(encryptionPassPhrase), handleDeleteParticipant)
+	router.PUT("/api/participant/attendance", deprecated("/api/v1/events/{event}/participants/{participant}/attendance"), authMiddleware(encryptionPassPhrase), handleSetAttendance)
+	router.PUT("/api/participant/vehicle", deprecated("/api/v1/events/{event}/participants/{participant}/vehicle"), authMiddleware(encryptionPassPhrase), handleAssignVehicle)
+
+	router.GET("/api/vehicles", deprecated("/api/v1/events/{event}/vehicles"), authMiddleware(encryptionPassPhrase), handleGetVehicles)
+	router.POST("/api/vehicles", deprecated("/api/v1/events/{event}/vehicles"), authMiddleware(encryptionPassPhrase), handleAddVehicle)
+	router.PUT("/api/vehicles", deprecated("/api/v1/events/{event}/vehicles/{vehicle}"), authMiddleware(encryptionPassPhrase), handleUpdateVehicle)
+	router.DELETE("/api/vehicle", deprecated("/api/v1/events/{event}/vehicles/{vehicle}"), authMiddleware(encryptionPassPhrase), handleDeleteVehicle)
+	router.POST("/api/vehicles/assign", deprecated("/api/v1/events/{event}/vehicles/assign"), authMiddleware(encryptionPassPhrase), handleAutoAssignVehicles)
+	router.GET("/api/drivers", deprecated("/api/v1/events/{event}/driver-offers"), authMiddleware(encryptionPassPhrase), handleGetDriverOffers)
+	router.POST("/api/drivers/approve", deprecated("/api/v1/events/{event}/driver-offers/{offer}/approve"), authMiddleware(encryptionPassPhrase), handleApproveDriverOffer)
+	router.POST("/api/drivers/decline", deprecated("/api/v1/events/{event}/driver-offers/{offer}/decline"), authMiddleware(encryptionPassPhrase), handleDeclineDriverOffer)
+
+	router.GET("/api/attendance", deprecated("/api/v1/attendance"), authMiddleware(encryptionPassPhrase), handleGetAttendanceHistory)
+	router.GET("/api/members", deprecated("/api/v1/members"), authMiddleware(encryptionPassPhrase), handleGetMembers)
+	router.POST("/api/members", deprecated("/api/v1/members"), authMiddleware(encryptionPassPhrase), handleImportMembers)
+	router.GET("/api/people", deprecated("/api/v1/people"), authMiddleware(encryptionPassPhrase), handleGetPeople)
+	router.POST("/api/people/merge", deprecated("/api/v1/people/merge"), authMiddleware(encryptionPassPhrase), handleMergePeople)
+	router.PUT("/api/people/driver", deprecated("/api/v1/people/{person}/driver"), authMiddleware(encryptionPassPhrase), handleSetQualifiedDriver)
+	router.GET("/api/export/participants", deprecated("/api/v1/events/{event}/export"), authMiddleware(encryptionPassPhrase), handleExportParticipants)
+	router.GET("/api/export/events", deprecated("/api/v1/export/events"), authMiddleware(encryptionPassPhrase), handleExportEvents)
+
+	return router
+}
 
-	router.POST("/api/login", handleAdminLogin)
+func handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
 
-	router.GET("/api/event", handleEventDetails)
-	router.DELETE("/api/event", authMiddleware(encryptionPassPhrase), handleDeleteEvent)
+func handleReadiness(c *gin.Context) {
+	checks := gin.H{
+		"database":  "ok",
+		"scheduler": "ok",
+	}
+	ready := true
 
-	router.GET("/api/events", authMiddleware(encryptionPassPhrase), handleGetEvents)
-	router.POST("/api/events", authMiddleware(encryptionPassPhrase), handleCreateEvent)
-	router.PUT("/api/events", authMiddleware(encryptionPassPhrase), handleUpdateEvent)
+	if err := database.Ping(c.Request.Context()); err != nil {
+		checks["database"] = err.Error()
+		ready = false
+	}
 
-	router.GET("/api/participants", authMiddleware(encryptionPassPhrase), handleGetEventParticipants)
-	router.DELETE("/api/participant", authMiddleware(encryptionPassPhrase), handleDeleteParticipant)
+	if !scheduler.Running() {
+		checks["scheduler"] = "not running"
+		ready = false
+	}
 
-	router.Run(":8080")
-	return nil
+	if shuttingDown.Load() {
+		ready = false
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	c.JSON(status, gin.H{"ready": ready, "checks": checks})
 }
 
 func authMiddleware(encryptionPassPhrase string) gin.HandlerFunc {
@@ -84,8 +334,8 @@ func authMiddleware(encryptionPassPhrase string) gin.HandlerFunc {
 		tokenString, err := c.Cookie("token")
 		if err != nil {
 			// Return a 404, hide the existence of the page if they are not authorized to view it
-			c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
-			consoleError("No auth token present")
+			sendError(c, http.StatusNotFound, codeNotFound, "Not Found")
+			logger.WarnContext(c.Request.Context(), "No auth token present")
 			c.Abort()
 			return
 		}
@@ -93,8 +343,8 @@ func authMiddleware(encryptionPassPhrase string) gin.HandlerFunc {
 		key, err := token.GetCryptographicKey(encryptionPassPhrase)
 		if err != nil {
 			// Return a 404, hide the existence of the page if they are not authorized to view it
-			c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
-			consoleError("No auth token present")
+			sendError(c, http.StatusNotFound, codeNotFound, "Not Found")
+			logger.ErrorContext(c.Request.Context(), "Failed to get cryptographic key", "error", err)
 			c.Abort()
 			return
 		}
@@ -102,210 +352,335 @@ func authMiddleware(encryptionPassPhrase string) gin.HandlerFunc {
 		token, err := token.ValidateJWT(tokenString, key)
 		if err != nil {
 			// Return a 404, hide the existence of the page if they are not authorized to view it
-			c.JSON(http.StatusNotFound, gin.H{"error": "Not Found"})
-			consoleError(fmt.Sprintf("Auth failed: %v\n", err))
+			sendError(c, http.StatusNotFound, codeNotFound, "Not Found")
+			logger.WarnContext(c.Request.Context(), "Auth failed", "error", err)
 			c.Abort()
 			return
 		}
 
-		consoleLog("Authenticated token, proceeding")
+		logger.DebugContext(c.Request.Context(), "Authenticated token, proceeding")
 
 		c.Set("claims", token.Claims)
 		c.Next()
 	}
 }
 
-func consoleError(msg string) {
-	fmt.Println("\033[31m[ERR] " + msg + "\033[0m")
-}
-
-func consoleLog(msg string) {
-	fmt.Println("[DBG] " + msg)
+// adminUsername returns who is logged in, from the token checked by authMiddleware
+func adminUsername(c *gin.Context) string {
+	claims, ok := c.MustGet("claims").(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	username, _ := claims["username"].(string)
+	return username
 }
 
 func handleUpdateEvent(c *gin.Context) {
-	// Get event_id from URL params
-	eventIDParam := c.Query("event")
-	if eventIDParam == "NaN" {
+	eventID, ok := idParam(c, "event")
+	if !ok {
 		return
 	}
 
-	eventID, err := strconv.Atoi(eventIDParam)
-	if err != nil {
+	var event database.Event
+	if err := c.ShouldBindJSON(&event); err != nil {
 		msg := fmt.Sprintf("Failed to update event: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
 		return
 	}
+	// The event being updated is the one in the URL, whatever the body says
+	event.EventID = eventID
 
-	var event database.Event
-	if err := c.BindJSON(&event); err != nil {
-		msg := fmt.Sprintf("Failed to update event: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusBadRequest)
+	oldEvent, ok := eventByID(c, eventID)
+	if !ok {
 		return
 	}
 
-	eventParticipants, err := database.GetEventParticipants(event.EventID)
+	eventParticipants, err := database.GetEventParticipants(c.Request.Context(), eventID)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to get event participants for update: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusBadRequest)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
-	event.SeatsTaken = len(eventParticipants)
+	event.SeatsTaken = 0
+	for _, participant := range eventParticipants {
+		if participant.SeatStatus == database.SeatConfirmed {
+			event.SeatsTaken++
+		}
+	}
 
-	oldEvent, err := database.GetEventByID(event.EventID)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to get old event for update: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusInternalServerError)
+	// The seed is fixed when the event is created so a draw can always be reproduced
+	if event.AllocationMode == "" {
+		event.AllocationMode = oldEvent.AllocationMode
+	}
+	if !event.AllocationMode.Valid() {
+		msg := fmt.Sprintf("Unknown allocation mode %q", event.AllocationMode)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
 		return
 	}
+	event.BallotSeed = oldEvent.BallotSeed
+	if event.AllocationMode == database.AllocationBallot && event.BallotSeed == 0 {
+		seed, err := allocation.NewSeed()
+		if err != nil {
+			msg := fmt.Sprintf("Failed to update event: %s", err)
+			logger.ErrorContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusInternalServerError)
+			return
+		}
+		event.BallotSeed = seed
+	}
 
-	event.EventStatus = oldEvent.EventStatus
+	// A session moved to another day keeps the same start and length relative to the meet time
+	if err := event.ResolveTimes(oldEvent); err != nil {
+		msg := fmt.Sprintf("Failed to update event: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	if err := event.Validate(); err != nil {
+		msg := fmt.Sprintf("Failed to update event: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
 
-	if err := database.UpdateEventInDatabase(eventID, event); err != nil {
+	if err := database.UpdateEventInDatabase(c.Request.Context(), eventID, event); err != nil {
 		msg := fmt.Sprintf("Failed to update event: %s", err)
-		consoleError(msg)
+		logger.ErrorContext(c.Request.Context(), msg)
 		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
+	// Extra seats go to the waitlist straight away
+	promoted, err := database.PromoteFromWaitlist(c.Request.Context(), eventID, false)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to promote waitlisted participants", "event_id", eventID, "error", err)
+	}
+	for _, participant := range promoted {
+		logger.InfoContext(c.Request.Context(), "Promoted participant from waitlist", "participant_id", participant.ParticipantID, "event_id", eventID)
+	}
+
+	scheduler.RescheduleEvent(c.Request.Context(), eventID)
+	invalidateUpcoming()
+	live.Publish(c.Request.Context(), eventID, live.ChangeUpdated)
+
 	sendResponse(c, true, "Successfully updated event", http.StatusOK)
 }
 
 func handleEventDetails(c *gin.Context) {
-	// Get event_id from URL params
-	eventIDParam := c.Query("event")
-	if eventIDParam == "NaN" {
+	eventID, ok := idParam(c, "event")
+	if !ok {
 		return
 	}
 
-	eventID, err := strconv.Atoi(eventIDParam)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to get event: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
-		return
-	}
-
-	event, err := database.GetEventByID(eventID)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to get event: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+	event, ok := publicEventByID(c, eventID)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, event)
+	c.JSON(http.StatusOK, newPublicEvent(*event))
 }
 
 func handleDeleteEvent(c *gin.Context) {
-	// Get event from URL params
-	eventIDParam := c.Query("event")
-	if eventIDParam == "NaN" {
+	eventID, ok := idParam(c, "event")
+	if !ok {
 		return
 	}
 
-	eventID, err := strconv.Atoi(eventIDParam)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to find event: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+	err := database.DeleteEvent(c.Request.Context(), eventID)
+	if errors.Is(err, database.ErrEventNotFound) {
+		sendResponse(c, false, "Event not found", http.StatusNotFound)
 		return
 	}
-
-	err = database.DeleteEvent(eventID)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to delete event: %s", err)
-		consoleError(msg)
+		logger.ErrorContext(c.Request.Context(), msg)
 		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
+	scheduler.UnscheduleEvent(eventID)
+	invalidateUpcoming()
+	live.Publish(c.Request.Context(), eventID, live.ChangeDeleted)
+
 	sendResponse(c, true, "Successfully deleted event", http.StatusOK)
 }
 
 func handleCreateEvent(c *gin.Context) {
 	var event database.Event
-	if err := c.BindJSON(&event); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		consoleError(err.Error())
+	if err := c.ShouldBindJSON(&event); err != nil {
+		msg := fmt.Sprintf("Invalid event: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := event.ResolveTimes(nil); err != nil {
+		logger.WarnContext(c.Request.Context(), "Invalid event", "error", err)
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := event.Validate(); err != nil {
+		logger.WarnContext(c.Request.Context(), "Invalid event", "error", err)
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if event.AllocationMode == database.AllocationBallot {
+		seed, err := allocation.NewSeed()
+		if err != nil {
+			msg := fmt.Sprintf("Failed to create event: %s", err)
+			logger.ErrorContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusInternalServerError)
+			return
+		}
+		event.BallotSeed = seed
+	}
+	event.CreatedBy = adminUsername(c)
 
-	err := database.CreateEvent(event)
+	eventID, err := database.CreateEvent(c.Request.Context(), event)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		consoleError(err.Error())
+		msg := fmt.Sprintf("Failed to create event: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
-	scheduler.CheckScheduledEvents()
+	scheduler.RescheduleEvent(c.Request.Context(), eventID)
+	invalidateUpcoming()
 
-	// Handle POST request
-	sendResponse(c, true, "Event added!", http.StatusOK)
+	c.Header("Location", fmt.Sprintf("/api/v1/events/%d", eventID))
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"message":  "Event added! It will be announced once another admin approves it",
+		"event_id": eventID,
+	})
 }
 
 func handleDeleteParticipant(c *gin.Context) {
-	// Get participant from URL params
-	participantIDParam := c.Query("participant")
-	if participantIDParam == "NaN" {
+	participantID, ok := idParam(c, "participant")
+	if !ok {
 		return
 	}
 
-	participantID, err := strconv.Atoi(participantIDParam)
+	deleted, err := database.GetParticipantByID(c.Request.Context(), participantID)
+	if errors.Is(err, database.ErrParticipantNotFound) {
+		sendResponse(c, false, "Participant not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		msg := fmt.Sprintf("Failed to find participant: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
-	err = database.DeleteParticipant(participantID)
+	promoted, err := database.DeleteParticipant(c.Request.Context(), participantID)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to delete participant: %s", err)
-		consoleError(msg)
+		logger.ErrorContext(c.Request.Context(), msg)
 		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
+	for _, participant := range promoted {
+		logger.InfoContext(c.Request.Context(), "Promoted participant from waitlist", "participant_id", participant.ParticipantID, "event_id", participant.EventID)
+	}
+
+	live.Publish(c.Request.Context(), deleted.EventID, live.ChangeRemoved)
+
 	sendResponse(c, true, "Successfully deleted participant", http.StatusOK)
 }
 
+// How many events the dashboard is sent at once, unless it asks for a different page size
+const (
+	defaultEventPageSize = 50
+	maxEventPageSize     = 200
+)
+
+// parseEventQuery reads the filters, order and page of events asked for. Statuses are a comma
+// separated list, dates are YYYY-MM-DD and the to date is included in the range.
+func parseEventQuery(c *gin.Context) (database.EventQuery, error) {
+	query := database.EventQuery{
+		Location: c.Query("location"),
+		Order:    database.EventOrder(c.Query("order")),
+		After:    c.Query("cursor"),
+		Limit:    defaultEventPageSize,
+	}
+
+	for _, name := range strings.Split(c.Query("status"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		var status database.EventStatus
+		if err := status.UnmarshalText([]byte(name)); err != nil {
+			return query, err
+		}
+		query.Statuses = append(query.Statuses, status)
+	}
+
+	from, to, err := export.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return query, err
+	}
+	query.From = from
+	if !to.IsZero() {
+		query.To = to.AddDate(0, 0, 1)
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit < 1 || query.Limit > maxEventPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxEventPageSize)
+		}
+	}
+	return query, nil
+}
+
+// handleGetEvents lists a page of events matching the filters asked for. The cursor of the next
+// page is sent in the X-Next-Cursor header, which is left out on the last page.
 func handleGetEvents(c *gin.Context) {
-	events, err := database.GetEvents()
+	query, err := parseEventQuery(c)
 	if err != nil {
-		consoleError(err.Error())
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := database.GetEventPage(c.Request.Context(), query)
+	if errors.Is(err, database.ErrUnknownEventOrder) || errors.Is(err, database.ErrInvalidCursor) {
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Request failed", "error", err)
 		sendResponse(c, false, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, events)
+	if page.Next != "" {
+		c.Header("X-Next-Cursor", page.Next)
+	}
+	if page.Events == nil {
+		page.Events = []database.Event{}
+	}
+	c.JSON(http.StatusOK, page.Events)
 }
 
 func handleGetEventParticipants(c *gin.Context) {
-	// Get event_id from URL params
-	eventIDParam := c.Query("event")
-	if eventIDParam == "NaN" {
+	eventID, ok := idParam(c, "event")
+	if !ok {
 		return
 	}
-
-	eventID, err := strconv.Atoi(eventIDParam)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to get event participants: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+	if _, ok := eventByID(c, eventID); !ok {
 		return
 	}
 
-	participants, err := database.GetEventParticipants(eventID)
+	participants, err := database.GetEventParticipants(c.Request.Context(), eventID)
 	if err != nil {
 		msg := fmt.Sprintf("Failed to get event participants: %s", err)
-		consoleError(msg)
-		sendResponse(c, false, msg, http.StatusNotFound)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
 		return
 	}
 
@@ -316,128 +691,260 @@ func handleAPIRegister(c *gin.Context) {
 	// Process user data
 	var registrationData RegistrationData
 	if err := c.ShouldBindJSON(&registrationData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		consoleError(err.Error())
+		msg := fmt.Sprintf("Invalid registration: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+	if !pathEventID(c, &registrationData.EventID) {
 		return
 	}
 
 	// Process received data
-	if !validateName(registrationData.Name) {
-		msg := "Invalid name, please enter your first and last name"
+	firstName, surname, preferredName, err := registrationNames(registrationData)
+	if err != nil {
+		recordRegistration(0, metrics.ReasonInvalidName)
+		msg := fmt.Sprintf("Invalid name, please check your given and family name (%v)", err)
 		sendResponse(c, false, msg, http.StatusBadRequest)
-		consoleError(msg)
+		logger.WarnContext(c.Request.Context(), msg)
 		return
 	}
 
 	// Get event details
-	event, err := database.GetEventByID(registrationData.EventID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error})
-		consoleError(err.Error())
+	event, ok := publicEventByID(c, registrationData.EventID)
+	if !ok {
+		recordRegistration(0, metrics.ReasonError)
 		return
 	}
 
-	// Check that sign ups are open
-	dateFormat := "02/01/2006 15:04:05"
+	if !event.EventStatus.AcceptingRegistrations() {
+		recordRegistration(event.EventID, metrics.ReasonClosed)
+		msg := "The event is not currently open for registration"
+		if event.EventStatus == database.EventStatusCancelled {
+			msg = "This session has been cancelled"
+		}
+		sendError(c, http.StatusConflict, codeRegistrationClosed, msg)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
 
-	closeTime, err := time.Parse(dateFormat, event.CloseDatetime)
+	// Check that sign ups are open
+	openTime, err := event.OpenTime()
+	if err != nil {
+		recordRegistration(event.EventID, metrics.ReasonError)
+		msg := "Unable to parse event open date"
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+	closeTime, err := event.CloseTime()
 	if err != nil {
+		recordRegistration(event.EventID, metrics.ReasonError)
 		msg := "Unable to parse event close date"
 		sendResponse(c, false, msg, http.StatusInternalServerError)
-		consoleError(msg)
+		logger.ErrorContext(c.Request.Context(), msg)
 		return
 	}
 
-	// Get current time in local timezone
-	localTime := time.Now()
+	now := time.Now()
+	if now.Before(openTime) || !now.Before(closeTime) {
+		recordRegistration(event.EventID, metrics.ReasonClosed)
+		msg := "The event is not currently open for registration"
+		sendError(c, http.StatusConflict, codeRegistrationClosed, msg)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
+
+	email := strings.TrimSpace(registrationData.Email)
+	if email != "" {
+		address, err := mail.ParseAddress(email)
+		if err != nil {
+			recordRegistration(event.EventID, metrics.ReasonInvalidEmail)
+			msg := "Invalid email address"
+			sendResponse(c, false, msg, http.StatusBadRequest)
+			logger.WarnContext(c.Request.Context(), msg)
+			return
+		}
+		email = address.Address
+	}
+	if email == "" && event.AllocationMode == database.AllocationBallot {
+		recordRegistration(event.EventID, metrics.ReasonInvalidEmail)
+		msg := "An email address is required to enter the ballot, so we can send you the result"
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
 
-	// Get current time without timezone information for comparison
-	currentTime := time.Date(localTime.Year(), localTime.Month(), localTime.Day(), localTime.Hour(), localTime.Minute(),
-		localTime.Second(), localTime.Nanosecond(), time.UTC)
+	registrant := database.Registrant{
+		FirstName:     firstName,
+		LastName:      surname,
+		PreferredName: preferredName,
+		Email:         email,
+		Member:        registrationData.Member,
+		Reminders:     registrationData.Reminders,
+	}
 
-	if !(currentTime.Before(closeTime)) {
-		msg := "The event is not currently open for registration"
-		sendResponse(c, false, msg, http.StatusForbidden)
-		consoleError(msg)
+	// Membership comes from the roster rather than the checkbox, anything that doesn't match is flagged
+	membershipFlag, err := verifyMembership(c.Request.Context(), &registrant)
+	if err != nil {
+		recordRegistration(event.EventID, metrics.ReasonError)
+		msg := fmt.Sprintf("Failed to check membership: %v", err)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
 		return
 	}
+	if membershipFlag != "" {
+		logger.WarnContext(c.Request.Context(), "Membership mismatch", "first_name", firstName, "last_name", surname, "event_id", event.EventID, "flag", membershipFlag)
+	}
 
-	if event.RequireMember && !registrationData.Member {
+	if event.RequireMember && !registrant.Member {
+		recordRegistration(event.EventID, metrics.ReasonNotMember)
 		msg := "This event requires you to have paid membership fees"
+		if membershipFlag != "" {
+			msg = "We couldn't find a current membership for you, please use the name or email you joined the society with or speak to the committee"
+		}
 		sendResponse(c, false, msg, http.StatusForbidden)
-		consoleError(msg)
+		logger.WarnContext(c.Request.Context(), msg)
 		return
 	}
 
-	// Check that a seat is available
-	if event.TotalSeats-event.SeatsTaken <= 0 {
-		msg := "There are no seats available for this event"
+	// Apply the allocation policy based on their past registrations
+	history, err := registrantHistory(c.Request.Context(), registrant)
+	if err != nil {
+		recordRegistration(event.EventID, metrics.ReasonError)
+		msg := fmt.Sprintf("Failed to get registration history: %v", err)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+
+	decision := allocationPolicy.Evaluate(history, time.Now())
+	if decision.Blocked {
+		recordRegistration(event.EventID, metrics.ReasonCooldown)
+		msg := "You can't register for this event because of recent no-shows, please speak to the committee"
 		sendResponse(c, false, msg, http.StatusForbidden)
-		consoleError(msg)
+		logger.WarnContext(c.Request.Context(), msg, "reason", decision.Reason)
 		return
 	}
 
 	// Make updates to database
-	formattedName := strings.Title(registrationData.Name)
-	firstName, surname := splitName(formattedName)
-	err = event.AddParticipant(firstName, surname, registrationData.Member)
+	participant, err := event.AddParticipant(c.Request.Context(), registrant, decision.Allocation)
+	if errors.Is(err, database.ErrDuplicateParticipant) {
+		recordRegistration(event.EventID, metrics.ReasonDuplicate)
+		msg := "You are already registered for this event"
+		sendError(c, http.StatusConflict, codeAlreadyRegistered, msg)
+		logger.WarnContext(c.Request.Context(), msg)
+		return
+	}
 	if err != nil {
+		recordRegistration(event.EventID, metrics.ReasonError)
 		msg := fmt.Sprintf("Failed to update database: %v", err)
 		sendResponse(c, false, msg, http.StatusInternalServerError)
-		consoleError(msg)
+		logger.ErrorContext(c.Request.Context(), msg)
+		return
+	}
+
+	live.Publish(c.Request.Context(), event.EventID, live.ChangeRegistered)
+	if membershipFlag != "" {
+		if err := database.SetMembershipFlag(c.Request.Context(), participant.ParticipantID, membershipFlag); err != nil {
+			logger.ErrorContext(c.Request.Context(), "Failed to flag membership mismatch", "participant_id", participant.ParticipantID, "error", err)
+		}
+	}
+
+	if participant.SeatStatus == database.SeatDriver {
+		recordRegistration(event.EventID, metrics.ReasonNone)
+		logger.InfoContext(c.Request.Context(), "Driver registered", "participant_id", participant.ParticipantID)
+		sendRegistered(c, event, participant, "You're registered as a driver, you don't need a passenger seat")
 		return
 	}
 
+	if participant.SeatStatus == database.SeatBallot {
+		metrics.RegistrationsTotal.WithLabelValues(strconv.Itoa(event.EventID), "ballot_entry", metrics.ReasonNone).Inc()
+		logger.InfoContext(c.Request.Context(), "Participant entered ballot", "participant_id", participant.ParticipantID)
+		sendRegistered(c, event, participant, "You have been entered into the ballot, results are emailed when signups close")
+		return
+	}
+
+	if participant.SeatStatus == database.SeatWaitlisted {
+		reason := metrics.ReasonFull
+		msg := "The event is full, you have been added to the waitlist"
+		if participant.Cooldown {
+			reason = metrics.ReasonCooldown
+			msg = "Because of recent no-shows you have been added to the waitlist, any spare seats are given out when signups close"
+		}
+		recordWaitlisted(event.EventID, reason)
+		logger.InfoContext(c.Request.Context(), "Participant waitlisted", "participant_id", participant.ParticipantID, "priority", participant.Priority, "reason", participant.AllocationReason)
+		sendRegistered(c, event, participant, msg)
+		return
+	}
+
+	recordRegistration(event.EventID, metrics.ReasonNone)
+	if openTime, err := event.OpenTime(); err == nil {
+		metrics.RegistrationDelay.WithLabelValues(strconv.Itoa(event.EventID)).Observe(time.Since(openTime).Seconds())
+	}
+
 	// Handle POST request
-	sendResponse(c, true, "You have been added to the event!", http.StatusOK)
+	sendRegistered(c, event, participant, "You have been added to the event!")
 }
 
-func handleAdminLogin(c *gin.Context) {
-	type LoginData struct {
-		Username string
-		Password string
+// recordRegistration counts a registration attempt, with an empty reason meaning it was accepted.
+// An event ID of 0 is used before the event has been looked up, so unchecked input never becomes a label.
+func recordRegistration(eventID int, reason string) {
+	outcome := "accepted"
+	if reason != metrics.ReasonNone {
+		outcome = "rejected"
+	}
+
+	eventLabel := "unknown"
+	if eventID != 0 {
+		eventLabel = strconv.Itoa(eventID)
 	}
 
+	metrics.RegistrationsTotal.WithLabelValues(eventLabel, outcome, reason).Inc()
+}
+
+func recordWaitlisted(eventID int, reason string) {
+	metrics.RegistrationsTotal.WithLabelValues(strconv.Itoa(eventID), "waitlisted", reason).Inc()
+}
+
+type LoginData struct {
+	Username string
+	Password string
+}
+
+func handleAdminLogin(c *gin.Context) {
 	// Process user data
 	var loginData LoginData
-	if err := c.BindJSON(&loginData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		consoleError(err.Error())
+	if err := c.ShouldBindJSON(&loginData); err != nil {
+		msg := fmt.Sprintf("Invalid login: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
 		return
 	}
 
 	// Validate credentials
-	dbUser, err := database.GetUserFromDatabaseByUsername(loginData.Username)
+	dbUser, err := database.GetUserFromDatabaseByUsername(c.Request.Context(), loginData.Username)
 	if err != nil {
-		response := gin.H{
-			"success": false,
-			"message": "Invalid username or password",
-		}
-
-		// Send JSON response
-		c.JSON(http.StatusForbidden, response)
+		sendResponse(c, false, "Invalid username or password", http.StatusForbidden)
 		return
 	}
 
 	if database.ValidatePassword(loginData.Password, dbUser.PasswordHash) {
 		key, err := token.GetCryptographicKey(encryptionPassPhrase)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			consoleError(err.Error())
+			logger.ErrorContext(c.Request.Context(), "Request failed", "error", err)
+			sendResponse(c, false, "Failed to log in", http.StatusInternalServerError)
 			return
 		}
 
 		token, err := token.NewJWT(loginData.Username, key)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			consoleError(err.Error())
+			logger.ErrorContext(c.Request.Context(), "Request failed", "error", err)
+			sendResponse(c, false, "Failed to log in", http.StatusInternalServerError)
 			return
 		}
 
-		response := gin.H{
-			"success": true,
-			"message": "Authentication successful",
-		}
+		response := APIMessage{Success: true, Message: "Authentication successful"}
 
 		c.SetCookie("token", token, 3600, "/", "", false, true)
 
@@ -445,36 +952,17 @@ func handleAdminLogin(c *gin.Context) {
 		c.JSON(http.StatusAccepted, response)
 		return
 	} else {
-		response := gin.H{
-			"success": false,
-			"message": "Invalid username or password",
-		}
-
-		// Send JSON response
-		c.JSON(http.StatusForbidden, response)
+		sendResponse(c, false, "Invalid username or password", http.StatusForbidden)
 		return
 	}
 }
 
-func splitName(name string) (string, string) {
-	parts := strings.Split(name, " ")
-	firstName := parts[0]
-	surname := strings.Join(parts[1:], " ")
-	return firstName, surname
-}
-
-func validateName(name string) bool {
-	name = strings.ToLower(name)
-	regex := regexp.MustCompile("^[a-z]+ [a-z]+(-[a-z]+)*$")
-	return regex.MatchString(name)
-}
-
 func sendResponse(c *gin.Context, success bool, message string, statusCode int) {
-	response := gin.H{
-		"success": success,
-		"message": message,
+	if !success {
+		sendError(c, statusCode, errorCode(statusCode), message)
+		return
 	}
 
 	// Send JSON response
-	c.JSON(statusCode, response)
+	c.JSON(statusCode, APIMessage{Success: success, Message: message})
 }
@@ -0,0 +1,149 @@
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// How long the public listing is reused before reading the events again. Seats remaining can be
+// this far behind, but the register page shows the live count.
+const upcomingCacheTTL = 30 * time.Second
+
+// upcomingEvent is what the public listing shows about an event, leaving out anything only the
+// committee should see
+type upcomingEvent struct {
+	EventID        int                     `json:"event_id"`
+	EventLocation  string                  `json:"session_location"`
+	EventDate      string                  `json:"session_date"`
+	MeetLocation   string                  `json:"meet_point"`
+	MeetTime       string                  `json:"meet_time"`
+	TotalSeats     int                     `json:"total_seats"`
+	SeatsRemaining int                     `json:"seats_remaining"`
+	RequireMember  bool                    `json:"require_member"`
+	OpenDatetime   string                  `json:"open_date"`
+	CloseDatetime  string                  `json:"close_date"`
+	Open           bool                    `json:"open"`
+	AllocationMode database.AllocationMode `json:"allocation_mode"`
+	Link           string                  `json:"link"`
+
+	Cancelled          bool   `json:"cancelled"`
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+}
+
+// upcomingCache holds the encoded listing so a shared link doesn't mean a database read for
+// every visitor. The lock is held while refreshing so a burst of requests only reads once.
+var upcomingCache struct {
+	sync.Mutex
+	body    []byte
+	expires time.Time
+}
+
+// invalidateUpcoming drops the cached listing after the committee changes an event
+func invalidateUpcoming() {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+	upcomingCache.body = nil
+}
+
+// upcomingEvents picks the events still taking registrations or yet to open, soonest first.
+// Drafts, closed events, those past their close time and those with times that can't be read are left out.
+// Cancelled events stay listed so anyone planning to go sees they're off.
+func upcomingEvents(events []database.Event, now time.Time) []upcomingEvent {
+	type listed struct {
+		event upcomingEvent
+		start time.Time
+	}
+
+	var selected []listed
+	for _, event := range events {
+		if !event.EventStatus.AcceptingRegistrations() && event.EventStatus != database.EventStatusCancelled {
+			continue
+		}
+		start, err := event.StartTime()
+		if err != nil || start.Before(now) {
+			continue
+		}
+		openTime, err := event.OpenTime()
+		if err != nil {
+			continue
+		}
+		closeTime, err := event.CloseTime()
+		if err != nil || !closeTime.After(now) {
+			continue
+		}
+
+		// A reopened event whose ballot has been drawn is first come first served
+		mode := event.AllocationMode
+		if event.BallotDrawnAt != "" {
+			mode = database.AllocationFirstCome
+		}
+
+		selected = append(selected, listed{
+			start: start,
+			event: upcomingEvent{
+				EventID:        event.EventID,
+				EventLocation:  event.EventLocation,
+				EventDate:      event.EventDate,
+				MeetLocation:   event.MeetLocation,
+				MeetTime:       event.MeetTime,
+				TotalSeats:     event.TotalSeats,
+				SeatsRemaining: max(event.TotalSeats-event.SeatsTaken, 0),
+				RequireMember:  event.RequireMember,
+				OpenDatetime:   event.OpenDatetime,
+				CloseDatetime:  event.CloseDatetime,
+				Open:           !now.Before(openTime) && event.EventStatus != database.EventStatusCancelled,
+				AllocationMode: mode,
+				Link:           event.GetLink(),
+
+				Cancelled:          event.EventStatus == database.EventStatusCancelled,
+				CancellationReason: event.CancellationReason,
+			},
+		})
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return selected[i].start.Before(selected[j].start)
+	})
+
+	listing := make([]upcomingEvent, len(selected))
+	for i := range selected {
+		listing[i] = selected[i].event
+	}
+	return listing
+}
+
+func handleUpcomingEvents(c *gin.Context) {
+	upcomingCache.Lock()
+	defer upcomingCache.Unlock()
+
+	if upcomingCache.body == nil || time.Now().After(upcomingCache.expires) {
+		events, err := database.GetEvents(c.Request.Context(), database.EventQuery{Order: database.OrderByStart})
+		if err != nil {
+			msg := fmt.Sprintf("Failed to get events: %s", err)
+			logger.ErrorContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusInternalServerError)
+			return
+		}
+
+		body, err := json.Marshal(upcomingEvents(events, time.Now()))
+		if err != nil {
+			msg := fmt.Sprintf("Failed to encode events: %s", err)
+			logger.ErrorContext(c.Request.Context(), msg)
+			sendResponse(c, false, msg, http.StatusInternalServerError)
+			return
+		}
+
+		upcomingCache.body = body
+		upcomingCache.expires = time.Now().Add(upcomingCacheTTL)
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(upcomingCacheTTL.Seconds())))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", upcomingCache.body)
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readUpload returns the file sent to an import endpoint, either as a form upload named file
+// from the dashboard or as the raw request body, along with the uploaded file's name if it had
+// one. Anything larger than limit is rejected.
+func readUpload(c *gin.Context, limit int64) (io.ReadCloser, string, error) {
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return http.MaxBytesReader(c.Writer, c.Request.Body, limit), "", nil
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	if file.Size > limit {
+		return nil, "", fmt.Errorf("file is larger than %d bytes", limit)
+	}
+
+	upload, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	return upload, file.Filename, nil
+}
@@ -0,0 +1,227 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/live"
+	"github.com/gin-gonic/gin"
+)
+
+// bindVehicle reads and checks the vehicle in a request body
+func bindVehicle(c *gin.Context) (database.Vehicle, bool) {
+	var vehicle database.Vehicle
+	if err := c.ShouldBindJSON(&vehicle); err != nil {
+		msg := fmt.Sprintf("Invalid vehicle: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return vehicle, false
+	}
+
+	vehicle.Name = strings.TrimSpace(vehicle.Name)
+	vehicle.DriverName = strings.TrimSpace(vehicle.DriverName)
+	vehicle.DeparturePoint = strings.TrimSpace(vehicle.DeparturePoint)
+	vehicle.DriverEmail = strings.TrimSpace(vehicle.DriverEmail)
+
+	if err := vehicle.Validate(); err != nil {
+		logger.WarnContext(c.Request.Context(), "Invalid vehicle", "error", err)
+		sendResponse(c, false, err.Error(), http.StatusBadRequest)
+		return vehicle, false
+	}
+	if vehicle.DriverEmail != "" {
+		address, err := mail.ParseAddress(vehicle.DriverEmail)
+		if err != nil {
+			sendResponse(c, false, "Invalid driver email address", http.StatusBadRequest)
+			return vehicle, false
+		}
+		vehicle.DriverEmail = address.Address
+	}
+
+	return vehicle, true
+}
+
+// sendVehicleError replies with the status that fits a failed vehicle change
+func sendVehicleError(c *gin.Context, action string, err error) {
+	msg := fmt.Sprintf("Failed to %s: %s", action, err)
+	switch {
+	case errors.Is(err, database.ErrVehicleNotFound), errors.Is(err, database.ErrParticipantNotFound):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusNotFound)
+	case errors.Is(err, database.ErrVehicleFull), errors.Is(err, database.ErrNotEnoughSeats), errors.Is(err, database.ErrNotSeated):
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusConflict)
+	default:
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+	}
+}
+
+// vehiclesChanged gives any seats the vehicles added to the waitlist and lets everyone watching
+// the event know its seats changed
+func vehiclesChanged(ctx context.Context, eventID int) {
+	promoted, err := database.PromoteFromWaitlist(ctx, eventID, false)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to promote waitlisted participants", "event_id", eventID, "error", err)
+	}
+	for _, participant := range promoted {
+		logger.InfoContext(ctx, "Promoted participant from waitlist", "participant_id", participant.ParticipantID, "event_id", eventID)
+	}
+
+	invalidateUpcoming()
+	live.Publish(ctx, eventID, live.ChangeUpdated)
+}
+
+func handleGetVehicles(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+	if _, ok := eventByID(c, eventID); !ok {
+		return
+	}
+
+	vehicles, err := database.GetEventVehicles(c.Request.Context(), eventID)
+	if err != nil {
+		msg := fmt.Sprintf("Failed to get vehicles: %s", err)
+		logger.ErrorContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicles)
+}
+
+func handleAddVehicle(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+
+	event, ok := eventByID(c, eventID)
+	if !ok {
+		return
+	}
+
+	vehicle, ok := bindVehicle(c)
+	if !ok {
+		return
+	}
+	vehicle.EventID = eventID
+	if vehicle.DeparturePoint == "" {
+		vehicle.DeparturePoint = event.MeetLocation
+	}
+
+	vehicleID, err := database.AddVehicle(c.Request.Context(), vehicle)
+	if err != nil {
+		sendVehicleError(c, "add vehicle", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Added vehicle", "vehicle_id", vehicleID, "event_id", eventID, "capacity", vehicle.Capacity)
+	vehiclesChanged(c.Request.Context(), eventID)
+
+	sendResponse(c, true, "Vehicle added!", http.StatusOK)
+}
+
+func handleUpdateVehicle(c *gin.Context) {
+	vehicleID, ok := idParam(c, "vehicle")
+	if !ok {
+		return
+	}
+
+	existing, err := database.GetVehicleByID(c.Request.Context(), vehicleID)
+	if err != nil {
+		sendVehicleError(c, "update vehicle", err)
+		return
+	}
+
+	vehicle, ok := bindVehicle(c)
+	if !ok {
+		return
+	}
+	if vehicle.DeparturePoint == "" {
+		vehicle.DeparturePoint = existing.DeparturePoint
+	}
+
+	if err := database.UpdateVehicle(c.Request.Context(), vehicleID, vehicle); err != nil {
+		sendVehicleError(c, "update vehicle", err)
+		return
+	}
+
+	vehiclesChanged(c.Request.Context(), existing.EventID)
+
+	sendResponse(c, true, "Successfully updated vehicle", http.StatusOK)
+}
+
+func handleDeleteVehicle(c *gin.Context) {
+	vehicleID, ok := idParam(c, "vehicle")
+	if !ok {
+		return
+	}
+
+	vehicle, err := database.GetVehicleByID(c.Request.Context(), vehicleID)
+	if err != nil {
+		sendVehicleError(c, "delete vehicle", err)
+		return
+	}
+
+	if err := database.DeleteVehicle(c.Request.Context(), vehicleID); err != nil {
+		sendVehicleError(c, "delete vehicle", err)
+		return
+	}
+
+	vehiclesChanged(c.Request.Context(), vehicle.EventID)
+
+	sendResponse(c, true, "Successfully deleted vehicle", http.StatusOK)
+}
+
+// handleAutoAssignVehicles fills the vehicles on an event with everyone seated but not yet in one
+func handleAutoAssignVehicles(c *gin.Context) {
+	eventID, ok := idParam(c, "event")
+	if !ok {
+		return
+	}
+	if _, ok := eventByID(c, eventID); !ok {
+		return
+	}
+
+	assigned, err := database.AutoAssignVehicles(c.Request.Context(), eventID)
+	if err != nil {
+		sendVehicleError(c, "assign vehicles", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Assigned participants to vehicles", "event_id", eventID, "assigned", assigned)
+	sendResponse(c, true, fmt.Sprintf("Assigned %d participants to vehicles", assigned), http.StatusOK)
+}
+
+// handleAssignVehicle puts a participant in a vehicle by hand, or takes them out with vehicle 0
+func handleAssignVehicle(c *gin.Context) {
+	participantID, ok := idParam(c, "participant")
+	if !ok {
+		return
+	}
+
+	var assignment struct {
+		VehicleID int `json:"vehicle_id"`
+	}
+	if err := c.ShouldBindJSON(&assignment); err != nil {
+		msg := fmt.Sprintf("Invalid vehicle: %s", err)
+		logger.WarnContext(c.Request.Context(), msg)
+		sendResponse(c, false, msg, http.StatusBadRequest)
+		return
+	}
+
+	if err := database.AssignVehicle(c.Request.Context(), participantID, assignment.VehicleID); err != nil {
+		sendVehicleError(c, "assign vehicle", err)
+		return
+	}
+
+	logger.InfoContext(c.Request.Context(), "Assigned participant to vehicle", "participant_id", participantID, "vehicle_id", assignment.VehicleID)
+	sendResponse(c, true, "Vehicle updated", http.StatusOK)
+}
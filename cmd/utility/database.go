@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -46,7 +47,7 @@ func (u newUser) generateSecureHash() (string, error) {
 
 func addUserToDB(username string, hashedPassword string) error {
 	// Create DB connection
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+	db, err := sql.Open("sqlite", database.Path)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,96 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/eventimport"
+)
+
+type importEvents struct {
+	File   string `arg:"" type:"existingfile" help:"CSV or YAML schedule of events"`
+	DryRun bool   `help:"Check the schedule without creating any events"`
+	Admin  string `required:"" help:"Admin the events are recorded as created by, a different admin has to approve them"`
+}
+
+func (e *importEvents) Run() error {
+	format, err := eventimport.FormatFor(e.File, "")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(e.File)
+	if err != nil {
+		return fmt.Errorf("failed to open schedule: %v", err)
+	}
+	defer file.Close()
+
+	rows, err := eventimport.Parse(file, format)
+	if err != nil {
+		return fmt.Errorf("failed to parse schedule: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	report, err := eventimport.Import(ctx, rows, e.DryRun, e.Admin)
+	if err != nil {
+		return fmt.Errorf("failed to import events: %v", err)
+	}
+
+	for _, row := range report.Rows {
+		switch {
+		case len(row.Errors) > 0:
+			fmt.Printf("line %d: %s %s\n", row.Line, row.Location, row.Date)
+			for _, problem := range row.Errors {
+				fmt.Printf("    %s\n", problem)
+			}
+		case row.EventID != 0:
+			fmt.Printf("line %d: created event %d, %s %s\n", row.Line, row.EventID, row.Location, row.Date)
+		default:
+			fmt.Printf("line %d: ok, %s %s\n", row.Line, row.Location, row.Date)
+		}
+	}
+
+	if !report.Valid {
+		return fmt.Errorf("schedule has errors, no events were created")
+	}
+	if report.DryRun {
+		fmt.Printf("Schedule is valid, %d events would be created\n", len(report.Rows))
+		return nil
+	}
+
+	// Events are created as drafts, the server schedules their signups once they're approved
+	fmt.Printf("Created %d draft events, approve them on the dashboard to schedule their signups\n", report.Created)
+	return nil
+}
+
+type checkEventTimes struct{}
+
+// Run migrates the database and lists the events whose date or meet time couldn't be read, which
+// need correcting on the dashboard before they show in calendars or get reminders
+func (e *checkEventTimes) Run() error {
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	unreadable, err := database.GetUnreadableEventTimes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get events: %v", err)
+	}
+
+	for _, event := range unreadable {
+		fmt.Printf("event %d: date %q, meet time %q\n", event.EventID, event.EventDate, event.MeetTime)
+	}
+	if len(unreadable) > 0 {
+		return fmt.Errorf("%d events have a date or meet time that can't be read, use dd/mm/yyyy and hh:mm", len(unreadable))
+	}
+
+	fmt.Println("Every event's session times were read")
+	return nil
+}
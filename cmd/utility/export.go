@@ -0,0 +1,94 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/export"
+)
+
+type exportData struct {
+	Participants exportParticipants `cmd:"" help:"Export everyone registered for an event"`
+	Events       exportEvents       `cmd:"" help:"Export all events, optionally within a date range"`
+}
+
+type exportParticipants struct {
+	Event  int    `required:"" short:"e" help:"ID of the event to export"`
+	Format string `default:"csv" enum:"csv,xlsx" short:"f" help:"File format to export"`
+	Output string `short:"o" help:"File to write, defaults to event-<id>-participants.<format>"`
+}
+
+func (e *exportParticipants) Run() error {
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	event, err := database.GetEventByID(ctx, e.Event)
+	if err != nil {
+		return fmt.Errorf("failed to get event: %v", err)
+	}
+
+	participants, err := event.GetParticipants(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get event participants: %v", err)
+	}
+
+	output := e.Output
+	if output == "" {
+		output = fmt.Sprintf("event-%d-participants.%s", e.Event, e.Format)
+	}
+
+	return writeExport(export.ParticipantsTable(*event, participants), export.Format(e.Format), output)
+}
+
+type exportEvents struct {
+	From   string `help:"Only export events on or after this date (YYYY-MM-DD)"`
+	To     string `help:"Only export events on or before this date (YYYY-MM-DD)"`
+	Format string `default:"csv" enum:"csv,xlsx" short:"f" help:"File format to export"`
+	Output string `short:"o" help:"File to write, defaults to events.<format>"`
+}
+
+func (e *exportEvents) Run() error {
+	from, to, err := export.ParseDateRange(e.From, e.To)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	events, err := database.GetEvents(ctx, database.EventQuery{})
+	if err != nil {
+		return fmt.Errorf("failed to get events: %v", err)
+	}
+
+	output := e.Output
+	if output == "" {
+		output = "events." + e.Format
+	}
+
+	return writeExport(export.EventsTable(export.EventsBetween(events, from, to)), export.Format(e.Format), output)
+}
+
+func writeExport(table export.Table, format export.Format, output string) error {
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %v", err)
+	}
+	defer file.Close()
+
+	if err := table.Write(file, format); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write export: %v", err)
+	}
+
+	fmt.Printf("Exported %d rows to %s\n", len(table.Rows), output)
+	return nil
+}
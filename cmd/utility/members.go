@@ -0,0 +1,39 @@
+package utility
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/roster"
+)
+
+type importMembers struct {
+	File string `arg:"" type:"existingfile" help:"Membership CSV exported from the students' union"`
+}
+
+func (m *importMembers) Run() error {
+	file, err := os.Open(m.File)
+	if err != nil {
+		return fmt.Errorf("failed to open roster: %v", err)
+	}
+	defer file.Close()
+
+	members, err := roster.Parse(file)
+	if err != nil {
+		return fmt.Errorf("failed to parse roster: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		return fmt.Errorf("failed to migrate database: %v", err)
+	}
+
+	if err := database.ReplaceMembers(ctx, members); err != nil {
+		return fmt.Errorf("failed to import members: %v", err)
+	}
+
+	fmt.Printf("Imported %d members\n", len(members))
+	return nil
+}
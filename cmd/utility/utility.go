@@ -1,5 +1,9 @@
 package utility
 
 type Utility struct {
-	NewUser newUser `cmd:"" help:"Create a new admin user"`
+	NewUser         newUser         `cmd:"" help:"Create a new admin user"`
+	ImportMembers   importMembers   `cmd:"" help:"Replace the membership roster with a students' union CSV export"`
+	Export          exportData      `cmd:"" help:"Export participants or events as CSV or XLSX"`
+	ImportEvents    importEvents    `cmd:"" help:"Create events from a CSV or YAML schedule"`
+	CheckEventTimes checkEventTimes `cmd:"" help:"List events whose date or meet time can't be read"`
 }
@@ -0,0 +1,84 @@
+package allocation
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"sort"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+type BallotEntry struct {
+	Participant database.Participant
+	Weight      float64
+}
+
+// NewSeed returns a random seed for an event's ballot. The seed is stored with the event so the
+// draw can be reproduced later.
+func NewSeed() (int64, error) {
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return 0, fmt.Errorf("failed to generate ballot seed: %v", err)
+	}
+	return int64(binary.BigEndian.Uint64(buffer) >> 1), nil
+}
+
+// BallotWeight gives an entry its chance in a weighted draw: everyone starts at 1, with extra
+// weight for members and for each past session attended up to BallotAttendanceCap
+func (p Policy) BallotWeight(participant database.Participant, history *database.AttendanceHistory) float64 {
+	weight := 1.0
+	if participant.Member {
+		weight += p.BallotMemberWeight
+	}
+	if history != nil {
+		attended := history.Attended
+		if attended > p.BallotAttendanceCap {
+			attended = p.BallotAttendanceCap
+		}
+		weight += p.BallotAttendanceWeight * float64(attended)
+	}
+	return weight
+}
+
+// Draw runs a seeded weighted draw without replacement. The same entries and seed always give the
+// same result. Entries in a no-show cooldown are drawn after everyone else. Seats is how many are
+// still free, the first that many drawn are seated.
+func Draw(entries []BallotEntry, seats int, seed int64) []database.BallotResult {
+	sorted := make([]BallotEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Participant.ParticipantID < sorted[j].Participant.ParticipantID
+	})
+
+	// Efraimidis-Spirakis: each entry gets the key u^(1/weight) and the highest keys win
+	rng := mathrand.New(mathrand.NewSource(seed))
+	keys := make(map[int]float64, len(sorted))
+	for _, entry := range sorted {
+		weight := entry.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		keys[entry.Participant.ParticipantID] = math.Pow(rng.Float64(), 1/weight)
+	}
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Participant, sorted[j].Participant
+		if a.Cooldown != b.Cooldown {
+			return !a.Cooldown
+		}
+		return keys[a.ParticipantID] > keys[b.ParticipantID]
+	})
+
+	results := make([]database.BallotResult, len(sorted))
+	for i, entry := range sorted {
+		results[i] = database.BallotResult{
+			ParticipantID: entry.Participant.ParticipantID,
+			Rank:          i + 1,
+			Seated:        i < seats,
+		}
+	}
+	return results
+}
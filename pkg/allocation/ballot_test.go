@@ -0,0 +1,104 @@
+package allocation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+func ballotEntries(n int) []BallotEntry {
+	entries := make([]BallotEntry, n)
+	for i := range entries {
+		entries[i] = BallotEntry{
+			Participant: database.Participant{ParticipantID: i + 1},
+			Weight:      1 + float64(i%3),
+		}
+	}
+	return entries
+}
+
+func TestDrawIsDeterministic(t *testing.T) {
+	entries := ballotEntries(20)
+	first := Draw(entries, 8, 42)
+
+	// The order entries are given in mustn't change the draw
+	reversed := make([]BallotEntry, len(entries))
+	for i, entry := range entries {
+		reversed[len(entries)-1-i] = entry
+	}
+
+	for i := 0; i < 5; i++ {
+		if again := Draw(entries, 8, 42); !reflect.DeepEqual(first, again) {
+			t.Fatalf("draw %d differs from the first:\n%v\n%v", i, first, again)
+		}
+	}
+	if again := Draw(reversed, 8, 42); !reflect.DeepEqual(first, again) {
+		t.Fatalf("draw of reversed entries differs:\n%v\n%v", first, again)
+	}
+
+	if other := Draw(entries, 8, 43); reflect.DeepEqual(first, other) {
+		t.Errorf("a different seed gave the same draw")
+	}
+}
+
+func TestDrawSeats(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		seats   int
+		seated  int
+	}{
+		{name: "more entries than seats", entries: 10, seats: 4, seated: 4},
+		{name: "fewer entries than seats", entries: 3, seats: 4, seated: 3},
+		{name: "no seats free", entries: 5, seats: 0, seated: 0},
+		{name: "no entries", entries: 0, seats: 4, seated: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := Draw(ballotEntries(test.entries), test.seats, 7)
+			if len(results) != test.entries {
+				t.Fatalf("got %d results, want %d", len(results), test.entries)
+			}
+
+			seated := 0
+			seen := map[int]bool{}
+			for i, result := range results {
+				if result.Rank != i+1 {
+					t.Errorf("result %d has rank %d", i, result.Rank)
+				}
+				if result.Seated {
+					seated++
+					if i >= test.seats {
+						t.Errorf("rank %d seated with only %d seats", result.Rank, test.seats)
+					}
+				}
+				if seen[result.ParticipantID] {
+					t.Errorf("participant %d drawn twice", result.ParticipantID)
+				}
+				seen[result.ParticipantID] = true
+			}
+			if seated != test.seated {
+				t.Errorf("seated %d, want %d", seated, test.seated)
+			}
+		})
+	}
+}
+
+func TestDrawCooldownLast(t *testing.T) {
+	entries := ballotEntries(10)
+	entries[0].Participant.Cooldown = true
+	entries[1].Participant.Cooldown = true
+	entries[0].Weight = 100
+	entries[1].Weight = 100
+
+	for seed := int64(0); seed < 20; seed++ {
+		results := Draw(entries, 5, seed)
+		for _, result := range results[:8] {
+			if result.ParticipantID == 1 || result.ParticipantID == 2 {
+				t.Fatalf("seed %d: entry in cooldown drawn at rank %d", seed, result.Rank)
+			}
+		}
+	}
+}
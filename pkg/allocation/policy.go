@@ -0,0 +1,187 @@
+package allocation
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+type CooldownMode string
+
+const (
+	// CooldownOff only lowers the priority of people with recent no-shows
+	CooldownOff CooldownMode = "off"
+	// CooldownWaitlist holds people with too many recent no-shows on the waitlist until signups close
+	CooldownWaitlist CooldownMode = "waitlist"
+	// CooldownBlock refuses registrations from people with too many recent no-shows
+	CooldownBlock CooldownMode = "block"
+)
+
+// Policy decides how seats are shared out, penalising recent no-shows and favouring people who
+// missed out on a seat last time
+type Policy struct {
+	NoShowLimit     int
+	NoShowWindow    time.Duration
+	Cooldown        CooldownMode
+	NoShowPenalty   int
+	WaitlistedBonus int
+
+	// Extra weight in weighted ballots
+	BallotMemberWeight     float64
+	BallotAttendanceWeight float64
+	BallotAttendanceCap    int
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		NoShowLimit:     2,
+		NoShowWindow:    time.Hour * 24 * 60,
+		Cooldown:        CooldownWaitlist,
+		NoShowPenalty:   5,
+		WaitlistedBonus: 10,
+
+		BallotMemberWeight:     1,
+		BallotAttendanceWeight: 0.25,
+		BallotAttendanceCap:    4,
+	}
+}
+
+// LoadPolicy reads the policy from the environment, using the defaults for anything not set
+func LoadPolicy() (Policy, error) {
+	policy := DefaultPolicy()
+
+	if err := envInt("NO_SHOW_LIMIT", &policy.NoShowLimit); err != nil {
+		return policy, err
+	}
+
+	windowDays := int(policy.NoShowWindow / (time.Hour * 24))
+	if err := envInt("NO_SHOW_WINDOW_DAYS", &windowDays); err != nil {
+		return policy, err
+	}
+	policy.NoShowWindow = time.Hour * 24 * time.Duration(windowDays)
+
+	if err := envInt("NO_SHOW_PRIORITY_PENALTY", &policy.NoShowPenalty); err != nil {
+		return policy, err
+	}
+	if err := envInt("WAITLISTED_PRIORITY_BONUS", &policy.WaitlistedBonus); err != nil {
+		return policy, err
+	}
+
+	if err := envFloat("BALLOT_MEMBER_WEIGHT", &policy.BallotMemberWeight); err != nil {
+		return policy, err
+	}
+	if err := envFloat("BALLOT_ATTENDANCE_WEIGHT", &policy.BallotAttendanceWeight); err != nil {
+		return policy, err
+	}
+	if err := envInt("BALLOT_ATTENDANCE_CAP", &policy.BallotAttendanceCap); err != nil {
+		return policy, err
+	}
+
+	if value := os.Getenv("NO_SHOW_COOLDOWN"); value != "" {
+		switch mode := CooldownMode(strings.ToLower(value)); mode {
+		case CooldownOff, CooldownWaitlist, CooldownBlock:
+			policy.Cooldown = mode
+		default:
+			return policy, fmt.Errorf("invalid NO_SHOW_COOLDOWN %q, expected off, waitlist or block", value)
+		}
+	}
+
+	return policy, nil
+}
+
+func envInt(name string, target *int) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envFloat(name string, target *float64) error {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+type Decision struct {
+	database.Allocation
+	Blocked            bool     `json:"blocked"`
+	RecentNoShows      int      `json:"recent_no_shows"`
+	TurnedAwayLastTime bool     `json:"turned_away_last_time"`
+	Reasons            []string `json:"reasons"`
+}
+
+// Evaluate applies the policy to a person's history of past registrations
+func (p Policy) Evaluate(history *database.AttendanceHistory, now time.Time) Decision {
+	decision := Decision{Reasons: []string{}}
+	foundLastEvent := false
+
+	for _, record := range history.Records {
+		// Events still taking signups or cancelled say nothing about how someone behaves
+		if !record.EventStatus.SignupsClosed() {
+			continue
+		}
+
+		// Records are newest first, so the first closed event is the last time they signed up
+		if !foundLastEvent {
+			foundLastEvent = true
+			decision.TurnedAwayLastTime = record.SeatStatus == database.SeatWaitlisted
+		}
+
+		if record.Attendance != database.AttendanceNoShow {
+			continue
+		}
+
+		// A close date that can't be read can't show the no-show was recent, so it isn't held
+		// against them
+		closeTime, err := time.ParseInLocation(database.DatetimeFormat, record.CloseDatetime, time.Local)
+		if err != nil {
+			continue
+		}
+		if now.Sub(closeTime) <= p.NoShowWindow {
+			decision.RecentNoShows++
+		}
+	}
+
+	if decision.TurnedAwayLastTime && p.WaitlistedBonus != 0 {
+		decision.Priority += p.WaitlistedBonus
+		decision.Reasons = append(decision.Reasons, "missed out on a seat last time")
+	}
+
+	if decision.RecentNoShows > 0 && p.NoShowPenalty != 0 {
+		decision.Priority -= p.NoShowPenalty * decision.RecentNoShows
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("%d recent no-show(s)", decision.RecentNoShows))
+	}
+
+	if p.NoShowLimit > 0 && decision.RecentNoShows >= p.NoShowLimit {
+		switch p.Cooldown {
+		case CooldownWaitlist:
+			decision.Cooldown = true
+			decision.Reasons = append(decision.Reasons, "in no-show cooldown, seats offered when signups close")
+		case CooldownBlock:
+			decision.Blocked = true
+			decision.Reasons = append(decision.Reasons, "in no-show cooldown, registration refused")
+		}
+	}
+
+	decision.Reason = strings.Join(decision.Reasons, "; ")
+	return decision
+}
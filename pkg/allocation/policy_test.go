@@ -0,0 +1,85 @@
+package allocation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2027, 3, 10, 12, 0, 0, 0, time.Local)
+
+	// record is a registration for an event that closed days before now
+	record := func(status database.EventStatus, seat database.SeatStatus, attendance database.AttendanceStatus, days int) database.AttendanceRecord {
+		return database.AttendanceRecord{
+			EventStatus:   status,
+			SeatStatus:    seat,
+			Attendance:    attendance,
+			CloseDatetime: now.AddDate(0, 0, -days).Format(database.DatetimeFormat),
+		}
+	}
+	noShow := func(days int) database.AttendanceRecord {
+		return record(database.EventStatusCompleted, database.SeatConfirmed, database.AttendanceNoShow, days)
+	}
+	attended := record(database.EventStatusCompleted, database.SeatConfirmed, database.AttendanceAttended, 3)
+	turnedAway := record(database.EventStatusClosed, database.SeatWaitlisted, database.AttendanceUnknown, 3)
+
+	tests := []struct {
+		name       string
+		cooldown   CooldownMode
+		records    []database.AttendanceRecord
+		priority   int
+		inCooldown bool
+		blocked    bool
+	}{
+		{name: "no history", cooldown: CooldownWaitlist},
+		{name: "attended", cooldown: CooldownWaitlist, records: []database.AttendanceRecord{attended}},
+		{name: "turned away last time", cooldown: CooldownWaitlist, records: []database.AttendanceRecord{turnedAway, attended}, priority: 10},
+		{name: "turned away before last time", cooldown: CooldownWaitlist, records: []database.AttendanceRecord{attended, turnedAway}},
+		{name: "one no-show", cooldown: CooldownWaitlist, records: []database.AttendanceRecord{noShow(5)}, priority: -5},
+		{name: "no-shows with cooldown off", cooldown: CooldownOff, records: []database.AttendanceRecord{noShow(5), noShow(20)}, priority: -10},
+		{name: "no-shows with waitlist cooldown", cooldown: CooldownWaitlist, records: []database.AttendanceRecord{noShow(5), noShow(20)}, priority: -10, inCooldown: true},
+		{name: "no-shows with block cooldown", cooldown: CooldownBlock, records: []database.AttendanceRecord{noShow(5), noShow(20)}, priority: -10, blocked: true},
+		{name: "no-show outside the window", cooldown: CooldownBlock, records: []database.AttendanceRecord{noShow(5), noShow(90)}, priority: -5},
+		{
+			name:     "no-show with an unreadable close date",
+			cooldown: CooldownBlock,
+			records: []database.AttendanceRecord{
+				noShow(5),
+				{EventStatus: database.EventStatusCompleted, Attendance: database.AttendanceNoShow, CloseDatetime: "soon"},
+			},
+			priority: -5,
+		},
+		{
+			name:     "events still open or cancelled",
+			cooldown: CooldownBlock,
+			records: []database.AttendanceRecord{
+				record(database.EventStatusOpen, database.SeatWaitlisted, database.AttendanceNoShow, 1),
+				record(database.EventStatusCancelled, database.SeatConfirmed, database.AttendanceNoShow, 2),
+				attended,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := DefaultPolicy()
+			policy.Cooldown = test.cooldown
+
+			decision := policy.Evaluate(&database.AttendanceHistory{Records: test.records}, now)
+			if decision.Priority != test.priority {
+				t.Errorf("priority = %d, want %d", decision.Priority, test.priority)
+			}
+			if decision.Cooldown != test.inCooldown {
+				t.Errorf("cooldown = %t, want %t", decision.Cooldown, test.inCooldown)
+			}
+			if decision.Blocked != test.blocked {
+				t.Errorf("blocked = %t, want %t", decision.Blocked, test.blocked)
+			}
+			if (decision.Reason == "") != (len(decision.Reasons) == 0) {
+				t.Errorf("reason %q doesn't match reasons %v", decision.Reason, decision.Reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+type SeatStatus int
+
+const (
+	SeatConfirmed SeatStatus = iota
+	SeatWaitlisted
+	// SeatBallot is an entry into a ballot that has not been drawn yet
+	SeatBallot
+	// SeatDriver is someone driving to the event, who doesn't take a passenger seat
+	SeatDriver
+)
+
+var seatStatusNames = map[SeatStatus]string{
+	SeatConfirmed:  "confirmed",
+	SeatWaitlisted: "waitlisted",
+	SeatBallot:     "ballot",
+	SeatDriver:     "driver",
+}
+
+func (s SeatStatus) String() string {
+	if name, ok := seatStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("SeatStatus(%d)", int(s))
+}
+
+func (s SeatStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *SeatStatus) UnmarshalText(text []byte) error {
+	for status, name := range seatStatusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown seat status %q", string(text))
+}
+
+// Values lists the names a SeatStatus can be sent as
+func (SeatStatus) Values() []string {
+	return enumValues(seatStatusNames)
+}
+
+// Allocation is the outcome of the allocation policy for a registration
+type Allocation struct {
+	Priority int    `json:"priority"`
+	Reason   string `json:"reason"`
+	Cooldown bool   `json:"cooldown"`
+}
+
+// Seated participants first, then the waitlist by priority and then by who registered first
+const participantOrder = "seat_status ASC, priority DESC, participant_id ASC"
+
+// PromoteFromWaitlist gives any free seats on an event to the highest priority waitlisted
+// participants. Those in a cooldown are only considered when includeCooldown is set.
+func PromoteFromWaitlist(ctx context.Context, eventID int, includeCooldown bool) ([]Participant, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var seatsFree int
+	err = tx.QueryRowContext(ctx, "SELECT total_seats - seats_taken FROM events WHERE event_id = ?", eventID).Scan(&seatsFree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if seatsFree <= 0 {
+		return nil, nil
+	}
+
+	query := "SELECT " + participantColumns + " FROM participants WHERE event_id = ? AND seat_status = ?"
+	if !includeCooldown {
+		query += " AND cooldown = 0"
+	}
+	query += " ORDER BY " + participantOrder + " LIMIT ?"
+
+	rows, err := tx.QueryContext(ctx, query, eventID, SeatWaitlisted, seatsFree)
+	if err != nil {
+		return nil, err
+	}
+
+	var promoted []Participant
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, participant)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range promoted {
+		promoted[i].SeatStatus = SeatConfirmed
+		_, err = tx.ExecContext(ctx, "UPDATE participants SET seat_status = ? WHERE participant_id = ?", SeatConfirmed, promoted[i].ParticipantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE events SET seats_taken = seats_taken + ? WHERE event_id = ?", len(promoted), eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return promoted, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// registerTestParticipants adds an event with two seats and registers people for it in order,
+// returning the event and each participant's ID by first name
+func registerTestParticipants(t *testing.T, ctx context.Context, registrations map[string]Allocation, order ...string) (*Event, map[string]int) {
+	t.Helper()
+
+	eventID, err := CreateEvent(ctx, Event{EventLocation: "Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00", TotalSeats: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := GetEventByID(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]int{}
+	for _, name := range order {
+		registrant := Registrant{FirstName: name, LastName: "Climber", Email: name + "@example.com"}
+		participant, err := event.AddParticipant(ctx, registrant, registrations[name])
+		if err != nil {
+			t.Fatalf("failed to register %s: %v", name, err)
+		}
+		ids[name] = participant.ParticipantID
+	}
+	return event, ids
+}
+
+func promotedNames(participants []Participant) []string {
+	names := []string{}
+	for _, participant := range participants {
+		names = append(names, participant.FirstName)
+	}
+	return names
+}
+
+func TestPromoteFromWaitlist(t *testing.T) {
+	ctx := useTestDatabase(t)
+
+	// Ann and Ben get the seats. Dee registered after Cal but is a higher priority, and Eve is
+	// higher still but in a cooldown
+	event, ids := registerTestParticipants(t, ctx, map[string]Allocation{
+		"Dee": {Priority: 5},
+		"Eve": {Priority: 20, Cooldown: true},
+	}, "Ann", "Ben", "Cal", "Dee", "Eve")
+
+	steps := []struct {
+		name   string
+		delete string
+		want   []string
+		seats  int
+	}{
+		{name: "waitlisted leaving frees nothing", delete: "Cal", want: []string{}, seats: 2},
+		{name: "highest priority first", delete: "Ann", want: []string{"Dee"}, seats: 2},
+		{name: "cooldown skipped", delete: "Ben", want: []string{}, seats: 1},
+	}
+	for _, step := range steps {
+		promoted, err := DeleteParticipant(ctx, ids[step.delete])
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got := promotedNames(promoted); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: promoted %v, want %v", step.name, got, step.want)
+		}
+
+		event, err := GetEventByID(ctx, event.EventID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.SeatsTaken != step.seats {
+			t.Errorf("%s: %d seats taken, want %d", step.name, event.SeatsTaken, step.seats)
+		}
+	}
+
+	// Those in a cooldown get what's left once signups close
+	promoted, err := PromoteFromWaitlist(ctx, event.EventID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := promotedNames(promoted); !reflect.DeepEqual(got, []string{"Eve"}) {
+		t.Errorf("promoted %v when including cooldowns, want [Eve]", got)
+	}
+
+	participant, err := GetParticipantByID(ctx, ids["Eve"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if participant.SeatStatus != SeatConfirmed {
+		t.Errorf("Eve's seat is %s, want confirmed", participant.SeatStatus)
+	}
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+type AttendanceStatus int
+
+var ErrAttendanceNotSeated = errors.New("attendance can only be recorded for participants with a seat")
+
+const (
+	AttendanceUnknown AttendanceStatus = iota
+	AttendanceAttended
+	AttendanceNoShow
+)
+
+var attendanceNames = map[AttendanceStatus]string{
+	AttendanceUnknown:  "unknown",
+	AttendanceAttended: "attended",
+	AttendanceNoShow:   "no_show",
+}
+
+func (a AttendanceStatus) String() string {
+	if name, ok := attendanceNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AttendanceStatus(%d)", int(a))
+}
+
+func (a AttendanceStatus) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *AttendanceStatus) UnmarshalText(text []byte) error {
+	for status, name := range attendanceNames {
+		if name == string(text) {
+			*a = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown attendance status %q", string(text))
+}
+
+// Values lists the names an AttendanceStatus can be sent as
+func (AttendanceStatus) Values() []string {
+	return enumValues(attendanceNames)
+}
+
+// SetParticipantAttendance records whether a participant turned up. Only those with a seat can be
+// marked, so nobody on the waitlist gets a no-show counted against them, but anyone can be reset
+// to unknown.
+func SetParticipantAttendance(ctx context.Context, participantID int, attendance AttendanceStatus) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var seatStatus SeatStatus
+	err = db.QueryRowContext(ctx, "SELECT seat_status FROM participants WHERE participant_id = ?", participantID).Scan(&seatStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrParticipantNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if attendance != AttendanceUnknown && seatStatus != SeatConfirmed && seatStatus != SeatDriver {
+		return ErrAttendanceNotSeated
+	}
+
+	query := "UPDATE participants SET attendance = ?, attendance_updated_at = ? WHERE participant_id = ?"
+	if _, err := db.ExecContext(ctx, query, attendance, time.Now().Format(time.RFC3339), participantID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return nil
+}
+
+type AttendanceRecord struct {
+	ParticipantID int              `json:"participant_id"`
+	EventID       int              `json:"event_id"`
+	EventLocation string           `json:"session_location"`
+	EventDate     string           `json:"session_date"`
+	CloseDatetime string           `json:"close_date"`
+	EventStatus   EventStatus      `json:"event_status"`
+	SeatStatus    SeatStatus       `json:"seat_status"`
+	Attendance    AttendanceStatus `json:"attendance"`
+}
+
+type AttendanceHistory struct {
+	PersonID  int                `json:"person_id"`
+	FirstName string             `json:"first_name"`
+	LastName  string             `json:"last_name"`
+	Attended  int                `json:"attended"`
+	NoShows   int                `json:"no_shows"`
+	Records   []AttendanceRecord `json:"records"`
+}
+
+// GetAttendanceHistory returns every event a person has registered for, most recent
+// registration first
+func GetAttendanceHistory(ctx context.Context, personID int) (*AttendanceHistory, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	person, err := scanPerson(db.QueryRowContext(ctx, "SELECT "+personColumns+" FROM people WHERE person_id = ?", personID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT p.participant_id, e.event_id, e.event_location, e.event_date, e.close_datetime, e.event_status, p.seat_status, p.attendance
+		FROM participants p
+		JOIN events e ON e.event_id = p.event_id
+		WHERE p.person_id = ?
+		ORDER BY p.participant_id DESC
+	`
+	rows, err := db.QueryContext(ctx, query, personID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := AttendanceHistory{
+		PersonID:  person.PersonID,
+		FirstName: person.FirstName,
+		LastName:  person.LastName,
+		Records:   []AttendanceRecord{},
+	}
+	for rows.Next() {
+		var record AttendanceRecord
+		if err := rows.Scan(
+			&record.ParticipantID,
+			&record.EventID,
+			&record.EventLocation,
+			&record.EventDate,
+			&record.CloseDatetime,
+			&record.EventStatus,
+			&record.SeatStatus,
+			&record.Attendance,
+		); err != nil {
+			return nil, err
+		}
+
+		switch record.Attendance {
+		case AttendanceAttended:
+			history.Attended++
+		case AttendanceNoShow:
+			history.NoShows++
+		}
+		history.Records = append(history.Records, record)
+	}
+
+	return &history, rows.Err()
+}
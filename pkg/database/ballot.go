@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+type AllocationMode string
+
+const (
+	// AllocationFirstCome gives seats to whoever registers first
+	AllocationFirstCome AllocationMode = "fcfs"
+	// AllocationBallot collects entries while signups are open and draws them when they close
+	AllocationBallot AllocationMode = "ballot"
+)
+
+func (m AllocationMode) Valid() bool {
+	return m == AllocationFirstCome || m == AllocationBallot
+}
+
+// Values lists the allocation modes an event can use
+func (AllocationMode) Values() []string {
+	return []string{string(AllocationFirstCome), string(AllocationBallot)}
+}
+
+var ErrBallotAlreadyDrawn = errors.New("ballot has already been drawn")
+
+// BallotResult is where a ballot entry ended up in the draw, rank 1 being drawn first
+type BallotResult struct {
+	ParticipantID int
+	Rank          int
+	Seated        bool
+}
+
+// RecordBallotDraw stores the outcome of an event's ballot, seating the winners and waitlisting
+// everyone else in draw order. A ballot can only be recorded once.
+func RecordBallotDraw(ctx context.Context, eventID int, results []BallotResult) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE events SET ballot_drawn_at = ? WHERE event_id = ? AND ballot_drawn_at = ''", time.Now().Format(time.RFC3339), eventID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrBallotAlreadyDrawn
+	}
+
+	seated := 0
+	for _, result := range results {
+		status := SeatWaitlisted
+		if result.Seated {
+			status = SeatConfirmed
+			seated++
+		}
+
+		// Later draws get a lower priority so the waitlist is promoted in draw order
+		query := "UPDATE participants SET seat_status = ?, priority = ?, allocation_reason = ? WHERE participant_id = ? AND event_id = ?"
+		_, err = tx.ExecContext(ctx, query, status, len(results)-result.Rank, fmt.Sprintf("ballot draw #%d", result.Rank), result.ParticipantID, eventID)
+		if err != nil {
+			return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE events SET seats_taken = seats_taken + ? WHERE event_id = ?", seated, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// MarkOutcomeNotified records that a participant has been told whether they got a seat
+func MarkOutcomeNotified(ctx context.Context, participantID int) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "UPDATE participants SET outcome_notified = 1 WHERE participant_id = ?", participantID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return nil
+}
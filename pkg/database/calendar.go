@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// CalendarToken returns the secret token for a person's private calendar feed, creating one the
+// first time it is asked for
+func CalendarToken(ctx context.Context, personID int) (string, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var token string
+	err = db.QueryRowContext(ctx, "SELECT calendar_token FROM people WHERE person_id = ?", personID).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrPersonNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("failed to generate calendar token: %v", err)
+	}
+	token = hex.EncodeToString(buffer)
+
+	// Only set the token if another request hasn't just done so, then read back whichever won
+	if _, err := db.ExecContext(ctx, "UPDATE people SET calendar_token = ? WHERE person_id = ? AND calendar_token = ''", token, personID); err != nil {
+		return "", fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT calendar_token FROM people WHERE person_id = ?", personID).Scan(&token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetCalendarEvents returns the events the person with a calendar token has a seat on or is driving to
+func GetCalendarEvents(ctx context.Context, token string) ([]Event, error) {
+	if token == "" {
+		return nil, ErrPersonNotFound
+	}
+
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var personID int
+	err = db.QueryRowContext(ctx, "SELECT person_id FROM people WHERE calendar_token = ?", token).Scan(&personID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + eventColumns + ` FROM events
+		WHERE deleted_at = '' AND event_id IN (SELECT event_id FROM participants WHERE person_id = ? AND seat_status IN (?, ?))
+	`
+	rows, err := db.QueryContext(ctx, query, personID, SeatConfirmed, SeatDriver)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+var (
+	ErrNotQualifiedDriver = errors.New("only drivers approved by the committee can offer a vehicle")
+	ErrDuplicateOffer     = errors.New("you have already offered to drive to this event")
+	ErrOfferNotFound      = errors.New("driver offer not found")
+	ErrOfferDecided       = errors.New("driver offer has already been decided")
+)
+
+type OfferStatus int
+
+const (
+	OfferPending OfferStatus = iota
+	OfferApproved
+	OfferDeclined
+	// OfferWithdrawn is an approved offer whose vehicle the committee has since removed
+	OfferWithdrawn
+)
+
+var offerStatusNames = map[OfferStatus]string{
+	OfferPending:   "pending",
+	OfferApproved:  "approved",
+	OfferDeclined:  "declined",
+	OfferWithdrawn: "withdrawn",
+}
+
+func (s OfferStatus) String() string {
+	if name, ok := offerStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("OfferStatus(%d)", int(s))
+}
+
+func (s OfferStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *OfferStatus) UnmarshalText(text []byte) error {
+	for status, name := range offerStatusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown offer status %q", string(text))
+}
+
+// Values lists the names an OfferStatus can be sent as
+func (OfferStatus) Values() []string {
+	return enumValues(offerStatusNames)
+}
+
+// DriverOffer is a qualified driver offering to take their own vehicle to an event. Once the
+// committee approves it the vehicle is added to the event.
+type DriverOffer struct {
+	OfferID        int         `db:"offer_id" json:"offer_id"`
+	EventID        int         `db:"event_id" json:"event_id"`
+	PersonID       int         `db:"person_id" json:"person_id"`
+	FirstName      string      `db:"first_name" json:"first_name"`
+	LastName       string      `db:"surname" json:"last_name"`
+	Email          string      `db:"email" json:"email"`
+	VehicleName    string      `db:"vehicle_name" json:"vehicle_name"`
+	Capacity       int         `db:"capacity" json:"capacity"`
+	DeparturePoint string      `db:"departure_point" json:"departure_point"`
+	Status         OfferStatus `db:"status" json:"status"`
+	VehicleID      int         `db:"vehicle_id" json:"vehicle_id"`
+	OfferedAt      string      `db:"offered_at" json:"offered_at"`
+	DecidedAt      string      `db:"decided_at" json:"decided_at"`
+}
+
+const driverOfferColumns = "offer_id, event_id, person_id, first_name, surname, email, vehicle_name, capacity, departure_point, status, vehicle_id, offered_at, decided_at"
+
+func scanDriverOffer(row rowScanner) (DriverOffer, error) {
+	var offer DriverOffer
+	err := row.Scan(
+		&offer.OfferID,
+		&offer.EventID,
+		&offer.PersonID,
+		&offer.FirstName,
+		&offer.LastName,
+		&offer.Email,
+		&offer.VehicleName,
+		&offer.Capacity,
+		&offer.DeparturePoint,
+		&offer.Status,
+		&offer.VehicleID,
+		&offer.OfferedAt,
+		&offer.DecidedAt,
+	)
+	return offer, err
+}
+
+// OfferToDrive records a driver's offer of a vehicle for the committee to approve. The driver
+// must be a person the committee has marked as qualified to drive.
+func OfferToDrive(ctx context.Context, registrant Registrant, offer DriverOffer) (*DriverOffer, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	personID, err := findPerson(ctx, tx, registrant)
+	if errors.Is(err, ErrPersonNotFound) {
+		return nil, ErrNotQualifiedDriver
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find person: %v", err)
+	}
+
+	var qualified bool
+	if err := tx.QueryRowContext(ctx, "SELECT qualified_driver FROM people WHERE person_id = ?", personID).Scan(&qualified); err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if !qualified {
+		return nil, ErrNotQualifiedDriver
+	}
+
+	var count int
+	query := "SELECT COUNT(*) FROM driver_offers WHERE event_id = ? AND person_id = ? AND status IN (?, ?)"
+	if err := tx.QueryRowContext(ctx, query, offer.EventID, personID, OfferPending, OfferApproved).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if count > 0 {
+		return nil, ErrDuplicateOffer
+	}
+
+	offer.PersonID = personID
+	offer.FirstName = registrant.FirstName
+	offer.LastName = registrant.LastName
+	offer.Email = registrant.Email
+	offer.Status = OfferPending
+	offer.OfferedAt = time.Now().Format(time.RFC3339)
+
+	query = "INSERT INTO driver_offers (event_id, person_id, first_name, surname, email, vehicle_name, capacity, departure_point, status, offered_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := tx.ExecContext(ctx, query, offer.EventID, offer.PersonID, offer.FirstName, offer.LastName, offer.Email, offer.VehicleName, offer.Capacity, offer.DeparturePoint, offer.Status, offer.OfferedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute INSERT statement: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	offer.OfferID = int(id)
+
+	return &offer, tx.Commit()
+}
+
+// GetDriverOffers returns the offers to drive to an event, oldest first
+func GetDriverOffers(ctx context.Context, eventID int) ([]DriverOffer, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+driverOfferColumns+" FROM driver_offers WHERE event_id = ? ORDER BY offer_id", eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := []DriverOffer{}
+	for rows.Next() {
+		offer, err := scanDriverOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
+	}
+
+	return offers, rows.Err()
+}
+
+func GetDriverOfferByID(ctx context.Context, offerID int) (*DriverOffer, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	offer, err := scanDriverOffer(db.QueryRowContext(ctx, "SELECT "+driverOfferColumns+" FROM driver_offers WHERE offer_id = ?", offerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// ApproveDriverOffer adds the offered vehicle to its event. If the driver had registered as a
+// passenger their seat is given up, since drivers don't take one. The caller is responsible for
+// giving the new seats to the waitlist.
+func ApproveDriverOffer(ctx context.Context, offerID int) (*DriverOffer, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	offer, err := scanDriverOffer(tx.QueryRowContext(ctx, "SELECT "+driverOfferColumns+" FROM driver_offers WHERE offer_id = ?", offerID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status != OfferPending {
+		return nil, ErrOfferDecided
+	}
+
+	// Drivers registered as passengers give up their seat, and stay listed so their attendance is recorded
+	var seatsFreed int
+	query := "SELECT COUNT(*) FROM participants WHERE event_id = ? AND person_id = ? AND seat_status = ?"
+	if err := tx.QueryRowContext(ctx, query, offer.EventID, offer.PersonID, SeatConfirmed).Scan(&seatsFreed); err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	query = "UPDATE participants SET seat_status = ?, vehicle_id = 0 WHERE event_id = ? AND person_id = ?"
+	if _, err := tx.ExecContext(ctx, query, SeatDriver, offer.EventID, offer.PersonID); err != nil {
+		return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE events SET seats_taken = seats_taken - ? WHERE event_id = ?", seatsFreed, offer.EventID); err != nil {
+		return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	var meetLocation string
+	if err := tx.QueryRowContext(ctx, "SELECT meet_location FROM events WHERE event_id = ?", offer.EventID).Scan(&meetLocation); err != nil {
+		return nil, fmt.Errorf("failed to find event: %v", err)
+	}
+	departurePoint := offer.DeparturePoint
+	if departurePoint == "" {
+		departurePoint = meetLocation
+	}
+
+	offer.VehicleID, err = insertVehicle(ctx, tx, Vehicle{
+		EventID:        offer.EventID,
+		Name:           offer.VehicleName,
+		DriverName:     offer.FirstName + " " + offer.LastName,
+		DriverEmail:    offer.Email,
+		Capacity:       offer.Capacity,
+		DeparturePoint: departurePoint,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	offer.Status = OfferApproved
+	offer.DecidedAt = time.Now().Format(time.RFC3339)
+	query = "UPDATE driver_offers SET status = ?, vehicle_id = ?, decided_at = ? WHERE offer_id = ?"
+	if _, err := tx.ExecContext(ctx, query, offer.Status, offer.VehicleID, offer.DecidedAt, offerID); err != nil {
+		return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return &offer, tx.Commit()
+}
+
+func DeclineDriverOffer(ctx context.Context, offerID int) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var status OfferStatus
+	err = db.QueryRowContext(ctx, "SELECT status FROM driver_offers WHERE offer_id = ?", offerID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrOfferNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != OfferPending {
+		return ErrOfferDecided
+	}
+
+	_, err = db.ExecContext(ctx, "UPDATE driver_offers SET status = ?, decided_at = ? WHERE offer_id = ?", OfferDeclined, time.Now().Format(time.RFC3339), offerID)
+	return err
+}
+
+// isDriving reports whether a person's offer to drive to an event has been approved
+func isDriving(ctx context.Context, q querier, eventID int, personID int) (bool, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM driver_offers WHERE event_id = ? AND person_id = ? AND status = ?"
+	if err := q.QueryRowContext(ctx, query, eventID, personID, OfferApproved).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	return count > 0, nil
+}
+
+// SetQualifiedDriver records whether the committee has approved a person to offer to drive
+func SetQualifiedDriver(ctx context.Context, personID int, qualified bool) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := db.ExecContext(ctx, "UPDATE people SET qualified_driver = ? WHERE person_id = ?", qualified, personID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownEventOrder = errors.New("unknown event order")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+)
+
+// EventOrder is the order events are returned in by GetEvents
+type EventOrder string
+
+const (
+	// OrderByID lists events in the order they were created, which is also the order when none is given
+	OrderByID EventOrder = "id"
+	// OrderByIDDesc lists the most recently created events first
+	OrderByIDDesc EventOrder = "-id"
+	// OrderByStart lists events soonest first, with events whose times couldn't be read last
+	OrderByStart EventOrder = "start"
+	// OrderByStartDesc lists events latest first, with events whose times couldn't be read last
+	OrderByStartDesc EventOrder = "-start"
+)
+
+// sortKey is one of the expressions events are ordered by, which a cursor carries the value of
+type sortKey struct {
+	expression string
+	descending bool
+	value      func(c eventCursor) any
+}
+
+var (
+	sortByID       = func(c eventCursor) any { return c.EventID }
+	sortByStart    = func(c eventCursor) any { return c.SessionStart }
+	sortByNoStart  = func(c eventCursor) any { return c.SessionStart == "" }
+	eventSortOrder = map[EventOrder][]sortKey{
+		OrderByID:     {{"event_id", false, sortByID}},
+		OrderByIDDesc: {{"event_id", true, sortByID}},
+		OrderByStart: {
+			{"session_start = ''", false, sortByNoStart},
+			{"session_start", false, sortByStart},
+			{"event_id", false, sortByID},
+		},
+		OrderByStartDesc: {
+			{"session_start = ''", false, sortByNoStart},
+			{"session_start", true, sortByStart},
+			{"event_id", true, sortByID},
+		},
+	}
+)
+
+// EventQuery picks which events GetEvents returns. From and To limit it to sessions starting
+// in that range, either can be left zero. Events whose times couldn't be read are left out
+// whenever a range is given. Location matches part of where the session is or where people meet.
+type EventQuery struct {
+	Statuses []EventStatus
+	From     time.Time
+	To       time.Time
+	Location string
+	Order    EventOrder
+
+	// After is the cursor of the page before, from EventPage.Next, and Limit is how many events
+	// to return with none meaning all of them
+	After string
+	Limit int
+}
+
+// EventPage is one page of events, Next is the cursor of the page after it and is empty on the last page
+type EventPage struct {
+	Events []Event
+	Next   string
+}
+
+// eventCursor holds the sort keys of the last event on a page. Its order is kept so a cursor
+// isn't used to carry on a listing in a different order.
+type eventCursor struct {
+	Order        EventOrder `json:"o"`
+	EventID      int        `json:"i"`
+	SessionStart string     `json:"s,omitempty"`
+}
+
+func (q EventQuery) order() EventOrder {
+	if q.Order == "" {
+		return OrderByID
+	}
+	return q.Order
+}
+
+func (q EventQuery) sortKeys() ([]sortKey, error) {
+	keys, ok := eventSortOrder[q.order()]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, use id, -id, start or -start", ErrUnknownEventOrder, q.Order)
+	}
+	return keys, nil
+}
+
+// where returns the conditions and arguments selecting the query's events
+func (q EventQuery) where() (string, []any, error) {
+	conditions := []string{"deleted_at = ''"}
+	var args []any
+	if len(q.Statuses) > 0 {
+		placeholders := make([]string, len(q.Statuses))
+		for i, status := range q.Statuses {
+			placeholders[i] = "?"
+			args = append(args, status)
+		}
+		conditions = append(conditions, "event_status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "session_start != ''", "session_start >= ?")
+		args = append(args, formatTimestamp(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "session_start != ''", "session_start < ?")
+		args = append(args, formatTimestamp(q.To))
+	}
+	if location := strings.TrimSpace(q.Location); location != "" {
+		pattern := "%" + likeEscaper.Replace(location) + "%"
+		conditions = append(conditions, `(event_location LIKE ? ESCAPE '\' OR meet_location LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	if q.After != "" {
+		after, afterArgs, err := q.afterCursor()
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, after)
+		args = append(args, afterArgs...)
+	}
+
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// afterCursor returns the condition selecting events that come after the cursor in the query's
+// order, so pages stay in step however many events are created or deleted in between
+func (q EventQuery) afterCursor() (string, []any, error) {
+	keys, err := q.sortKeys()
+	if err != nil {
+		return "", nil, err
+	}
+	cursor, err := decodeEventCursor(q.After)
+	if err != nil {
+		return "", nil, err
+	}
+	if cursor.Order != q.order() {
+		return "", nil, fmt.Errorf("%w, it is for events ordered by %s", ErrInvalidCursor, cursor.Order)
+	}
+
+	// Each alternative matches the keys before it and comes after the cursor on the next one
+	var alternatives []string
+	var args []any
+	for i, key := range keys {
+		var terms []string
+		for _, equal := range keys[:i] {
+			terms = append(terms, "("+equal.expression+") = ?")
+			args = append(args, equal.value(cursor))
+		}
+		comparison := " > ?"
+		if key.descending {
+			comparison = " < ?"
+		}
+		terms = append(terms, "("+key.expression+")"+comparison)
+		args = append(args, key.value(cursor))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args, nil
+}
+
+func (q EventQuery) orderBy() (string, error) {
+	keys, err := q.sortKeys()
+	if err != nil {
+		return "", err
+	}
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = key.expression
+		if key.descending {
+			terms[i] += " DESC"
+		}
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+func encodeEventCursor(order EventOrder, event Event) string {
+	cursor, _ := json.Marshal(eventCursor{
+		Order:        order,
+		EventID:      event.EventID,
+		SessionStart: formatTimestamp(event.SessionStart),
+	})
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+func decodeEventCursor(value string) (eventCursor, error) {
+	var cursor eventCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// GetEventPage returns up to the query's limit of events, along with the cursor of the page after
+func GetEventPage(ctx context.Context, eventQuery EventQuery) (EventPage, error) {
+	if eventQuery.Limit <= 0 {
+		return EventPage{}, errors.New("a page of events needs a limit")
+	}
+
+	// One more than the limit tells whether there's another page
+	limit := eventQuery.Limit
+	eventQuery.Limit++
+	events, err := GetEvents(ctx, eventQuery)
+	if err != nil {
+		return EventPage{}, err
+	}
+
+	page := EventPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.Next = encodeEventCursor(eventQuery.order(), page.Events[limit-1])
+	}
+	return page, nil
+}
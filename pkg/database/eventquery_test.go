@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAfterCursor(t *testing.T) {
+	start := time.Date(2027, 3, 10, 18, 0, 0, 0, time.UTC)
+	event := Event{EventID: 5, SessionStart: start}
+
+	tests := []struct {
+		order     EventOrder
+		condition string
+		args      []any
+	}{
+		{
+			order:     OrderByID,
+			condition: "(((event_id) > ?))",
+			args:      []any{5},
+		},
+		{
+			order:     OrderByIDDesc,
+			condition: "(((event_id) < ?))",
+			args:      []any{5},
+		},
+		{
+			order:     OrderByStart,
+			condition: "(((session_start = '') > ?) OR ((session_start = '') = ? AND (session_start) > ?) OR ((session_start = '') = ? AND (session_start) = ? AND (event_id) > ?))",
+			args:      []any{false, false, formatTimestamp(start), false, formatTimestamp(start), 5},
+		},
+		{
+			order:     OrderByStartDesc,
+			condition: "(((session_start = '') > ?) OR ((session_start = '') = ? AND (session_start) < ?) OR ((session_start = '') = ? AND (session_start) = ? AND (event_id) < ?))",
+			args:      []any{false, false, formatTimestamp(start), false, formatTimestamp(start), 5},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.order), func(t *testing.T) {
+			query := EventQuery{Order: test.order, After: encodeEventCursor(test.order, event)}
+			condition, args, err := query.afterCursor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if condition != test.condition {
+				t.Errorf("condition = %s\nwant %s", condition, test.condition)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("args = %v, want %v", args, test.args)
+			}
+		})
+	}
+}
+
+func TestAfterCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		query EventQuery
+		err   error
+	}{
+		{
+			name:  "not base64",
+			query: EventQuery{After: "not a cursor!"},
+			err:   ErrInvalidCursor,
+		},
+		{
+			name:  "not JSON",
+			query: EventQuery{After: "bm90IGpzb24"},
+			err:   ErrInvalidCursor,
+		},
+		{
+			name:  "another order",
+			query: EventQuery{Order: OrderByStart, After: encodeEventCursor(OrderByID, Event{EventID: 1})},
+			err:   ErrInvalidCursor,
+		},
+		{
+			name:  "order missing from the query",
+			query: EventQuery{After: encodeEventCursor(OrderByIDDesc, Event{EventID: 1})},
+			err:   ErrInvalidCursor,
+		},
+		{
+			name:  "unknown order",
+			query: EventQuery{Order: "name", After: encodeEventCursor("name", Event{EventID: 1})},
+			err:   ErrUnknownEventOrder,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := test.query.afterCursor(); !errors.Is(err, test.err) {
+				t.Errorf("error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// createTestEvents adds events out of date order, two pairs sharing a start time and one whose
+// times couldn't be read
+func createTestEvents(t *testing.T) context.Context {
+	t.Helper()
+	ctx := useTestDatabase(t)
+
+	sessions := []struct{ date, meetTime string }{
+		{"10/03/2027", "18:00"},
+		{"01/03/2027", "18:00"},
+		{"10/03/2027", "18:00"},
+		{"05/03/2027", "09:00"},
+		{"20/03/2027", "18:00"},
+		{"15/03/2027", "18:00"},
+		{"01/03/2027", "18:00"},
+	}
+	for i, session := range sessions {
+		_, err := CreateEvent(ctx, Event{
+			EventLocation: "Wall",
+			EventDate:     session.date,
+			MeetLocation:  "Union",
+			MeetTime:      session.meetTime,
+			TotalSeats:    10,
+		})
+		if err != nil {
+			t.Fatalf("failed to create event %d: %v", i+1, err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "UPDATE events SET meet_at = '', session_start = '', session_end = '' WHERE event_id = 6"); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+func eventIDs(events []Event) []int {
+	ids := []int{}
+	for _, event := range events {
+		ids = append(ids, event.EventID)
+	}
+	return ids
+}
+
+// allPages follows a query's pages to the end, checking none is longer than the limit
+func allPages(t *testing.T, ctx context.Context, query EventQuery) []int {
+	t.Helper()
+
+	ids := []int{}
+	for pages := 0; ; pages++ {
+		// More pages than events means a cursor isn't moving on
+		if pages > 10 {
+			t.Fatalf("%s limit %d: paging didn't finish", query.Order, query.Limit)
+		}
+		page, err := GetEventPage(ctx, query)
+		if err != nil {
+			t.Fatalf("%s limit %d: %v", query.Order, query.Limit, err)
+		}
+		if len(page.Events) > query.Limit {
+			t.Fatalf("%s limit %d: page of %d events", query.Order, query.Limit, len(page.Events))
+		}
+		ids = append(ids, eventIDs(page.Events)...)
+		if page.Next == "" {
+			return ids
+		}
+		query.After = page.Next
+	}
+}
+
+func TestGetEventPage(t *testing.T) {
+	ctx := createTestEvents(t)
+
+	orders := map[EventOrder][]int{
+		OrderByID:        {1, 2, 3, 4, 5, 6, 7},
+		OrderByIDDesc:    {7, 6, 5, 4, 3, 2, 1},
+		OrderByStart:     {2, 7, 4, 1, 3, 5, 6},
+		OrderByStartDesc: {5, 3, 1, 4, 7, 2, 6},
+	}
+
+	for order, want := range orders {
+		for _, limit := range []int{1, 2, 3, 7, 10} {
+			got := allPages(t, ctx, EventQuery{Order: order, Limit: limit})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s limit %d: got %v, want %v", order, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestGetEventPageAfterDelete(t *testing.T) {
+	ctx := createTestEvents(t)
+
+	query := EventQuery{Order: OrderByStart, Limit: 2}
+	first, err := GetEventPage(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(first.Events); !reflect.DeepEqual(got, []int{2, 7}) {
+		t.Fatalf("first page = %v", got)
+	}
+
+	// Deleting an event already listed and one still to come doesn't skip or repeat any others
+	if err := DeleteEvent(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteEvent(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	query.After = first.Next
+	second, err := GetEventPage(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := eventIDs(second.Events); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("second page = %v, want [1 3]", got)
+	}
+}
+
+func TestGetEventPageFilters(t *testing.T) {
+	ctx := createTestEvents(t)
+
+	// A range leaves out the event whose times couldn't be read
+	query := EventQuery{
+		Order: OrderByStart,
+		From:  time.Date(2027, 3, 5, 0, 0, 0, 0, time.Local),
+		To:    time.Date(2027, 3, 16, 0, 0, 0, 0, time.Local),
+		Limit: 2,
+	}
+	if got, want := allPages(t, ctx, query), []int{4, 1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := GetEventPage(ctx, EventQuery{}); err == nil {
+		t.Errorf("a page without a limit should be refused")
+	}
+}
@@ -1,48 +1,103 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	_ "github.com/glebarez/go-sqlite"
 )
 
-func CreateEvent(event Event) error {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+var (
+	ErrDuplicateParticipant = errors.New("participant name already exists for the event")
+	ErrEventNotFound        = errors.New("event not found")
+	ErrParticipantNotFound  = errors.New("participant not found")
+)
+
+func CreateEvent(ctx context.Context, event Event) (int, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer db.Close()
 
-	query := "INSERT INTO events (event_location, event_date, meet_location, meet_time, total_seats, require_member, open_datetime, close_datetime) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
-	_, err = db.Exec(query, event.EventLocation, event.EventDate, event.MeetLocation, event.MeetTime, event.TotalSeats, event.RequireMember, event.OpenDatetime, event.CloseDatetime)
+	return insertEvent(ctx, db, event)
+}
+
+// CreateEvents adds several events in one transaction, so either all of them are created or
+// none are. The IDs of the new events are returned in the same order.
+func CreateEvents(ctx context.Context, events []Event) ([]int, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer db.Close()
 
-	return nil
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	eventIDs := make([]int, 0, len(events))
+	for i, event := range events {
+		eventID, err := insertEvent(ctx, tx, event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create event %d: %v", i+1, err)
+		}
+		eventIDs = append(eventIDs, eventID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return eventIDs, nil
 }
 
-func DeleteEvent(eventId int) error {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+func insertEvent(ctx context.Context, q querier, event Event) (int, error) {
+	if event.AllocationMode == "" {
+		event.AllocationMode = AllocationFirstCome
+	}
+	if err := event.ResolveTimes(nil); err != nil {
+		return 0, err
+	}
+
+	// Every event starts as a draft until another admin approves it with ApproveEvent
+	query := "INSERT INTO events (event_location, event_date, meet_location, meet_time, meet_at, session_start, session_end, total_seats, require_member, open_datetime, close_datetime, event_status, allocation_mode, ballot_weighted, ballot_seed, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := q.ExecContext(ctx, query, event.EventLocation, event.EventDate, event.MeetLocation, event.MeetTime, formatTimestamp(event.MeetAt), formatTimestamp(event.SessionStart), formatTimestamp(event.SessionEnd), event.TotalSeats, event.RequireMember, event.OpenDatetime, event.CloseDatetime, EventStatusDraft, event.AllocationMode, event.BallotWeighted, event.BallotSeed, event.CreatedBy)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer db.Close()
 
-	query := "DELETE FROM events WHERE event_id = ?"
-	_, err = db.Exec(query, eventId)
+	eventID, err := res.LastInsertId()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	// Cascade delete
-	query = "DELETE FROM participants WHERE event_id = ?"
-	_, err = db.Exec(query, eventId)
+	return int(eventID), nil
+}
+
+// DeleteEvent hides an event from the site. Its participants are kept so attendance history
+// and stats still count it.
+func DeleteEvent(ctx context.Context, eventId int) error {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
+
+	query := "UPDATE events SET deleted_at = ? WHERE event_id = ? AND deleted_at = ''"
+	res, err := db.ExecContext(ctx, query, time.Now().Format(time.RFC3339), eventId)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return ErrEventNotFound
+	}
 
 	return nil
 }
@@ -58,113 +113,324 @@ type Event struct {
 	RequireMember bool        `db:"require_member" json:"require_member"`
 	OpenDatetime  string      `db:"open_datetime" json:"open_date"`
 	CloseDatetime string      `db:"close_datetime" json:"close_date"`
-	EventStatus   EventStatus `db:"event_status"`
+	EventStatus   EventStatus `db:"event_status" json:"status"`
+
+	// MeetAt is when participants meet, worked out from EventDate and MeetTime by ResolveTimes.
+	// The session itself can start later, with SessionEnd being when it finishes.
+	MeetAt       time.Time `db:"meet_at" json:"meet_at"`
+	SessionStart time.Time `db:"session_start" json:"session_start"`
+	SessionEnd   time.Time `db:"session_end" json:"session_end"`
+
+	CancellationReason string `db:"cancellation_reason" json:"cancellation_reason"`
+	CancelledAt        string `db:"cancelled_at" json:"cancelled_at"`
+
+	// Admins who created and approved the event, approval has to come from someone else
+	CreatedBy  string `db:"created_by" json:"created_by"`
+	ApprovedBy string `db:"approved_by" json:"approved_by"`
+	ApprovedAt string `db:"approved_at" json:"approved_at"`
+
+	AllocationMode AllocationMode `db:"allocation_mode" json:"allocation_mode"`
+	BallotWeighted bool           `db:"ballot_weighted" json:"ballot_weighted"`
+	// BallotSeed decides the draw, so it's never sent out where anyone could work out the result
+	// before signups close
+	BallotSeed    int64  `db:"ballot_seed" json:"-"`
+	BallotDrawnAt string `db:"ballot_drawn_at" json:"ballot_drawn_at"`
+}
+
+const eventColumns = "event_id, event_location, event_date, meet_location, meet_time, total_seats, seats_taken, require_member, open_datetime, close_datetime, event_status, meet_at, session_start, session_end, cancellation_reason, cancelled_at, created_by, approved_by, approved_at, allocation_mode, ballot_weighted, ballot_seed, ballot_drawn_at"
+
+func scanEvent(row rowScanner) (Event, error) {
+	var event Event
+	var meetAt, sessionStart, sessionEnd string
+	err := row.Scan(
+		&event.EventID,
+		&event.EventLocation,
+		&event.EventDate,
+		&event.MeetLocation,
+		&event.MeetTime,
+		&event.TotalSeats,
+		&event.SeatsTaken,
+		&event.RequireMember,
+		&event.OpenDatetime,
+		&event.CloseDatetime,
+		&event.EventStatus,
+		&meetAt,
+		&sessionStart,
+		&sessionEnd,
+		&event.CancellationReason,
+		&event.CancelledAt,
+		&event.CreatedBy,
+		&event.ApprovedBy,
+		&event.ApprovedAt,
+		&event.AllocationMode,
+		&event.BallotWeighted,
+		&event.BallotSeed,
+		&event.BallotDrawnAt,
+	)
+	if err != nil {
+		return event, err
+	}
+
+	if event.MeetAt, err = parseTimestamp(meetAt); err != nil {
+		return event, fmt.Errorf("failed to parse meet time: %v", err)
+	}
+	if event.SessionStart, err = parseTimestamp(sessionStart); err != nil {
+		return event, fmt.Errorf("failed to parse session start: %v", err)
+	}
+	if event.SessionEnd, err = parseTimestamp(sessionEnd); err != nil {
+		return event, fmt.Errorf("failed to parse session end: %v", err)
+	}
+	return event, nil
 }
 
+// EventStatus is where an event is in its lifecycle, see transitions for how it moves. Values are
+// stored as integers so new ones are only ever appended.
 type EventStatus int
 
 const (
+	// EventStatusScheduled is an event waiting for its signups to open
 	EventStatusScheduled EventStatus = iota
 	EventStatusClosed
+	EventStatusCancelled
+	// EventStatusDraft is an event the committee is still preparing, it isn't announced or shown
+	EventStatusDraft
+	EventStatusOpen
+	// EventStatusCompleted is an event whose session has taken place
+	EventStatusCompleted
 )
 
-func (e *Event) Close() error {
-	e.EventStatus = EventStatusClosed
-	return UpdateEventInDatabase(e.EventID, *e)
+var eventStatusNames = map[EventStatus]string{
+	EventStatusDraft:     "draft",
+	EventStatusScheduled: "scheduled",
+	EventStatusOpen:      "open",
+	EventStatusClosed:    "closed",
+	EventStatusCompleted: "completed",
+	EventStatusCancelled: "cancelled",
 }
 
-func (e *Event) GetLink() string {
-	return fmt.Sprintf("http://uowclimbingsociety.tplinkdns.com:8080/register?event=%d", e.EventID)
+func (s EventStatus) String() string {
+	if name, ok := eventStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventStatus(%d)", int(s))
+}
+
+func (s EventStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *EventStatus) UnmarshalText(text []byte) error {
+	for status, name := range eventStatusNames {
+		if name == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown event status %q", string(text))
 }
 
-func (e *Event) GetParticipants() ([]Participant, error) {
-	return GetEventParticipants(e.EventID)
+// Values lists the names an EventStatus can be sent as
+func (EventStatus) Values() []string {
+	return enumValues(eventStatusNames)
 }
 
-func (e *Event) AddParticipant(firstName string, surname string, member bool) error {
-	// Confirm there is space
-	if e.TotalSeats-e.SeatsTaken <= 0 {
-		return errors.New("no seats available")
+// enumValues returns the names of an enum in the order its values are declared
+func enumValues[T ~int](names map[T]string) []string {
+	values := make([]T, 0, len(names))
+	for value := range names {
+		values = append(values, value)
 	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
 
-	// Create DB connection
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+	list := make([]string, len(values))
+	for i, value := range values {
+		list[i] = names[value]
+	}
+	return list
+}
+
+// AcceptingRegistrations reports whether people can sign up in this status. Scheduled events are
+// included as the scheduler may open them late, so callers must also check the current time is
+// between OpenTime and CloseTime.
+func (s EventStatus) AcceptingRegistrations() bool {
+	return s == EventStatusScheduled || s == EventStatusOpen
+}
+
+// SignupsClosed reports whether the seats for an event have been settled, meaning attendance at
+// it counts towards someone's history
+func (s EventStatus) SignupsClosed() bool {
+	return s == EventStatusClosed || s == EventStatusCompleted
+}
+
+// Format used for the open and close datetimes, interpreted in the server's local timezone
+const DatetimeFormat = "02/01/2006 15:04:05"
+
+func (e *Event) OpenTime() (time.Time, error) {
+	return time.ParseInLocation(DatetimeFormat, e.OpenDatetime, time.Local)
+}
+
+func (e *Event) CloseTime() (time.Time, error) {
+	return time.ParseInLocation(DatetimeFormat, e.CloseDatetime, time.Local)
+}
+
+// StartTime is when participants meet for the session, which reminders count down to. It returns
+// ErrNoMeetTime when the event's date or meet time couldn't be read.
+func (e *Event) StartTime() (time.Time, error) {
+	if e.MeetAt.IsZero() {
+		return time.Time{}, ErrNoMeetTime
+	}
+	return e.MeetAt, nil
+}
+
+func (e *Event) Close(ctx context.Context) error {
+	closed, err := TransitionEvent(ctx, e.EventID, EventStatusClosed)
 	if err != nil {
 		return err
 	}
+	*e = *closed
+	return nil
+}
+
+// Address the app is reachable at, used in links sent outside the site
+const SiteURL = "http://uowclimbingsociety.tplinkdns.com:8080"
+
+func (e *Event) GetLink() string {
+	return fmt.Sprintf("%s/register?event=%d", SiteURL, e.EventID)
+}
+
+func (e *Event) GetParticipants(ctx context.Context) ([]Participant, error) {
+	return GetEventParticipants(ctx, e.EventID)
+}
+
+// Registrant is someone signing up for an event
+type Registrant struct {
+	FirstName     string
+	LastName      string
+	PreferredName string
+	Email         string
+	StudentID     string
+	Member        bool
+	// Reminders is whether someone registering for the first time wants emails before their
+	// sessions, they're sent when nil. It isn't saved for people who have registered before.
+	Reminders *bool
+}
+
+// AddParticipant registers a person for the event, giving them a seat if one is free and they
+// are not in a cooldown, otherwise placing them on the waitlist. They are linked to the person
+// they match or a new one is created. Registering the same person twice returns
+// ErrDuplicateParticipant.
+func (e *Event) AddParticipant(ctx context.Context, registrant Registrant, allocation Allocation) (*Participant, error) {
+	// Create DB connection
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
 	defer db.Close()
 
-	// Check if the participant name already exists for the event
+	// Seat check and insert happen in one transaction so two people can't take the last seat
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	personID, err := resolvePerson(ctx, tx, registrant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find person: %v", err)
+	}
+
+	// Check if the person is already registered for the event
 	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM participants WHERE event_id = ? AND first_name = ? AND surname = ?", e.EventID, firstName, surname).Scan(&count)
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM participants WHERE event_id = ? AND person_id = ?", e.EventID, personID).Scan(&count)
 	if err != nil {
-		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
 	}
 
 	if count > 0 {
-		return fmt.Errorf("participant name already exists for the event")
+		return nil, ErrDuplicateParticipant
 	}
 
-	// Add participant
-	stmt, err := db.Prepare("INSERT INTO participants (event_id, first_name, surname, member) VALUES (?, ?, ?, ?)")
+	var seatsFree int
+	err = tx.QueryRowContext(ctx, "SELECT total_seats - seats_taken FROM events WHERE event_id = ?", e.EventID).Scan(&seatsFree)
 	if err != nil {
-		return fmt.Errorf("failed to prepare INSERT statement: %v", err)
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(e.EventID, firstName, surname, member)
+	driving, err := isDriving(ctx, tx, e.EventID, personID)
 	if err != nil {
-		return fmt.Errorf("failed to execute INSERT statement: %v", err)
+		return nil, err
 	}
 
-	// Update seats taken
-	updateStmt, err := db.Prepare("UPDATE events SET seats_taken = seats_taken + 1 WHERE event_id = ?")
+	participant := Participant{
+		EventID:          e.EventID,
+		PersonID:         personID,
+		FirstName:        registrant.FirstName,
+		LastName:         registrant.LastName,
+		PreferredName:    registrant.PreferredName,
+		Email:            registrant.Email,
+		Member:           registrant.Member,
+		SeatStatus:       SeatConfirmed,
+		Priority:         allocation.Priority,
+		AllocationReason: allocation.Reason,
+		Cooldown:         allocation.Cooldown,
+		RegisteredAt:     time.Now().Format(time.RFC3339),
+	}
+	if driving {
+		// Drivers bring their own seat
+		participant.SeatStatus = SeatDriver
+	} else if e.AllocationMode == AllocationBallot && e.BallotDrawnAt == "" {
+		// Seats are handed out by the draw when signups close, after that a reopened event is first come first served
+		participant.SeatStatus = SeatBallot
+	} else if allocation.Cooldown || seatsFree <= 0 {
+		participant.SeatStatus = SeatWaitlisted
+	}
+
+	// Add participant
+	query := "INSERT INTO participants (event_id, person_id, first_name, surname, preferred_name, email, member, seat_status, priority, allocation_reason, cooldown, registered_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	res, err := tx.ExecContext(ctx, query, e.EventID, personID, participant.FirstName, participant.LastName, participant.PreferredName, participant.Email, participant.Member, participant.SeatStatus, participant.Priority, participant.AllocationReason, participant.Cooldown, participant.RegisteredAt)
 	if err != nil {
-		return fmt.Errorf("failed to prepare UPDATE statement: %v", err)
+		return nil, fmt.Errorf("failed to execute INSERT statement: %v", err)
 	}
-	defer updateStmt.Close()
 
-	_, err = updateStmt.Exec(e.EventID)
+	participantID, err := res.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		return nil, err
 	}
+	participant.ParticipantID = int(participantID)
 
-	return nil
+	// Update seats taken
+	if participant.SeatStatus == SeatConfirmed {
+		_, err = tx.ExecContext(ctx, "UPDATE events SET seats_taken = seats_taken + 1 WHERE event_id = ?", e.EventID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &participant, nil
 }
 
-func GetEventByID(eventID int) (*Event, error) {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+func GetEventByID(ctx context.Context, eventID int) (*Event, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	query := "SELECT event_id, event_location, event_date, meet_location, meet_time, total_seats, seats_taken, require_member, open_datetime, close_datetime, event_status FROM events WHERE event_id = ?"
-	stmt, err := db.Prepare(query)
+	query := "SELECT " + eventColumns + " FROM events WHERE event_id = ? AND deleted_at = ''"
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(eventID)
-
-	var event Event
-	err = row.Scan(
-		&event.EventID,
-		&event.EventLocation,
-		&event.EventDate,
-		&event.MeetLocation,
-		&event.MeetTime,
-		&event.TotalSeats,
-		&event.SeatsTaken,
-		&event.RequireMember,
-		&event.OpenDatetime,
-		&event.CloseDatetime,
-		&event.EventStatus,
-	)
+	event, err := scanEvent(stmt.QueryRowContext(ctx, eventID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("event not found")
+			return nil, ErrEventNotFound
 		}
 		return nil, err
 	}
@@ -173,22 +439,74 @@ func GetEventByID(eventID int) (*Event, error) {
 }
 
 type Participant struct {
-	ParticipantID int    `db:"participant_id" json:"participant_id"`
-	EventID       int    `db:"event_id" json:"event_id"`
-	FirstName     string `db:"first_name" json:"first_name"`
-	LastName      string `db:"surname" json:"last_name"`
-	Member        bool   `db:"member" json:"member"`
+	ParticipantID    int              `db:"participant_id" json:"participant_id"`
+	EventID          int              `db:"event_id" json:"event_id"`
+	PersonID         int              `db:"person_id" json:"person_id"`
+	FirstName        string           `db:"first_name" json:"first_name"`
+	LastName         string           `db:"surname" json:"last_name"`
+	PreferredName    string           `db:"preferred_name" json:"preferred_name"`
+	Email            string           `db:"email" json:"email"`
+	Member           bool             `db:"member" json:"member"`
+	Attendance       AttendanceStatus `db:"attendance" json:"attendance"`
+	SeatStatus       SeatStatus       `db:"seat_status" json:"seat_status"`
+	Priority         int              `db:"priority" json:"priority"`
+	AllocationReason string           `db:"allocation_reason" json:"allocation_reason"`
+	Cooldown         bool             `db:"cooldown" json:"cooldown"`
+	RegisteredAt     string           `db:"registered_at" json:"registered_at"`
+	OutcomeNotified  bool             `db:"outcome_notified" json:"outcome_notified"`
+	MembershipFlag   string           `db:"membership_flag" json:"membership_flag"`
+	VehicleID        int              `db:"vehicle_id" json:"vehicle_id"`
+}
+
+// DisplayName is what to call the participant, their preferred name if they gave one
+func (p Participant) DisplayName() string {
+	if p.PreferredName != "" {
+		return p.PreferredName
+	}
+	return p.FirstName
+}
+
+const participantColumns = "participant_id, event_id, person_id, first_name, surname, preferred_name, email, member, attendance, seat_status, priority, allocation_reason, cooldown, registered_at, outcome_notified, membership_flag, vehicle_id"
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func GetEventParticipants(eventID int) ([]Participant, error) {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+func scanParticipant(row rowScanner) (Participant, error) {
+	var participant Participant
+	err := row.Scan(
+		&participant.ParticipantID,
+		&participant.EventID,
+		&participant.PersonID,
+		&participant.FirstName,
+		&participant.LastName,
+		&participant.PreferredName,
+		&participant.Email,
+		&participant.Member,
+		&participant.Attendance,
+		&participant.SeatStatus,
+		&participant.Priority,
+		&participant.AllocationReason,
+		&participant.Cooldown,
+		&participant.RegisteredAt,
+		&participant.OutcomeNotified,
+		&participant.MembershipFlag,
+		&participant.VehicleID,
+	)
+	return participant, err
+}
+
+// GetEventParticipants returns everyone registered for an event, those with seats first and then
+// the waitlist in the order it would be promoted
+func GetEventParticipants(ctx context.Context, eventID int) ([]Participant, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	query := "SELECT participant_id, event_id, first_name, surname, member FROM participants WHERE event_id = ?"
-	rows, err := db.Query(query, eventID)
+	query := "SELECT " + participantColumns + " FROM participants WHERE event_id = ? ORDER BY " + participantOrder
+	rows, err := db.QueryContext(ctx, query, eventID)
 	if err != nil {
 		return nil, err
 	}
@@ -196,14 +514,8 @@ func GetEventParticipants(eventID int) ([]Participant, error) {
 
 	participants := []Participant{}
 	for rows.Next() {
-		var participant Participant
-		if err := rows.Scan(
-			&participant.ParticipantID,
-			&participant.EventID,
-			&participant.FirstName,
-			&participant.LastName,
-			&participant.Member,
-		); err != nil {
+		participant, err := scanParticipant(rows)
+		if err != nil {
 			return nil, err
 		}
 		participants = append(participants, participant)
@@ -212,33 +524,24 @@ func GetEventParticipants(eventID int) ([]Participant, error) {
 	return participants, nil
 }
 
-func GetParticipantByID(participantID int) (*Participant, error) {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+func GetParticipantByID(ctx context.Context, participantID int) (*Participant, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
-	query := "SELECT participant_id, event_id, first_name, surname, member FROM participants WHERE participant_id = ?"
-	stmt, err := db.Prepare(query)
+	query := "SELECT " + participantColumns + " FROM participants WHERE participant_id = ?"
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(participantID)
-
-	var participant Participant
-	err = row.Scan(
-		&participant.ParticipantID,
-		&participant.EventID,
-		&participant.FirstName,
-		&participant.LastName,
-		&participant.Member,
-	)
+	participant, err := scanParticipant(stmt.QueryRowContext(ctx, participantID))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("participant not found")
+			return nil, ErrParticipantNotFound
 		}
 		return nil, err
 	}
@@ -246,46 +549,65 @@ func GetParticipantByID(participantID int) (*Participant, error) {
 	return &participant, nil
 }
 
-func DeleteParticipant(participantID int) error {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+// DeleteParticipant removes a registration. If they held a seat it is offered to the waitlist,
+// and the promoted participants are returned.
+func DeleteParticipant(ctx context.Context, participantID int) ([]Participant, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
 
-	participant, err := GetParticipantByID(participantID)
+	participant, err := GetParticipantByID(ctx, participantID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	event, err := GetEventByID(participant.EventID)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
 	query := "DELETE FROM participants WHERE participant_id = ?"
-	res, err := db.Exec(query, participantID)
-	fmt.Println(res)
+	res, err := tx.ExecContext(ctx, query, participantID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	event.SeatsTaken = event.SeatsTaken - 1
-	err = UpdateEventInDatabase(event.EventID, *event)
-	if err != nil {
-		return err
+	if affected, err := res.RowsAffected(); err == nil {
+		logger.DebugContext(ctx, "Deleted participant", "participant_id", participantID, "rows", affected)
 	}
 
-	return nil
+	if participant.SeatStatus == SeatConfirmed {
+		_, err = tx.ExecContext(ctx, "UPDATE events SET seats_taken = seats_taken - 1 WHERE event_id = ?", participant.EventID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if participant.SeatStatus != SeatConfirmed {
+		return nil, nil
+	}
+
+	// Participants in a cooldown only get seats left over when signups close
+	return PromoteFromWaitlist(ctx, participant.EventID, false)
 }
 
-func UpdateEventInDatabase(eventID int, eventData Event) error {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+// UpdateEventInDatabase saves the committee's changes to an event, which should have had
+// ResolveTimes called on it. Its status is left alone, that only changes through TransitionEvent.
+func UpdateEventInDatabase(ctx context.Context, eventID int, eventData Event) error {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
 
+	// Events with vehicles take their total seats from the vehicles rather than the update
 	query := `
         UPDATE events
         SET
@@ -293,27 +615,38 @@ func UpdateEventInDatabase(eventID int, eventData Event) error {
             event_date = ?,
             meet_location = ?,
             meet_time = ?,
-            total_seats = ?,
+			meet_at = ?,
+			session_start = ?,
+			session_end = ?,
+            total_seats = COALESCE((SELECT SUM(capacity) FROM vehicles WHERE event_id = events.event_id), ?),
 			seats_taken = ?,
             require_member = ?,
             open_datetime = ?,
             close_datetime = ?,
-			event_status = ?
+			allocation_mode = ?,
+			ballot_weighted = ?,
+			ballot_seed = ?
         WHERE event_id = ?
     `
 
-	_, err = db.Exec(
+	_, err = db.ExecContext(
+		ctx,
 		query,
 		eventData.EventLocation,
 		eventData.EventDate,
 		eventData.MeetLocation,
 		eventData.MeetTime,
+		formatTimestamp(eventData.MeetAt),
+		formatTimestamp(eventData.SessionStart),
+		formatTimestamp(eventData.SessionEnd),
 		eventData.TotalSeats,
 		eventData.SeatsTaken,
 		eventData.RequireMember,
 		eventData.OpenDatetime,
 		eventData.CloseDatetime,
-		eventData.EventStatus,
+		eventData.AllocationMode,
+		eventData.BallotWeighted,
+		eventData.BallotSeed,
 		eventID,
 	)
 	if err != nil {
@@ -323,15 +656,29 @@ func UpdateEventInDatabase(eventID int, eventData Event) error {
 	return nil
 }
 
-func GetEvents() ([]Event, error) {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+// GetEvents returns the events picked by the query, in the order it asks for
+func GetEvents(ctx context.Context, eventQuery EventQuery) ([]Event, error) {
+	orderBy, err := eventQuery.orderBy()
+	if err != nil {
+		return nil, err
+	}
+	where, args, err := eventQuery.where()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to database: %s", err)
 	}
 	defer db.Close()
 
-	query := "SELECT event_id, event_location, event_date, meet_location, meet_time, total_seats, seats_taken, require_member, open_datetime, close_datetime, event_status FROM events"
-	rows, err := db.Query(query)
+	query := "SELECT " + eventColumns + " FROM events WHERE " + where + " ORDER BY " + orderBy
+	if eventQuery.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, eventQuery.Limit)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get events: %s", err)
 	}
@@ -339,20 +686,7 @@ func GetEvents() ([]Event, error) {
 
 	var events []Event
 	for rows.Next() {
-		var event Event
-		err = rows.Scan(
-			&event.EventID,
-			&event.EventLocation,
-			&event.EventDate,
-			&event.MeetLocation,
-			&event.MeetTime,
-			&event.TotalSeats,
-			&event.SeatsTaken,
-			&event.RequireMember,
-			&event.OpenDatetime,
-			&event.CloseDatetime,
-			&event.EventStatus,
-		)
+		event, err := scanEvent(rows)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to parse event: %s", err)
 		}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// DefaultSessionLength is how long a session is taken to last when the committee doesn't say
+const DefaultSessionLength = 3 * time.Hour
+
+var ErrNoMeetTime = errors.New("event has no meet time that could be read")
+
+// formatTimestamp stores a time in UTC so stored times sort in order as text
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTimestamp reads a time stored by formatTimestamp, with nothing stored being the zero time
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.In(time.Local), nil
+}
+
+// parseMeetTime reads the date and meet time as they are entered on the dashboard
+func parseMeetTime(date string, meetTime string) (time.Time, error) {
+	return time.ParseInLocation(DateFormat+" "+MeetTimeFormat, strings.TrimSpace(date)+" "+strings.TrimSpace(meetTime), time.Local)
+}
+
+// ResolveTimes works out the event's meet time from the date and meet time entered on the
+// dashboard, or fills those in if only a meet time was given. A session start or end that wasn't
+// given keeps the same gap from the meet time as in previous, or the session starts at the meet
+// time and lasts DefaultSessionLength.
+func (e *Event) ResolveTimes(previous *Event) error {
+	if e.EventDate == "" && e.MeetTime == "" && !e.MeetAt.IsZero() {
+		local := e.MeetAt.In(time.Local)
+		e.EventDate = local.Format(DateFormat)
+		e.MeetTime = local.Format(MeetTimeFormat)
+	}
+
+	meetAt, err := parseMeetTime(e.EventDate, e.MeetTime)
+	if err != nil {
+		return fmt.Errorf("date %q and meet time %q must be dd/mm/yyyy and hh:mm", e.EventDate, e.MeetTime)
+	}
+	e.MeetAt = meetAt
+
+	startGap, length := time.Duration(0), DefaultSessionLength
+	if previous != nil && !previous.MeetAt.IsZero() && !previous.SessionStart.IsZero() && previous.SessionEnd.After(previous.SessionStart) {
+		startGap = previous.SessionStart.Sub(previous.MeetAt)
+		length = previous.SessionEnd.Sub(previous.SessionStart)
+	}
+	if e.SessionStart.IsZero() {
+		e.SessionStart = meetAt.Add(startGap)
+	}
+	if e.SessionEnd.IsZero() {
+		e.SessionEnd = e.SessionStart.Add(length)
+	}
+
+	if e.SessionStart.Before(e.MeetAt) {
+		return errors.New("session can't start before the meet time")
+	}
+	if !e.SessionEnd.After(e.SessionStart) {
+		return errors.New("session must end after it starts")
+	}
+	return nil
+}
+
+// UnreadableEventTimes is an event whose date or meet time couldn't be read when migrating, so
+// it has no session times until the committee corrects it
+type UnreadableEventTimes struct {
+	EventID   int
+	EventDate string
+	MeetTime  string
+}
+
+// migrateEventTimes fills in the session times of events created before they were stored,
+// from their date and meet time. Events whose date or meet time can't be read are returned.
+func migrateEventTimes(ctx context.Context, db *sql.DB) ([]UnreadableEventTimes, error) {
+	rows, err := db.QueryContext(ctx, "SELECT event_id, event_date, meet_time FROM events WHERE meet_at = '' AND deleted_at = ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+
+	var pending []UnreadableEventTimes
+	for rows.Next() {
+		var event UnreadableEventTimes
+		if err := rows.Scan(&event.EventID, &event.EventDate, &event.MeetTime); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pending = append(pending, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var unreadable []UnreadableEventTimes
+	for _, event := range pending {
+		times := Event{EventDate: event.EventDate, MeetTime: event.MeetTime}
+		if err := times.ResolveTimes(nil); err != nil {
+			unreadable = append(unreadable, event)
+			continue
+		}
+
+		query := "UPDATE events SET meet_at = ?, session_start = ?, session_end = ? WHERE event_id = ?"
+		if _, err := db.ExecContext(ctx, query, formatTimestamp(times.MeetAt), formatTimestamp(times.SessionStart), formatTimestamp(times.SessionEnd), event.EventID); err != nil {
+			return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+	}
+
+	return unreadable, nil
+}
+
+// GetUnreadableEventTimes returns the events left without session times because their date or
+// meet time couldn't be read
+func GetUnreadableEventTimes(ctx context.Context) ([]UnreadableEventTimes, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT event_id, event_date, meet_time FROM events WHERE meet_at = '' AND deleted_at = '' ORDER BY event_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	defer rows.Close()
+
+	var unreadable []UnreadableEventTimes
+	for rows.Next() {
+		var event UnreadableEventTimes
+		if err := rows.Scan(&event.EventID, &event.EventDate, &event.MeetTime); err != nil {
+			return nil, err
+		}
+		unreadable = append(unreadable, event)
+	}
+	return unreadable, rows.Err()
+}
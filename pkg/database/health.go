@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// Ping checks that the database can be opened and queried
+func Ping(ctx context.Context) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var count int
+	return db.QueryRowContext(ctx, "SELECT COUNT(*) FROM events").Scan(&count)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// ClaimJob records that a scheduled job is being run. It returns false if the job has already
+// been claimed, so a job is never run twice even across restarts.
+func ClaimJob(ctx context.Context, eventID int, jobKind string, runAt time.Time) (bool, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	query := "INSERT OR IGNORE INTO scheduled_jobs (event_id, job_kind, run_at, completed_at) VALUES (?, ?, ?, ?)"
+	res, err := db.ExecContext(ctx, query, eventID, jobKind, runAt.Format(time.RFC3339), time.Now().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to execute INSERT statement: %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// ReleaseJob removes a claim so that a failed job can be attempted again
+func ReleaseJob(ctx context.Context, eventID int, jobKind string) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "DELETE FROM scheduled_jobs WHERE event_id = ? AND job_kind = ?", eventID, jobKind)
+	if err != nil {
+		return fmt.Errorf("failed to execute DELETE statement: %v", err)
+	}
+
+	return nil
+}
+
+// GetCompletedJobs returns the kinds of job that have already run for an event
+func GetCompletedJobs(ctx context.Context, eventID int) (map[string]bool, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT job_kind FROM scheduled_jobs WHERE event_id = ?", eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := map[string]bool{}
+	for rows.Next() {
+		var jobKind string
+		if err := rows.Scan(&jobKind); err != nil {
+			return nil, err
+		}
+		completed[jobKind] = true
+	}
+
+	return completed, rows.Err()
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+var (
+	ErrInvalidTransition = errors.New("event can't change to that status")
+	ErrApprovalRequired  = errors.New("drafts are only scheduled once approved")
+	ErrSelfApproval      = errors.New("events must be approved by a different admin to the one who created them")
+)
+
+// transitions lists the statuses each status can move to. Events normally go draft, scheduled,
+// open, closed then completed, and can be cancelled at any point before they're completed.
+var transitions = map[EventStatus][]EventStatus{
+	EventStatusDraft: {EventStatusScheduled, EventStatusCancelled},
+	// Scheduled events close without opening when the server was down for the whole signup window
+	EventStatusScheduled: {EventStatusOpen, EventStatusClosed, EventStatusCancelled},
+	EventStatusOpen:      {EventStatusClosed, EventStatusCancelled},
+	// Reopening a closed event is done by the committee through ReopenEvent
+	EventStatusClosed: {EventStatusOpen, EventStatusCompleted, EventStatusCancelled},
+}
+
+// CanTransition reports whether an event in this status is allowed to move to another
+func (s EventStatus) CanTransition(to EventStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition is an event changing status, given to hooks after it has been saved
+type Transition struct {
+	Event Event
+	From  EventStatus
+	To    EventStatus
+}
+
+// TransitionHook carries out the side effects of an event changing status. Hooks run after the
+// change is saved, so they can't stop it and should log their own failures.
+type TransitionHook func(ctx context.Context, transition Transition)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []TransitionHook
+)
+
+// OnTransition adds a hook that is run whenever an event changes status
+func OnTransition(hook TransitionHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+func runHooks(ctx context.Context, transition Transition) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, transition)
+	}
+}
+
+// TransitionEvent moves an event to a new status, returning ErrInvalidTransition if its current
+// status doesn't allow it. Drafts are scheduled through ApproveEvent instead.
+func TransitionEvent(ctx context.Context, eventID int, to EventStatus) (*Event, error) {
+	return transitionEvent(ctx, eventID, to, func(tx *sql.Tx, event Event) error {
+		if event.EventStatus == EventStatusDraft && to == EventStatusScheduled {
+			return ErrApprovalRequired
+		}
+		return nil
+	})
+}
+
+// transitionEvent checks and saves a status change, with apply making any other changes that go
+// with it in the same transaction, given the event as it was before. Hooks are run once it's
+// committed.
+func transitionEvent(ctx context.Context, eventID int, to EventStatus, apply func(tx *sql.Tx, event Event) error) (*Event, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := "SELECT " + eventColumns + " FROM events WHERE event_id = ? AND deleted_at = ''"
+	event, err := scanEvent(tx.QueryRowContext(ctx, query, eventID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	from := event.EventStatus
+	if !from.CanTransition(to) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE events SET event_status = ? WHERE event_id = ?", to, eventID); err != nil {
+		return nil, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if apply != nil {
+		if err := apply(tx, event); err != nil {
+			return nil, err
+		}
+	}
+
+	event, err = scanEvent(tx.QueryRowContext(ctx, query, eventID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	runHooks(ctx, Transition{Event: event, From: from, To: to})
+	return &event, nil
+}
+
+// CancelEvent marks an event as cancelled with the reason given to participants. It stays on
+// the site so anyone following its link sees it was cancelled.
+func CancelEvent(ctx context.Context, eventID int, reason string) (*Event, error) {
+	return transitionEvent(ctx, eventID, EventStatusCancelled, func(tx *sql.Tx, event Event) error {
+		query := "UPDATE events SET cancellation_reason = ?, cancelled_at = ? WHERE event_id = ?"
+		if _, err := tx.ExecContext(ctx, query, reason, time.Now().Format(time.RFC3339), eventID); err != nil {
+			return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+		return nil
+	})
+}
+
+// ReopenEvent opens signups again on a closed event until a new close time. The close is
+// forgotten so the scheduler closes it again, sending an updated list.
+func ReopenEvent(ctx context.Context, eventID int, closeDatetime string) (*Event, error) {
+	return transitionEvent(ctx, eventID, EventStatusOpen, func(tx *sql.Tx, event Event) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE events SET close_datetime = ? WHERE event_id = ?", closeDatetime, eventID); err != nil {
+			return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM scheduled_jobs WHERE event_id = ? AND job_kind = 'close'", eventID); err != nil {
+			return fmt.Errorf("failed to execute DELETE statement: %v", err)
+		}
+		return nil
+	})
+}
+
+// ApproveEvent schedules a draft so it's announced and opened, recording who approved it. The
+// approver can't be the admin who created it, so nothing reaches the society without a second
+// committee member seeing it first. A draft with no creator recorded can't be shown to have come
+// from someone else, so it isn't approved either.
+func ApproveEvent(ctx context.Context, eventID int, approver string) (*Event, error) {
+	return transitionEvent(ctx, eventID, EventStatusScheduled, func(tx *sql.Tx, event Event) error {
+		if approver == "" || event.CreatedBy == "" || strings.EqualFold(approver, event.CreatedBy) {
+			return ErrSelfApproval
+		}
+
+		query := "UPDATE events SET approved_by = ?, approved_at = ? WHERE event_id = ?"
+		if _, err := tx.ExecContext(ctx, query, approver, time.Now().Format(time.RFC3339), eventID); err != nil {
+			return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+		return nil
+	})
+}
+
+// GetPendingEvents returns the drafts waiting for approval, oldest first
+func GetPendingEvents(ctx context.Context) ([]Event, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT " + eventColumns + " FROM events WHERE event_status = ? AND deleted_at = '' ORDER BY event_id"
+	rows, err := db.QueryContext(ctx, query, EventStatusDraft)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,259 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var allStatuses = []EventStatus{
+	EventStatusDraft,
+	EventStatusScheduled,
+	EventStatusOpen,
+	EventStatusClosed,
+	EventStatusCompleted,
+	EventStatusCancelled,
+}
+
+// addTestEvent adds an event from alice and moves it through the statuses given, approving it
+// as bob when it's scheduled
+func addTestEvent(t *testing.T, ctx context.Context, statuses ...EventStatus) int {
+	t.Helper()
+
+	eventID, err := CreateEvent(ctx, Event{
+		EventLocation: "Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00", TotalSeats: 2,
+		OpenDatetime: "01/03/2027 09:00:00", CloseDatetime: "08/03/2027 18:00:00", CreatedBy: "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range statuses {
+		if status == EventStatusScheduled {
+			_, err = ApproveEvent(ctx, eventID, "bob")
+		} else {
+			_, err = TransitionEvent(ctx, eventID, status)
+		}
+		if err != nil {
+			t.Fatalf("failed to move event to %s: %v", status, err)
+		}
+	}
+	return eventID
+}
+
+func storedEvent(t *testing.T, ctx context.Context, eventID int) *Event {
+	t.Helper()
+
+	event, err := GetEventByID(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func TestTransitionEvent(t *testing.T) {
+	ctx := useTestDatabase(t)
+
+	tests := []struct {
+		name string
+		path []EventStatus
+		to   EventStatus
+		err  error
+	}{
+		{name: "draft needs approval", to: EventStatusScheduled, err: ErrApprovalRequired},
+		{name: "draft can't open", to: EventStatusOpen, err: ErrInvalidTransition},
+		{name: "draft cancelled", to: EventStatusCancelled},
+		{name: "scheduled opens", path: []EventStatus{EventStatusScheduled}, to: EventStatusOpen},
+		{name: "scheduled closes", path: []EventStatus{EventStatusScheduled}, to: EventStatusClosed},
+		{name: "scheduled can't complete", path: []EventStatus{EventStatusScheduled}, to: EventStatusCompleted, err: ErrInvalidTransition},
+		{name: "open closes", path: []EventStatus{EventStatusScheduled, EventStatusOpen}, to: EventStatusClosed},
+		{name: "open can't complete", path: []EventStatus{EventStatusScheduled, EventStatusOpen}, to: EventStatusCompleted, err: ErrInvalidTransition},
+		{name: "open can't go back", path: []EventStatus{EventStatusScheduled, EventStatusOpen}, to: EventStatusScheduled, err: ErrInvalidTransition},
+		{name: "closed completes", path: []EventStatus{EventStatusScheduled, EventStatusOpen, EventStatusClosed}, to: EventStatusCompleted},
+		{name: "closed reopens", path: []EventStatus{EventStatusScheduled, EventStatusOpen, EventStatusClosed}, to: EventStatusOpen},
+		{name: "completed is finished", path: []EventStatus{EventStatusScheduled, EventStatusClosed, EventStatusCompleted}, to: EventStatusOpen, err: ErrInvalidTransition},
+		{name: "cancelled is finished", path: []EventStatus{EventStatusCancelled}, to: EventStatusOpen, err: ErrInvalidTransition},
+		{name: "cancelled once", path: []EventStatus{EventStatusCancelled}, to: EventStatusCancelled, err: ErrInvalidTransition},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventID := addTestEvent(t, ctx, test.path...)
+			from := storedEvent(t, ctx, eventID).EventStatus
+
+			event, err := TransitionEvent(ctx, eventID, test.to)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+
+			want := test.to
+			if test.err != nil {
+				want = from
+			} else if event.EventStatus != test.to {
+				t.Errorf("returned status = %s, want %s", event.EventStatus, test.to)
+			}
+			if status := storedEvent(t, ctx, eventID).EventStatus; status != want {
+				t.Errorf("stored status = %s, want %s", status, want)
+			}
+		})
+	}
+
+	if _, err := TransitionEvent(ctx, 999, EventStatusOpen); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("error = %v for a missing event, want %v", err, ErrEventNotFound)
+	}
+}
+
+func TestApproveEvent(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID := addTestEvent(t, ctx)
+
+	for _, approver := range []string{"", "alice", "ALICE"} {
+		if _, err := ApproveEvent(ctx, eventID, approver); !errors.Is(err, ErrSelfApproval) {
+			t.Errorf("approving as %q: error = %v, want %v", approver, err, ErrSelfApproval)
+		}
+	}
+	if event := storedEvent(t, ctx, eventID); event.EventStatus != EventStatusDraft || event.ApprovedBy != "" {
+		t.Fatalf("event is %s approved by %q after being refused", event.EventStatus, event.ApprovedBy)
+	}
+
+	if _, err := ApproveEvent(ctx, eventID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	event := storedEvent(t, ctx, eventID)
+	if event.EventStatus != EventStatusScheduled || event.ApprovedBy != "bob" || event.ApprovedAt == "" {
+		t.Errorf("event is %s approved by %q at %q, want scheduled by bob", event.EventStatus, event.ApprovedBy, event.ApprovedAt)
+	}
+
+	if _, err := ApproveEvent(ctx, eventID, "carol"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("approving twice: error = %v, want %v", err, ErrInvalidTransition)
+	}
+	if event := storedEvent(t, ctx, eventID); event.ApprovedBy != "bob" {
+		t.Errorf("approved by %q after approving twice, want bob", event.ApprovedBy)
+	}
+}
+
+func TestApproveEventWithoutCreator(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID, err := CreateEvent(ctx, Event{EventLocation: "Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00", TotalSeats: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ApproveEvent(ctx, eventID, "bob"); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("error = %v, want %v", err, ErrSelfApproval)
+	}
+	if status := storedEvent(t, ctx, eventID).EventStatus; status != EventStatusDraft {
+		t.Errorf("status = %s, want it left a draft", status)
+	}
+}
+
+func TestCancelEvent(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID := addTestEvent(t, ctx, EventStatusScheduled, EventStatusOpen)
+
+	if _, err := CancelEvent(ctx, eventID, "Wall flooded"); err != nil {
+		t.Fatal(err)
+	}
+	event := storedEvent(t, ctx, eventID)
+	if event.EventStatus != EventStatusCancelled || event.CancellationReason != "Wall flooded" || event.CancelledAt == "" {
+		t.Errorf("event is %s with reason %q at %q, want it cancelled", event.EventStatus, event.CancellationReason, event.CancelledAt)
+	}
+
+	if _, err := CancelEvent(ctx, eventID, "Again"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("cancelling twice: error = %v, want %v", err, ErrInvalidTransition)
+	}
+	if event := storedEvent(t, ctx, eventID); event.CancellationReason != "Wall flooded" {
+		t.Errorf("reason = %q after cancelling twice, want the first", event.CancellationReason)
+	}
+}
+
+func TestReopenEvent(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID := addTestEvent(t, ctx, EventStatusScheduled, EventStatusOpen)
+
+	if _, err := ReopenEvent(ctx, eventID, "09/03/2027 18:00:00"); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("reopening an open event: error = %v, want %v", err, ErrInvalidTransition)
+	}
+	if event := storedEvent(t, ctx, eventID); event.CloseDatetime != "08/03/2027 18:00:00" {
+		t.Errorf("close = %s after a refused reopen, want it unchanged", event.CloseDatetime)
+	}
+
+	if _, err := TransitionEvent(ctx, eventID, EventStatusClosed); err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"open", "close"} {
+		if _, err := ClaimJob(ctx, eventID, kind, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ReopenEvent(ctx, eventID, "09/03/2027 18:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	event := storedEvent(t, ctx, eventID)
+	if event.EventStatus != EventStatusOpen || event.CloseDatetime != "09/03/2027 18:00:00" {
+		t.Errorf("event is %s closing %s, want it open until the new close", event.EventStatus, event.CloseDatetime)
+	}
+
+	// The close has to run again, nothing else does
+	completed, err := GetCompletedJobs(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed["close"] || !completed["open"] {
+		t.Errorf("claims = %v, want only the close released", completed)
+	}
+}
+
+func TestTransitionsReachCompletion(t *testing.T) {
+	// Every status that isn't finished must lead to completed or cancelled, so no event is stuck
+	for _, from := range allStatuses {
+		if from == EventStatusCompleted || from == EventStatusCancelled {
+			if len(transitions[from]) != 0 {
+				t.Errorf("%s is finished but can move to %v", from, transitions[from])
+			}
+			continue
+		}
+
+		seen := map[EventStatus]bool{from: true}
+		queue := []EventStatus{from}
+		for len(queue) > 0 {
+			status := queue[0]
+			queue = queue[1:]
+			for _, next := range transitions[status] {
+				if !seen[next] {
+					seen[next] = true
+					queue = append(queue, next)
+				}
+			}
+		}
+		if !seen[EventStatusCompleted] || !seen[EventStatusCancelled] {
+			t.Errorf("%s can't reach both completed and cancelled", from)
+		}
+	}
+}
+
+func TestStatusSignups(t *testing.T) {
+	tests := []struct {
+		status    EventStatus
+		accepting bool
+		closed    bool
+	}{
+		{EventStatusDraft, false, false},
+		{EventStatusScheduled, true, false},
+		{EventStatusOpen, true, false},
+		{EventStatusClosed, false, true},
+		{EventStatusCompleted, false, true},
+		{EventStatusCancelled, false, false},
+	}
+
+	for _, test := range tests {
+		if got := test.status.AcceptingRegistrations(); got != test.accepting {
+			t.Errorf("%s: AcceptingRegistrations = %t, want %t", test.status, got, test.accepting)
+		}
+		if got := test.status.SignupsClosed(); got != test.closed {
+			t.Errorf("%s: SignupsClosed = %t, want %t", test.status, got, test.closed)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package database
+
+import "log/slog"
+
+var logger = slog.Default()
+
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
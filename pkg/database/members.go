@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/names"
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// MemberDateFormat is how membership expiry dates are stored
+const MemberDateFormat = "2006-01-02"
+
+var ErrMemberNotFound = errors.New("member not found")
+
+// Member is an entry in the students' union membership roster
+type Member struct {
+	MemberID  int    `db:"member_id" json:"member_id"`
+	FirstName string `db:"first_name" json:"first_name"`
+	LastName  string `db:"surname" json:"last_name"`
+	StudentID string `db:"student_id" json:"student_id"`
+	Email     string `db:"email" json:"email"`
+	ExpiresAt string `db:"expires_at" json:"expires_at"`
+}
+
+// Active reports whether the membership is still valid at the given time, memberships lasting
+// until the end of their expiry day
+func (m Member) Active(now time.Time) bool {
+	expiry, err := time.ParseInLocation(MemberDateFormat, m.ExpiresAt, time.Local)
+	if err != nil {
+		return false
+	}
+	return now.Before(expiry.AddDate(0, 0, 1))
+}
+
+const memberColumns = "member_id, first_name, surname, student_id, email, expires_at"
+
+func scanMember(row rowScanner) (Member, error) {
+	var member Member
+	err := row.Scan(
+		&member.MemberID,
+		&member.FirstName,
+		&member.LastName,
+		&member.StudentID,
+		&member.Email,
+		&member.ExpiresAt,
+	)
+	return member, err
+}
+
+// ReplaceMembers swaps the whole roster for a new import, so anyone missing from the latest
+// students' union export stops being a member
+func ReplaceMembers(ctx context.Context, members []Member) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM members"); err != nil {
+		return fmt.Errorf("failed to execute DELETE statement: %v", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO members (first_name, surname, student_id, email, expires_at, first_name_key, surname_key) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare INSERT statement: %v", err)
+	}
+	defer stmt.Close()
+
+	for _, member := range members {
+		member.FirstName = names.Normalise(member.FirstName)
+		member.LastName = names.Normalise(member.LastName)
+		_, err := stmt.ExecContext(ctx, member.FirstName, member.LastName, member.StudentID, member.Email, member.ExpiresAt, names.Fold(member.FirstName), names.Fold(member.LastName))
+		if err != nil {
+			return fmt.Errorf("failed to add member %s %s: %v", member.FirstName, member.LastName, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetMembers(ctx context.Context) ([]Member, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "SELECT "+memberColumns+" FROM members ORDER BY surname, first_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func CountMembers(ctx context.Context) (int, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM members").Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// FindMember looks someone up on the roster, by email when one is given and otherwise by name.
+// Names are compared in their folded form, so "ÉLODIE" on the roster matches someone registering
+// as "Élodie". When several entries match the one with the latest expiry is returned.
+func FindMember(ctx context.Context, firstName string, surname string, email string) (*Member, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if email != "" {
+		query := "SELECT " + memberColumns + " FROM members WHERE email = ? COLLATE NOCASE ORDER BY expires_at DESC LIMIT 1"
+		member, err := scanMember(db.QueryRowContext(ctx, query, email))
+		if err == nil {
+			return &member, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+
+	query := "SELECT " + memberColumns + " FROM members WHERE first_name_key = ? AND surname_key = ? ORDER BY expires_at DESC LIMIT 1"
+	member, err := scanMember(db.QueryRowContext(ctx, query, names.Fold(firstName), names.Fold(surname)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// foldMemberNames fills in the folded names of roster entries imported before names were matched
+// on them
+func foldMemberNames(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT member_id, first_name, surname FROM members WHERE first_name_key = '' AND surname_key = ''")
+	if err != nil {
+		return err
+	}
+	var unfolded []Member
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.MemberID, &member.FirstName, &member.LastName); err != nil {
+			rows.Close()
+			return err
+		}
+		unfolded = append(unfolded, member)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, member := range unfolded {
+		firstName, surname := names.Normalise(member.FirstName), names.Normalise(member.LastName)
+		query := "UPDATE members SET first_name = ?, surname = ?, first_name_key = ?, surname_key = ? WHERE member_id = ?"
+		if _, err := tx.ExecContext(ctx, query, firstName, surname, names.Fold(firstName), names.Fold(surname), member.MemberID); err != nil {
+			return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetMembershipFlag records why a participant's membership needs checking by an admin
+func SetMembershipFlag(ctx context.Context, participantID int, flag string) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "UPDATE participants SET membership_flag = ? WHERE participant_id = ?", flag, participantID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+var (
+	ErrPersonNotFound = errors.New("person not found")
+	ErrMergeConflict  = errors.New("both people are registered for the same event")
+)
+
+// Person is someone who has registered for at least one event, linking their registrations
+// across events
+type Person struct {
+	PersonID      int    `db:"person_id" json:"person_id"`
+	FirstName     string `db:"first_name" json:"first_name"`
+	LastName      string `db:"surname" json:"last_name"`
+	PreferredName string `db:"preferred_name" json:"preferred_name"`
+	Email         string `db:"email" json:"email"`
+	StudentID     string `db:"student_id" json:"student_id"`
+	CreatedAt     string `db:"created_at" json:"created_at"`
+	// QualifiedDriver is set by the committee for people allowed to offer to drive
+	QualifiedDriver bool `db:"qualified_driver" json:"qualified_driver"`
+}
+
+// PersonSummary is a person along with totals across every event they have registered for
+type PersonSummary struct {
+	Person
+	Registrations int    `json:"registrations"`
+	Attended      int    `json:"attended"`
+	NoShows       int    `json:"no_shows"`
+	LastEventDate string `json:"last_session_date"`
+}
+
+const personColumns = "person_id, first_name, surname, preferred_name, email, student_id, created_at, qualified_driver"
+
+func scanPerson(row rowScanner) (Person, error) {
+	var person Person
+	err := row.Scan(
+		&person.PersonID,
+		&person.FirstName,
+		&person.LastName,
+		&person.PreferredName,
+		&person.Email,
+		&person.StudentID,
+		&person.CreatedAt,
+		&person.QualifiedDriver,
+	)
+	return person, err
+}
+
+// querier is the part of *sql.DB and *sql.Tx used to look people up, so a person can be
+// resolved inside the same transaction as the registration that needs them
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// findPerson matches a registrant to an existing person by email, then student ID, then name.
+// A name only matches when it is unambiguous and doesn't contradict an email or student ID
+// the registrant gave.
+func findPerson(ctx context.Context, q querier, registrant Registrant) (int, error) {
+	var personID int
+
+	if registrant.Email != "" {
+		err := q.QueryRowContext(ctx, "SELECT person_id FROM people WHERE email = ? COLLATE NOCASE", registrant.Email).Scan(&personID)
+		if err == nil {
+			return personID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+
+	if registrant.StudentID != "" {
+		err := q.QueryRowContext(ctx, "SELECT person_id FROM people WHERE student_id = ?", registrant.StudentID).Scan(&personID)
+		if err == nil {
+			return personID, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+
+	query := `
+		SELECT person_id FROM people
+		WHERE first_name = ? COLLATE NOCASE AND surname = ? COLLATE NOCASE
+			AND (? = '' OR email = '')
+			AND (? = '' OR student_id = '')
+		LIMIT 2
+	`
+	rows, err := q.QueryContext(ctx, query, registrant.FirstName, registrant.LastName, registrant.Email, registrant.StudentID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var matches []int
+	for rows.Next() {
+		if err := rows.Scan(&personID); err != nil {
+			return 0, err
+		}
+		matches = append(matches, personID)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(matches) != 1 {
+		return 0, ErrPersonNotFound
+	}
+	return matches[0], nil
+}
+
+// resolvePerson finds the person a registrant is, creating them if they are new. Nothing checks a
+// registration is made by the person it matches, so an existing person is only linked to and
+// never changed. Records that need correcting are left to the committee's MergePeople.
+func resolvePerson(ctx context.Context, q querier, registrant Registrant) (int, error) {
+	personID, err := findPerson(ctx, q, registrant)
+	if err == nil {
+		return personID, nil
+	}
+	if !errors.Is(err, ErrPersonNotFound) {
+		return 0, err
+	}
+
+	reminders := registrant.Reminders == nil || *registrant.Reminders
+	query := "INSERT INTO people (first_name, surname, preferred_name, email, student_id, reminder_emails, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	res, err := q.ExecContext(ctx, query, registrant.FirstName, registrant.LastName, registrant.PreferredName, registrant.Email, registrant.StudentID, reminders, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute INSERT statement: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// FindPerson returns the ID of the person a registrant matches without creating anyone
+func FindPerson(ctx context.Context, registrant Registrant) (int, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return findPerson(ctx, db, registrant)
+}
+
+func GetPersonByID(ctx context.Context, personID int) (*Person, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	person, err := scanPerson(db.QueryRowContext(ctx, "SELECT "+personColumns+" FROM people WHERE person_id = ?", personID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &person, nil
+}
+
+// GetPeople returns everyone who has registered for an event with their attendance totals,
+// most recently created first
+func GetPeople(ctx context.Context) ([]PersonSummary, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+		SELECT pe.person_id, pe.first_name, pe.surname, pe.preferred_name, pe.email, pe.student_id, pe.created_at, pe.qualified_driver,
+			COUNT(pa.participant_id),
+			COALESCE(SUM(pa.attendance = ?), 0),
+			COALESCE(SUM(pa.attendance = ?), 0),
+			COALESCE((SELECT e.event_date FROM participants lp JOIN events e ON e.event_id = lp.event_id
+				WHERE lp.person_id = pe.person_id ORDER BY lp.participant_id DESC LIMIT 1), '')
+		FROM people pe
+		LEFT JOIN participants pa ON pa.person_id = pe.person_id
+		GROUP BY pe.person_id
+		ORDER BY pe.person_id DESC
+	`
+	rows, err := db.QueryContext(ctx, query, AttendanceAttended, AttendanceNoShow)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []PersonSummary{}
+	for rows.Next() {
+		var summary PersonSummary
+		if err := rows.Scan(
+			&summary.PersonID,
+			&summary.FirstName,
+			&summary.LastName,
+			&summary.PreferredName,
+			&summary.Email,
+			&summary.StudentID,
+			&summary.CreatedAt,
+			&summary.QualifiedDriver,
+			&summary.Registrations,
+			&summary.Attended,
+			&summary.NoShows,
+			&summary.LastEventDate,
+		); err != nil {
+			return nil, err
+		}
+		people = append(people, summary)
+	}
+
+	return people, rows.Err()
+}
+
+// MergePeople moves every registration from one person onto another and removes the first,
+// for when the same person has ended up with two records. Email and student ID are kept from
+// the person merged into unless they didn't have one.
+func MergePeople(ctx context.Context, fromID int, intoID int) error {
+	if fromID == intoID {
+		return errors.New("cannot merge a person into themselves")
+	}
+
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	from, err := scanPerson(tx.QueryRowContext(ctx, "SELECT "+personColumns+" FROM people WHERE person_id = ?", fromID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPersonNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := scanPerson(tx.QueryRowContext(ctx, "SELECT "+personColumns+" FROM people WHERE person_id = ?", intoID)); errors.Is(err, sql.ErrNoRows) {
+		return ErrPersonNotFound
+	} else if err != nil {
+		return err
+	}
+
+	var shared int
+	query := "SELECT COUNT(*) FROM participants a JOIN participants b ON a.event_id = b.event_id WHERE a.person_id = ? AND b.person_id = ?"
+	if err := tx.QueryRowContext(ctx, query, fromID, intoID).Scan(&shared); err != nil {
+		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if shared > 0 {
+		return ErrMergeConflict
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE participants SET person_id = ? WHERE person_id = ?", intoID, fromID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE driver_offers SET person_id = ? WHERE person_id = ?", intoID, fromID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	// Anyone who turned reminders off on either record keeps them off
+	query = "UPDATE people SET reminder_emails = MIN(reminder_emails, (SELECT reminder_emails FROM people WHERE person_id = ?)) WHERE person_id = ?"
+	if _, err := tx.ExecContext(ctx, query, fromID, intoID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	// The old record goes first so its email and student ID are free to move across
+	if _, err := tx.ExecContext(ctx, "DELETE FROM people WHERE person_id = ?", fromID); err != nil {
+		return fmt.Errorf("failed to execute DELETE statement: %v", err)
+	}
+
+	query = `
+		UPDATE people SET
+			email = CASE WHEN email = '' THEN ? ELSE email END,
+			student_id = CASE WHEN student_id = '' THEN ? ELSE student_id END,
+			qualified_driver = MAX(qualified_driver, ?)
+		WHERE person_id = ?
+	`
+	if _, err := tx.ExecContext(ctx, query, from.Email, from.StudentID, from.QualifiedDriver, intoID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// linkParticipants attaches registrations made before people were tracked to a person,
+// oldest first so each person keeps the name they first registered with
+func linkParticipants(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, "SELECT participant_id, first_name, surname, email FROM participants WHERE person_id = 0 ORDER BY participant_id")
+	if err != nil {
+		return err
+	}
+
+	type unlinked struct {
+		participantID int
+		registrant    Registrant
+	}
+	var participants []unlinked
+	for rows.Next() {
+		var p unlinked
+		if err := rows.Scan(&p.participantID, &p.registrant.FirstName, &p.registrant.LastName, &p.registrant.Email); err != nil {
+			rows.Close()
+			return err
+		}
+		participants = append(participants, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range participants {
+		personID, err := resolvePerson(ctx, tx, p.registrant)
+		if err != nil {
+			return fmt.Errorf("failed to link participant %d: %v", p.participantID, err)
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE participants SET person_id = ? WHERE participant_id = ?", personID, p.participantID); err != nil {
+			return fmt.Errorf("failed to link participant %d: %v", p.participantID, err)
+		}
+	}
+
+	if len(participants) > 0 {
+		logger.InfoContext(ctx, "Linked existing registrations to people", "participants", len(participants))
+	}
+
+	return tx.Commit()
+}
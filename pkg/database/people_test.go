@@ -0,0 +1,193 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+// addTestPerson adds a person directly, as they would be after registering before
+func addTestPerson(t *testing.T, ctx context.Context, first, last, email, studentID string) int {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	query := "INSERT INTO people (first_name, surname, email, student_id, created_at) VALUES (?, ?, ?, ?, '')"
+	res, err := db.ExecContext(ctx, query, first, last, email, studentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(id)
+}
+
+func TestFindPerson(t *testing.T) {
+	ctx := useTestDatabase(t)
+	alex := addTestPerson(t, ctx, "Alex", "Smith", "alex@example.com", "")
+	sam := addTestPerson(t, ctx, "Sam", "Jones", "", "12345")
+	robin := addTestPerson(t, ctx, "Robin", "Brown", "", "")
+	addTestPerson(t, ctx, "Jo", "Bloggs", "", "")
+	addTestPerson(t, ctx, "Jo", "Bloggs", "", "")
+
+	tests := []struct {
+		name       string
+		registrant Registrant
+		want       int
+	}{
+		{name: "email", registrant: Registrant{FirstName: "Alexander", LastName: "Smith", Email: "alex@example.com"}, want: alex},
+		{name: "email in another case", registrant: Registrant{Email: "ALEX@example.com"}, want: alex},
+		{name: "student ID", registrant: Registrant{FirstName: "Samuel", LastName: "Jones", StudentID: "12345"}, want: sam},
+		{name: "name", registrant: Registrant{FirstName: "robin", LastName: "BROWN"}, want: robin},
+		{name: "name of someone without an email", registrant: Registrant{FirstName: "Robin", LastName: "Brown", Email: "robin@example.com"}, want: robin},
+		{name: "name with another email", registrant: Registrant{FirstName: "Alex", LastName: "Smith", Email: "other@example.com"}},
+		{name: "name with another student ID", registrant: Registrant{FirstName: "Sam", LastName: "Jones", StudentID: "99999"}},
+		{name: "name shared by two people", registrant: Registrant{FirstName: "Jo", LastName: "Bloggs"}},
+		{name: "nobody", registrant: Registrant{FirstName: "Nobody", LastName: "Here"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			personID, err := FindPerson(ctx, test.registrant)
+			if test.want == 0 {
+				if !errors.Is(err, ErrPersonNotFound) {
+					t.Errorf("found person %d, error %v, want %v", personID, err, ErrPersonNotFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if personID != test.want {
+				t.Errorf("found person %d, want %d", personID, test.want)
+			}
+		})
+	}
+}
+
+func TestRegisteringDoesNotChangePeople(t *testing.T) {
+	ctx := useTestDatabase(t)
+	alexID := addTestPerson(t, ctx, "Alex", "Smith", "", "")
+	eventID, err := CreateEvent(ctx, Event{EventLocation: "Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00", TotalSeats: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := GetEventByID(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone registers under Alex's name with their own details
+	off := false
+	participant, err := event.AddParticipant(ctx, Registrant{
+		FirstName: "Alex", LastName: "Smith", PreferredName: "Al",
+		Email: "someone@example.com", StudentID: "55555", Reminders: &off,
+	}, Allocation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if participant.PersonID != alexID {
+		t.Fatalf("registration linked to person %d, want %d", participant.PersonID, alexID)
+	}
+
+	alex, err := GetPersonByID(ctx, alexID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alex.PreferredName != "" || alex.Email != "" || alex.StudentID != "" {
+		t.Errorf("registration changed Alex to %+v", alex)
+	}
+	if reminders, err := ReminderEmails(ctx, alexID); err != nil || !reminders {
+		t.Errorf("registration turned Alex's reminders off: %v", err)
+	}
+
+	// A new person does get the choice they made
+	participant, err = event.AddParticipant(ctx, Registrant{FirstName: "Sam", LastName: "Jones", Email: "sam@example.com", Reminders: &off}, Allocation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reminders, err := ReminderEmails(ctx, participant.PersonID); err != nil || reminders {
+		t.Errorf("new person's reminders = %t, want off: %v", reminders, err)
+	}
+}
+
+func TestMergePeople(t *testing.T) {
+	ctx := useTestDatabase(t)
+	into := addTestPerson(t, ctx, "Alex", "Smith", "alex@example.com", "")
+	from := addTestPerson(t, ctx, "Alexander", "Smith", "alexander@example.com", "12345")
+	other := addTestPerson(t, ctx, "Sam", "Jones", "sam@example.com", "")
+
+	if err := SetReminderEmails(ctx, from, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetQualifiedDriver(ctx, from, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alexander registered for the first event and Alex and Sam for the second
+	var events []*Event
+	for i := 0; i < 2; i++ {
+		eventID, err := CreateEvent(ctx, Event{EventLocation: "Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00", TotalSeats: 4})
+		if err != nil {
+			t.Fatal(err)
+		}
+		event, err := GetEventByID(ctx, eventID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	register := func(event *Event, registrant Registrant) {
+		t.Helper()
+		if _, err := event.AddParticipant(ctx, registrant, Allocation{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	register(events[0], Registrant{FirstName: "Alexander", LastName: "Smith", Email: "alexander@example.com"})
+	register(events[1], Registrant{FirstName: "Alex", LastName: "Smith", Email: "alex@example.com"})
+	register(events[1], Registrant{FirstName: "Sam", LastName: "Jones", Email: "sam@example.com"})
+
+	if err := MergePeople(ctx, into, into); err == nil {
+		t.Errorf("merging someone into themselves should fail")
+	}
+	if err := MergePeople(ctx, 999, into); !errors.Is(err, ErrPersonNotFound) {
+		t.Errorf("merging a missing person: error = %v, want %v", err, ErrPersonNotFound)
+	}
+	// Alex and Sam are both registered for the second event, so can't be the same person
+	if err := MergePeople(ctx, other, into); !errors.Is(err, ErrMergeConflict) {
+		t.Errorf("merging people at the same event: error = %v, want %v", err, ErrMergeConflict)
+	}
+
+	if err := MergePeople(ctx, from, into); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetPersonByID(ctx, from); !errors.Is(err, ErrPersonNotFound) {
+		t.Errorf("merged person still exists: %v", err)
+	}
+	person, err := GetPersonByID(ctx, into)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if person.Email != "alex@example.com" || person.StudentID != "12345" || !person.QualifiedDriver {
+		t.Errorf("merged person = %+v, want Alex's email with Alexander's student ID and driving", person)
+	}
+	if reminders, err := ReminderEmails(ctx, into); err != nil || reminders {
+		t.Errorf("reminders = %t, want them kept off: %v", reminders, err)
+	}
+
+	history, err := GetAttendanceHistory(ctx, into)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Records) != 2 {
+		t.Errorf("merged person has %d registrations, want 2", len(history.Records))
+	}
+}
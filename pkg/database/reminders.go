@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+var ErrRegistrationNotFound = errors.New("registration not found")
+
+// CancelToken returns the secret token that lets a participant cancel their own registration
+// from a link in their emails, creating one the first time it is asked for
+func CancelToken(ctx context.Context, participantID int) (string, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var token string
+	err = db.QueryRowContext(ctx, "SELECT cancel_token FROM participants WHERE participant_id = ?", participantID).Scan(&token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrRegistrationNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if token != "" {
+		return token, nil
+	}
+
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("failed to generate cancel token: %v", err)
+	}
+	token = hex.EncodeToString(buffer)
+
+	// Only set the token if another request hasn't just done so, then read back whichever won
+	if _, err := db.ExecContext(ctx, "UPDATE participants SET cancel_token = ? WHERE participant_id = ? AND cancel_token = ''", token, participantID); err != nil {
+		return "", fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if err := db.QueryRowContext(ctx, "SELECT cancel_token FROM participants WHERE participant_id = ?", participantID).Scan(&token); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// GetParticipantByCancelToken returns the registration a cancel link was made for
+func GetParticipantByCancelToken(ctx context.Context, token string) (*Participant, error) {
+	if token == "" {
+		return nil, ErrRegistrationNotFound
+	}
+
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT " + participantColumns + " FROM participants WHERE cancel_token = ?"
+	participant, err := scanParticipant(db.QueryRowContext(ctx, query, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRegistrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &participant, nil
+}
+
+// GetReminderRecipients returns the participants with a seat or driving who still need a
+// reminder, leaving out anyone who has turned reminders off or has no email address
+func GetReminderRecipients(ctx context.Context, eventID int, reminder string) ([]Participant, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := `
+		SELECT ` + participantColumns + ` FROM participants
+		WHERE event_id = ? AND seat_status IN (?, ?) AND email != ''
+			AND person_id NOT IN (SELECT person_id FROM people WHERE reminder_emails = 0)
+			AND participant_id NOT IN (SELECT participant_id FROM sent_reminders WHERE reminder = ?)
+		ORDER BY participant_id
+	`
+	rows, err := db.QueryContext(ctx, query, eventID, SeatConfirmed, SeatDriver, reminder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	defer rows.Close()
+
+	var participants []Participant
+	for rows.Next() {
+		participant, err := scanParticipant(rows)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, participant)
+	}
+	return participants, rows.Err()
+}
+
+// MarkReminderSent records that a participant has been sent a reminder, so a retried reminder
+// job doesn't email them twice
+func MarkReminderSent(ctx context.Context, participantID int, reminder string) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	query := "INSERT OR IGNORE INTO sent_reminders (participant_id, reminder, sent_at) VALUES (?, ?, ?)"
+	if _, err := db.ExecContext(ctx, query, participantID, reminder, time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to execute INSERT statement: %v", err)
+	}
+	return nil
+}
+
+// ReminderEmails reports whether a person wants reminders before their sessions
+func ReminderEmails(ctx context.Context, personID int) (bool, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	var enabled bool
+	err = db.QueryRowContext(ctx, "SELECT reminder_emails FROM people WHERE person_id = ?", personID).Scan(&enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrPersonNotFound
+	}
+	return enabled, err
+}
+
+// SetReminderEmails turns reminders before sessions on or off for a person
+func SetReminderEmails(ctx context.Context, personID int, enabled bool) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res, err := db.ExecContext(ctx, "UPDATE people SET reminder_emails = ? WHERE person_id = ?", enabled, personID)
+	if err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// Path is the SQLite database everything is stored in
+var Path = "/home/pi/climbing-society-seats-app/database.db"
+
+// Statements that set up a new database or bring an existing one up to the schema this version of
+// the app expects. Each statement must be safe to run repeatedly.
+var schemaStatements = []string{
+	// The tables from the initial release, later columns are added by schemaColumns
+	`CREATE TABLE IF NOT EXISTS users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT UNIQUE,
+		password_hash TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS events (
+		event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_location TEXT,
+		event_date TEXT,
+		meet_location TEXT,
+		meet_time TEXT,
+		total_seats INTEGER,
+		seats_taken INTEGER DEFAULT 0,
+		require_member BOOLEAN,
+		open_datetime TEXT,
+		close_datetime TEXT,
+		event_status INTEGER DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS participants (
+		participant_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER,
+		first_name TEXT,
+		surname TEXT,
+		member BOOLEAN
+	)`,
+	`CREATE TABLE IF NOT EXISTS scheduled_jobs (
+		event_id INTEGER NOT NULL,
+		job_kind TEXT NOT NULL,
+		run_at TEXT NOT NULL,
+		completed_at TEXT NOT NULL,
+		PRIMARY KEY (event_id, job_kind)
+	)`,
+	`CREATE TABLE IF NOT EXISTS members (
+		member_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		first_name TEXT NOT NULL,
+		surname TEXT NOT NULL,
+		student_id TEXT NOT NULL DEFAULT '',
+		email TEXT NOT NULL DEFAULT '',
+		expires_at TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS members_name ON members (first_name COLLATE NOCASE, surname COLLATE NOCASE)`,
+	`CREATE INDEX IF NOT EXISTS members_email ON members (email COLLATE NOCASE)`,
+	`CREATE TABLE IF NOT EXISTS people (
+		person_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		first_name TEXT NOT NULL,
+		surname TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		student_id TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS vehicles (
+		vehicle_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		name TEXT NOT NULL DEFAULT '',
+		driver_name TEXT NOT NULL,
+		driver_email TEXT NOT NULL DEFAULT '',
+		capacity INTEGER NOT NULL,
+		departure_point TEXT NOT NULL DEFAULT '',
+		driver_notified INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS vehicles_event ON vehicles (event_id)`,
+	`CREATE TABLE IF NOT EXISTS driver_offers (
+		offer_id INTEGER PRIMARY KEY AUTOINCREMENT,
+		event_id INTEGER NOT NULL,
+		person_id INTEGER NOT NULL,
+		first_name TEXT NOT NULL,
+		surname TEXT NOT NULL,
+		email TEXT NOT NULL DEFAULT '',
+		vehicle_name TEXT NOT NULL DEFAULT '',
+		capacity INTEGER NOT NULL,
+		departure_point TEXT NOT NULL DEFAULT '',
+		status INTEGER NOT NULL DEFAULT 0,
+		vehicle_id INTEGER NOT NULL DEFAULT 0,
+		offered_at TEXT NOT NULL,
+		decided_at TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS driver_offers_event ON driver_offers (event_id)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS people_email ON people (email COLLATE NOCASE) WHERE email != ''`,
+	`CREATE INDEX IF NOT EXISTS people_name ON people (first_name COLLATE NOCASE, surname COLLATE NOCASE)`,
+	`CREATE TABLE IF NOT EXISTS sent_reminders (
+		participant_id INTEGER NOT NULL,
+		reminder TEXT NOT NULL,
+		sent_at TEXT NOT NULL,
+		PRIMARY KEY (participant_id, reminder)
+	)`,
+}
+
+// Statements that depend on columns from schemaColumns, run once those have been added
+var schemaIndexes = []string{
+	`CREATE INDEX IF NOT EXISTS participants_person ON participants (person_id)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS people_calendar_token ON people (calendar_token) WHERE calendar_token != ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS participants_cancel_token ON participants (cancel_token) WHERE cancel_token != ''`,
+	`CREATE INDEX IF NOT EXISTS events_session_start ON events (session_start)`,
+	`CREATE INDEX IF NOT EXISTS events_status_start ON events (event_status, session_start)`,
+	`CREATE INDEX IF NOT EXISTS members_name_key ON members (first_name_key, surname_key)`,
+}
+
+// Columns added to existing tables after the initial release, applied only when missing
+var schemaColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"participants", "attendance", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "attendance_updated_at", "TEXT"},
+	{"participants", "seat_status", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "priority", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "allocation_reason", "TEXT NOT NULL DEFAULT ''"},
+	{"participants", "cooldown", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "registered_at", "TEXT NOT NULL DEFAULT ''"},
+	{"participants", "email", "TEXT NOT NULL DEFAULT ''"},
+	{"participants", "outcome_notified", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "membership_flag", "TEXT NOT NULL DEFAULT ''"},
+	{"participants", "person_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "preferred_name", "TEXT NOT NULL DEFAULT ''"},
+	{"participants", "vehicle_id", "INTEGER NOT NULL DEFAULT 0"},
+	{"participants", "cancel_token", "TEXT NOT NULL DEFAULT ''"},
+	{"members", "first_name_key", "TEXT NOT NULL DEFAULT ''"},
+	{"members", "surname_key", "TEXT NOT NULL DEFAULT ''"},
+	{"people", "preferred_name", "TEXT NOT NULL DEFAULT ''"},
+	{"people", "calendar_token", "TEXT NOT NULL DEFAULT ''"},
+	{"people", "qualified_driver", "INTEGER NOT NULL DEFAULT 0"},
+	{"people", "reminder_emails", "INTEGER NOT NULL DEFAULT 1"},
+	{"events", "allocation_mode", "TEXT NOT NULL DEFAULT 'fcfs'"},
+	{"events", "ballot_weighted", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "ballot_seed", "INTEGER NOT NULL DEFAULT 0"},
+	{"events", "ballot_drawn_at", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "cancellation_reason", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "cancelled_at", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "deleted_at", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "created_by", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "approved_by", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "approved_at", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "meet_at", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "session_start", "TEXT NOT NULL DEFAULT ''"},
+	{"events", "session_end", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func Migrate(ctx context.Context) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for _, statement := range schemaStatements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to apply schema statement: %v", err)
+		}
+	}
+
+	for _, c := range schemaColumns {
+		exists, err := columnExists(ctx, db, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", c.table, c.column, err)
+		}
+	}
+
+	for _, statement := range schemaIndexes {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to apply schema statement: %v", err)
+		}
+	}
+
+	unreadable, err := migrateEventTimes(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate event times: %v", err)
+	}
+	for _, event := range unreadable {
+		logger.WarnContext(ctx, "Event date or meet time can't be read, it has no session times until it's corrected", "event_id", event.EventID, "event_date", event.EventDate, "meet_time", event.MeetTime)
+	}
+
+	if err := foldMemberNames(ctx, db); err != nil {
+		return fmt.Errorf("failed to fold member names: %v", err)
+	}
+
+	return linkParticipants(ctx, db)
+}
+
+func columnExists(ctx context.Context, db *sql.DB, table string, column string) (bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name         string
+			columnType   string
+			notNull      bool
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
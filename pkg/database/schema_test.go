@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// useTestDatabase points the package at a new database for the rest of the test
+func useTestDatabase(t *testing.T) context.Context {
+	t.Helper()
+
+	previous := Path
+	Path = filepath.Join(t.TempDir(), "database.db")
+	t.Cleanup(func() { Path = previous })
+
+	ctx := context.Background()
+	if err := Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return ctx
+}
+
+func TestMigrateTwice(t *testing.T) {
+	ctx := useTestDatabase(t)
+	if err := Migrate(ctx); err != nil {
+		t.Fatalf("second migration failed: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 
@@ -15,21 +16,21 @@ type User struct {
 	PasswordHash string
 }
 
-func GetUserFromDatabaseByUsername(username string) (*User, error) {
-	db, err := sql.Open("sqlite", "/home/pi/climbing-society-seats-app/database.db")
+func GetUserFromDatabaseByUsername(ctx context.Context, username string) (*User, error) {
+	db, err := sql.Open("sqlite", Path)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
 
 	query := "SELECT id, username, password_hash FROM users WHERE username = ?"
-	stmt, err := db.Prepare(query)
+	stmt, err := db.PrepareContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(username)
+	row := stmt.QueryRowContext(ctx, username)
 
 	var user User
 	err = row.Scan(
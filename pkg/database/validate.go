@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DateFormat is how event dates are entered on the dashboard
+	DateFormat = "02/01/2006"
+	// MeetTimeFormat is how meet times are entered on the dashboard
+	MeetTimeFormat = "15:04"
+)
+
+// EventValidationError lists everything wrong with an event so it can all be fixed at once
+type EventValidationError struct {
+	Problems []string
+}
+
+func (e *EventValidationError) Error() string {
+	return "invalid event: " + strings.Join(e.Problems, ", ")
+}
+
+// Validate checks an event has everything needed to open signups for it, when it is created and
+// each time it is edited
+func (e *Event) Validate() error {
+	var problems []string
+
+	if strings.TrimSpace(e.EventLocation) == "" {
+		problems = append(problems, "location is required")
+	}
+	if _, err := time.Parse(DateFormat, e.EventDate); err != nil {
+		problems = append(problems, fmt.Sprintf("date %q must be dd/mm/yyyy", e.EventDate))
+	}
+	if strings.TrimSpace(e.MeetLocation) == "" {
+		problems = append(problems, "meet location is required")
+	}
+	if _, err := time.Parse(MeetTimeFormat, e.MeetTime); err != nil {
+		problems = append(problems, fmt.Sprintf("meet time %q must be hh:mm", e.MeetTime))
+	}
+	if e.TotalSeats < 1 {
+		problems = append(problems, "total seats must be at least 1")
+	}
+
+	openTime, openErr := e.OpenTime()
+	if openErr != nil {
+		problems = append(problems, fmt.Sprintf("open time %q must be dd/mm/yyyy hh:mm:ss", e.OpenDatetime))
+	}
+	closeTime, closeErr := e.CloseTime()
+	if closeErr != nil {
+		problems = append(problems, fmt.Sprintf("close time %q must be dd/mm/yyyy hh:mm:ss", e.CloseDatetime))
+	}
+	if openErr == nil && closeErr == nil && !closeTime.After(openTime) {
+		problems = append(problems, "close time must be after open time")
+	}
+
+	if e.AllocationMode != "" && !e.AllocationMode.Valid() {
+		problems = append(problems, fmt.Sprintf("unknown allocation mode %q", e.AllocationMode))
+	}
+
+	if len(problems) > 0 {
+		return &EventValidationError{Problems: problems}
+	}
+	return nil
+}
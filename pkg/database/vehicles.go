@@ -0,0 +1,401 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/glebarez/go-sqlite"
+)
+
+var (
+	ErrVehicleNotFound = errors.New("vehicle not found")
+	ErrVehicleFull     = errors.New("vehicle is full")
+	ErrNotEnoughSeats  = errors.New("the vehicles wouldn't have enough seats for everyone already given one")
+	ErrNotSeated       = errors.New("only participants with a seat can be put in a vehicle")
+)
+
+// Vehicle is a car or minibus taking participants to an event. When an event has vehicles its
+// total seats are the sum of their capacities.
+type Vehicle struct {
+	VehicleID      int    `db:"vehicle_id" json:"vehicle_id"`
+	EventID        int    `db:"event_id" json:"event_id"`
+	Name           string `db:"name" json:"name"`
+	DriverName     string `db:"driver_name" json:"driver_name"`
+	DriverEmail    string `db:"driver_email" json:"driver_email"`
+	Capacity       int    `db:"capacity" json:"capacity"`
+	DeparturePoint string `db:"departure_point" json:"departure_point"`
+	DriverNotified bool   `db:"driver_notified" json:"driver_notified"`
+	Passengers     int    `json:"passengers"`
+}
+
+// Label is what to call the vehicle, its name or otherwise whose car it is
+func (v Vehicle) Label() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return v.DriverName + "'s car"
+}
+
+// Validate checks the details the committee enters for a vehicle. Capacity is passenger seats,
+// not counting the driver.
+func (v *Vehicle) Validate() error {
+	var problems []string
+	if strings.TrimSpace(v.DriverName) == "" {
+		problems = append(problems, "driver name is required")
+	}
+	if v.Capacity < 1 {
+		problems = append(problems, "capacity must be at least 1")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid vehicle: %s", strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+const vehicleColumns = "vehicle_id, event_id, name, driver_name, driver_email, capacity, departure_point, driver_notified"
+
+// Passengers are counted alongside each vehicle so the dashboard can show how full it is
+var vehiclePassengers = fmt.Sprintf("(SELECT COUNT(*) FROM participants p WHERE p.vehicle_id = vehicles.vehicle_id AND p.seat_status = %d)", SeatConfirmed)
+
+func scanVehicle(row rowScanner) (Vehicle, error) {
+	var vehicle Vehicle
+	err := row.Scan(
+		&vehicle.VehicleID,
+		&vehicle.EventID,
+		&vehicle.Name,
+		&vehicle.DriverName,
+		&vehicle.DriverEmail,
+		&vehicle.Capacity,
+		&vehicle.DeparturePoint,
+		&vehicle.DriverNotified,
+		&vehicle.Passengers,
+	)
+	return vehicle, err
+}
+
+func GetEventVehicles(ctx context.Context, eventID int) ([]Vehicle, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return getEventVehicles(ctx, db, eventID)
+}
+
+func getEventVehicles(ctx context.Context, q querier, eventID int) ([]Vehicle, error) {
+	query := "SELECT " + vehicleColumns + ", " + vehiclePassengers + " FROM vehicles WHERE event_id = ? ORDER BY vehicle_id"
+	rows, err := q.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := []Vehicle{}
+	for rows.Next() {
+		vehicle, err := scanVehicle(rows)
+		if err != nil {
+			return nil, err
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+
+	return vehicles, rows.Err()
+}
+
+func GetVehicleByID(ctx context.Context, vehicleID int) (*Vehicle, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	query := "SELECT " + vehicleColumns + ", " + vehiclePassengers + " FROM vehicles WHERE vehicle_id = ?"
+	vehicle, err := scanVehicle(db.QueryRowContext(ctx, query, vehicleID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVehicleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &vehicle, nil
+}
+
+// syncVehicleSeats sets an event's total seats to what its vehicles hold, refusing the change if
+// that would be fewer than the seats already taken. Events without vehicles are left alone.
+func syncVehicleSeats(ctx context.Context, tx *sql.Tx, eventID int) error {
+	query := `
+		UPDATE events SET total_seats = (SELECT SUM(capacity) FROM vehicles WHERE event_id = ?)
+		WHERE event_id = ? AND EXISTS (SELECT 1 FROM vehicles WHERE event_id = ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, eventID, eventID, eventID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	var totalSeats, seatsTaken int
+	err := tx.QueryRowContext(ctx, "SELECT total_seats, seats_taken FROM events WHERE event_id = ?", eventID).Scan(&totalSeats, &seatsTaken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.New("event not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if totalSeats < seatsTaken {
+		return ErrNotEnoughSeats
+	}
+
+	return nil
+}
+
+// AddVehicle adds a vehicle to an event and returns its ID
+func AddVehicle(ctx context.Context, vehicle Vehicle) (int, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	vehicleID, err := insertVehicle(ctx, tx, vehicle)
+	if err != nil {
+		return 0, err
+	}
+
+	return vehicleID, tx.Commit()
+}
+
+// insertVehicle adds a vehicle and updates its event's total seats to match
+func insertVehicle(ctx context.Context, tx *sql.Tx, vehicle Vehicle) (int, error) {
+	query := "INSERT INTO vehicles (event_id, name, driver_name, driver_email, capacity, departure_point) VALUES (?, ?, ?, ?, ?, ?)"
+	res, err := tx.ExecContext(ctx, query, vehicle.EventID, vehicle.Name, vehicle.DriverName, vehicle.DriverEmail, vehicle.Capacity, vehicle.DeparturePoint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute INSERT statement: %v", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := syncVehicleSeats(ctx, tx, vehicle.EventID); err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+// UpdateVehicle changes a vehicle's details. Its capacity can't drop below the passengers
+// already assigned to it.
+func UpdateVehicle(ctx context.Context, vehicleID int, vehicle Vehicle) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var eventID, passengers int
+	query := "SELECT event_id, " + vehiclePassengers + " FROM vehicles WHERE vehicle_id = ?"
+	err = tx.QueryRowContext(ctx, query, vehicleID).Scan(&eventID, &passengers)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVehicleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+	if vehicle.Capacity < passengers {
+		return fmt.Errorf("%w, %d passengers are already assigned to it", ErrVehicleFull, passengers)
+	}
+
+	query = "UPDATE vehicles SET name = ?, driver_name = ?, driver_email = ?, capacity = ?, departure_point = ? WHERE vehicle_id = ?"
+	if _, err := tx.ExecContext(ctx, query, vehicle.Name, vehicle.DriverName, vehicle.DriverEmail, vehicle.Capacity, vehicle.DeparturePoint, vehicleID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	if err := syncVehicleSeats(ctx, tx, eventID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteVehicle removes a vehicle, leaving its passengers without one. When the last vehicle is
+// removed the event keeps its total seats, which can then be set by hand again.
+func DeleteVehicle(ctx context.Context, vehicleID int) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var eventID int
+	err = tx.QueryRowContext(ctx, "SELECT event_id FROM vehicles WHERE vehicle_id = ?", vehicleID).Scan(&eventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVehicleNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute SELECT statement: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE participants SET vehicle_id = 0 WHERE vehicle_id = ?", vehicleID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM vehicles WHERE vehicle_id = ?", vehicleID); err != nil {
+		return fmt.Errorf("failed to execute DELETE statement: %v", err)
+	}
+	// A driver whose vehicle is removed is no longer driving, so joins the waitlist for a seat
+	query := `
+		UPDATE participants SET seat_status = ?
+		WHERE event_id = ? AND seat_status = ?
+			AND person_id IN (SELECT person_id FROM driver_offers WHERE vehicle_id = ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, SeatWaitlisted, eventID, SeatDriver, vehicleID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+	query = "UPDATE driver_offers SET status = ?, vehicle_id = 0, decided_at = ? WHERE vehicle_id = ?"
+	if _, err := tx.ExecContext(ctx, query, OfferWithdrawn, time.Now().Format(time.RFC3339), vehicleID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	if err := syncVehicleSeats(ctx, tx, eventID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AssignVehicle puts a seated participant in a vehicle on their event, or takes them out of
+// one when vehicleID is 0
+func AssignVehicle(ctx context.Context, participantID int, vehicleID int) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	participant, err := scanParticipant(tx.QueryRowContext(ctx, "SELECT "+participantColumns+" FROM participants WHERE participant_id = ?", participantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrParticipantNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if vehicleID != 0 {
+		if participant.SeatStatus != SeatConfirmed {
+			return ErrNotSeated
+		}
+
+		var capacity, passengers int
+		query := "SELECT capacity, " + vehiclePassengers + " FROM vehicles WHERE vehicle_id = ? AND event_id = ?"
+		err := tx.QueryRowContext(ctx, query, vehicleID, participant.EventID).Scan(&capacity, &passengers)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVehicleNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to execute SELECT statement: %v", err)
+		}
+		if participant.VehicleID != vehicleID && passengers >= capacity {
+			return ErrVehicleFull
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE participants SET vehicle_id = ? WHERE participant_id = ?", vehicleID, participantID); err != nil {
+		return fmt.Errorf("failed to execute UPDATE statement: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// AutoAssignVehicles puts every seated participant without a vehicle into one with space, in
+// the order they were given seats, filling each vehicle before the next. It returns how many
+// were assigned.
+func AutoAssignVehicles(ctx context.Context, eventID int) (int, error) {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	vehicles, err := getEventVehicles(ctx, tx, eventID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := "SELECT participant_id FROM participants WHERE event_id = ? AND seat_status = ? AND vehicle_id = 0 ORDER BY " + participantOrder
+	rows, err := tx.QueryContext(ctx, query, eventID, SeatConfirmed)
+	if err != nil {
+		return 0, err
+	}
+	var unassigned []int
+	for rows.Next() {
+		var participantID int
+		if err := rows.Scan(&participantID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		unassigned = append(unassigned, participantID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	assigned := 0
+	for i := range vehicles {
+		for vehicles[i].Passengers < vehicles[i].Capacity && assigned < len(unassigned) {
+			if _, err := tx.ExecContext(ctx, "UPDATE participants SET vehicle_id = ? WHERE participant_id = ?", vehicles[i].VehicleID, unassigned[assigned]); err != nil {
+				return 0, fmt.Errorf("failed to execute UPDATE statement: %v", err)
+			}
+			vehicles[i].Passengers++
+			assigned++
+		}
+	}
+
+	return assigned, tx.Commit()
+}
+
+// MarkDriverNotified records that a driver has been sent their passenger list
+func MarkDriverNotified(ctx context.Context, vehicleID int) error {
+	db, err := sql.Open("sqlite", Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, "UPDATE vehicles SET driver_notified = 1 WHERE vehicle_id = ?", vehicleID)
+	return err
+}
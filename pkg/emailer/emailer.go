@@ -1,21 +1,28 @@
 package emailer
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
 	"os"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/metrics"
 )
 
 func getEmailLoginCredentials() (email, password string) {
 	return os.Getenv("SENDER_EMAIL"), os.Getenv("SENDER_PASSWORD")
 }
 
-func SendEmail(address, subject, message string) error {
-	from, password := getEmailLoginCredentials()
+func SendEmail(ctx context.Context, address, subject, message string) error {
+	err := sendEmail(ctx, address, subject, message)
+	metrics.EmailsTotal.WithLabelValues(metrics.Result(err)).Inc()
+	return err
+}
 
-	to := []string{
-		address,
-	}
+func sendEmail(ctx context.Context, address, subject, message string) error {
+	from, password := getEmailLoginCredentials()
 
 	smtpHost := "smtp.gmail.com"
 	smtpPort := "587"
@@ -25,10 +32,47 @@ func SendEmail(address, subject, message string) error {
 
 	auth := smtp.PlainAuth("", from, password, smtpHost)
 
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, to, messageBytes)
+	// Dial ourselves rather than using smtp.SendMail so the send can be abandoned with the context
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", smtpHost+":"+smtpPort)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, smtpHost)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.StartTLS(&tls.Config{ServerName: smtpHost}); err != nil {
+		return err
+	}
+	if err := client.Auth(auth); err != nil {
+		return err
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(address); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
 	if err != nil {
 		return err
 	}
+	if _, err := writer.Write(messageBytes); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
 
-	return nil
+	return client.Quit()
 }
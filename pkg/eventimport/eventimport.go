@@ -0,0 +1,334 @@
+package eventimport
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/allocation"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"gopkg.in/yaml.v3"
+)
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatYAML Format = "yaml"
+)
+
+// FormatFor picks the format of a schedule from its file name, or its content type when it was
+// sent without one
+func FormatFor(filename string, contentType string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	}
+
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return FormatCSV, nil
+	case strings.Contains(contentType, "yaml"):
+		return FormatYAML, nil
+	}
+
+	return "", errors.New("unknown schedule format, use a .csv or .yaml file")
+}
+
+// Row is one event read from a schedule, along with anything that stopped it being read
+type Row struct {
+	Line     int
+	Event    database.Event
+	Problems []string
+}
+
+// Parse reads every event from a schedule. A file that can't be read at all is an error, while
+// problems with individual rows are recorded on the row so they can all be reported together.
+func Parse(r io.Reader, format Format) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatYAML:
+		return parseYAML(r)
+	default:
+		return nil, fmt.Errorf("unknown schedule format %q", format)
+	}
+}
+
+// Column names accepted in a CSV schedule, lower case with underscores as spaces. Both the API
+// field names and the headers of the events export are accepted so an export can be edited and
+// imported again.
+var csvColumns = map[string][]string{
+	"session_location": {"session location", "location", "event location"},
+	"session_date":     {"session date", "date", "event date"},
+	"meet_point":       {"meet point", "meet location"},
+	"meet_time":        {"meet time"},
+	"total_seats":      {"total seats", "seats"},
+	"require_member":   {"require member", "members only"},
+	"open_date":        {"open date", "open time", "opens"},
+	"close_date":       {"close date", "close time", "closes"},
+	"allocation_mode":  {"allocation mode", "allocation"},
+	"ballot_weighted":  {"ballot weighted", "weighted ballot"},
+}
+
+var requiredColumns = []string{"session_location", "session_date", "meet_point", "meet_time", "total_seats", "open_date", "close_date"}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("schedule is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule header: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		name = strings.ReplaceAll(name, "_", " ")
+		for field, aliases := range csvColumns {
+			for _, alias := range aliases {
+				if name == alias {
+					columns[field] = i
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, field := range requiredColumns {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("schedule is missing columns: %s", strings.Join(missing, ", "))
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schedule: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{
+			Line: line,
+			Event: database.Event{
+				EventLocation:  value("session_location"),
+				EventDate:      value("session_date"),
+				MeetLocation:   value("meet_point"),
+				MeetTime:       value("meet_time"),
+				OpenDatetime:   value("open_date"),
+				CloseDatetime:  value("close_date"),
+				AllocationMode: database.AllocationMode(strings.ToLower(value("allocation_mode"))),
+			},
+		}
+
+		if seats, err := strconv.Atoi(value("total_seats")); err != nil {
+			row.Problems = append(row.Problems, fmt.Sprintf("total seats %q must be a number", value("total_seats")))
+		} else {
+			row.Event.TotalSeats = seats
+		}
+		if row.Event.RequireMember, err = parseBool(value("require_member")); err != nil {
+			row.Problems = append(row.Problems, fmt.Sprintf("require member: %v", err))
+		}
+		if row.Event.BallotWeighted, err = parseBool(value("ballot_weighted")); err != nil {
+			row.Problems = append(row.Problems, fmt.Sprintf("ballot weighted: %v", err))
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// parseBool reads the yes/no columns of a schedule, where empty means no
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "no", "n", "false", "0":
+		return false, nil
+	case "yes", "y", "true", "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%q must be yes or no", value)
+	}
+}
+
+// yamlEvent is an event in a YAML schedule, using the same field names as the API
+type yamlEvent struct {
+	EventLocation  string `yaml:"session_location"`
+	EventDate      string `yaml:"session_date"`
+	MeetLocation   string `yaml:"meet_point"`
+	MeetTime       string `yaml:"meet_time"`
+	TotalSeats     int    `yaml:"total_seats"`
+	RequireMember  bool   `yaml:"require_member"`
+	OpenDatetime   string `yaml:"open_date"`
+	CloseDatetime  string `yaml:"close_date"`
+	AllocationMode string `yaml:"allocation_mode"`
+	BallotWeighted bool   `yaml:"ballot_weighted"`
+}
+
+// parseYAML reads a schedule that is either a list of events or a map with an events list
+func parseYAML(r io.Reader) ([]Row, error) {
+	var document yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&document); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("schedule is empty")
+		}
+		return nil, fmt.Errorf("failed to read schedule: %v", err)
+	}
+
+	if len(document.Content) == 0 {
+		return nil, errors.New("schedule is empty")
+	}
+	list := document.Content[0]
+	if list.Kind == yaml.MappingNode {
+		var events *yaml.Node
+		for i := 0; i+1 < len(list.Content); i += 2 {
+			if list.Content[i].Value == "events" {
+				events = list.Content[i+1]
+			}
+		}
+		if events == nil {
+			return nil, errors.New("schedule must be a list of events or have an events list")
+		}
+		list = events
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, errors.New("schedule must be a list of events or have an events list")
+	}
+
+	var rows []Row
+	for _, item := range list.Content {
+		row := Row{Line: item.Line}
+
+		var event yamlEvent
+		if err := item.Decode(&event); err != nil {
+			row.Problems = append(row.Problems, err.Error())
+		}
+		row.Event = database.Event{
+			EventLocation:  event.EventLocation,
+			EventDate:      event.EventDate,
+			MeetLocation:   event.MeetLocation,
+			MeetTime:       event.MeetTime,
+			TotalSeats:     event.TotalSeats,
+			RequireMember:  event.RequireMember,
+			OpenDatetime:   event.OpenDatetime,
+			CloseDatetime:  event.CloseDatetime,
+			AllocationMode: database.AllocationMode(strings.ToLower(event.AllocationMode)),
+			BallotWeighted: event.BallotWeighted,
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// RowResult is what happened to one event in a schedule
+type RowResult struct {
+	Line     int      `json:"line"`
+	EventID  int      `json:"event_id,omitempty"`
+	Location string   `json:"session_location"`
+	Date     string   `json:"session_date"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type Report struct {
+	DryRun  bool        `json:"dry_run"`
+	Valid   bool        `json:"valid"`
+	Created int         `json:"created"`
+	Rows    []RowResult `json:"rows"`
+}
+
+// Import validates every event in a schedule and, when they are all valid, creates them
+// together as drafts from createdBy. Nothing is created if any event is invalid or for a dry run.
+func Import(ctx context.Context, rows []Row, dryRun bool, createdBy string) (Report, error) {
+	report := Report{DryRun: dryRun, Valid: true, Rows: []RowResult{}}
+	if len(rows) == 0 {
+		return report, errors.New("schedule has no events")
+	}
+
+	seen := map[string]int{}
+	events := make([]database.Event, 0, len(rows))
+	for _, row := range rows {
+		result := RowResult{
+			Line:     row.Line,
+			Location: row.Event.EventLocation,
+			Date:     row.Event.EventDate,
+			Errors:   row.Problems,
+		}
+
+		if err := row.Event.Validate(); err != nil {
+			var validationErr *database.EventValidationError
+			if !errors.As(err, &validationErr) {
+				return report, err
+			}
+			result.Errors = append(result.Errors, validationErr.Problems...)
+		}
+
+		key := strings.ToLower(strings.Join([]string{row.Event.EventLocation, row.Event.EventDate, row.Event.MeetTime}, "|"))
+		if line, ok := seen[key]; ok {
+			result.Errors = append(result.Errors, fmt.Sprintf("same event as line %d", line))
+		}
+		seen[key] = row.Line
+
+		if len(result.Errors) > 0 {
+			report.Valid = false
+		}
+		report.Rows = append(report.Rows, result)
+
+		event := row.Event
+		event.CreatedBy = createdBy
+		if event.AllocationMode == database.AllocationBallot {
+			seed, err := allocation.NewSeed()
+			if err != nil {
+				return report, err
+			}
+			event.BallotSeed = seed
+		}
+		events = append(events, event)
+	}
+
+	if !report.Valid || dryRun {
+		return report, nil
+	}
+
+	eventIDs, err := database.CreateEvents(ctx, events)
+	if err != nil {
+		return report, err
+	}
+	for i, eventID := range eventIDs {
+		report.Rows[i].EventID = eventID
+	}
+	report.Created = len(eventIDs)
+
+	return report, nil
+}
@@ -0,0 +1,241 @@
+package eventimport
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+const csvHeader = "session_location,session_date,meet_point,meet_time,total_seats,open_date,close_date"
+
+func TestParseCSV(t *testing.T) {
+	schedule := "\ufeffLocation, Date, Meet Point, Meet Time, Seats, Opens, Closes, Members Only, Allocation, Weighted Ballot\n" +
+		"The Wall, 10/03/2027, Union, 18:00, 12, 01/03/2027 09:00:00, 08/03/2027 18:00:00, yes, Ballot, y\n" +
+		"\n" +
+		"The Arch, 17/03/2027, Union, 09:30, lots, 08/03/2027 09:00:00, 15/03/2027 18:00:00, maybe, , \n"
+
+	rows, err := Parse(strings.NewReader(schedule), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Row{
+		{
+			Line: 2,
+			Event: database.Event{
+				EventLocation: "The Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00",
+				TotalSeats: 12, OpenDatetime: "01/03/2027 09:00:00", CloseDatetime: "08/03/2027 18:00:00",
+				RequireMember: true, AllocationMode: database.AllocationBallot, BallotWeighted: true,
+			},
+		},
+		{
+			Line: 4,
+			Event: database.Event{
+				EventLocation: "The Arch", EventDate: "17/03/2027", MeetLocation: "Union", MeetTime: "09:30",
+				OpenDatetime: "08/03/2027 09:00:00", CloseDatetime: "15/03/2027 18:00:00",
+			},
+			Problems: []string{`total seats "lots" must be a number`, `require member: "maybe" must be yes or no`},
+		},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v\nwant %+v", rows, want)
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+	}{
+		{
+			name: "list",
+			schedule: `- session_location: The Wall
+  session_date: 10/03/2027
+  meet_point: Union
+  meet_time: "18:00"
+  total_seats: 12
+  open_date: 01/03/2027 09:00:00
+  close_date: 08/03/2027 18:00:00
+  allocation_mode: BALLOT
+- session_location: The Arch
+  total_seats: lots
+`,
+		},
+		{
+			name: "events list",
+			schedule: `events:
+- session_location: The Wall
+  session_date: 10/03/2027
+  meet_point: Union
+  meet_time: "18:00"
+  total_seats: 12
+  open_date: 01/03/2027 09:00:00
+  close_date: 08/03/2027 18:00:00
+  allocation_mode: BALLOT
+- session_location: The Arch
+  total_seats: lots
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := Parse(strings.NewReader(test.schedule), FormatYAML)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 2 {
+				t.Fatalf("got %d rows, want 2", len(rows))
+			}
+
+			offset := strings.Count(test.schedule[:strings.Index(test.schedule, "- ")], "\n")
+			want := database.Event{
+				EventLocation: "The Wall", EventDate: "10/03/2027", MeetLocation: "Union", MeetTime: "18:00",
+				TotalSeats: 12, OpenDatetime: "01/03/2027 09:00:00", CloseDatetime: "08/03/2027 18:00:00",
+				AllocationMode: database.AllocationBallot,
+			}
+			if rows[0].Line != offset+1 || !reflect.DeepEqual(rows[0].Event, want) || len(rows[0].Problems) > 0 {
+				t.Errorf("first row = %+v, want line %d with %+v", rows[0], offset+1, want)
+			}
+			if rows[1].Line != offset+9 || len(rows[1].Problems) != 1 {
+				t.Errorf("second row = %+v, want line %d with a problem", rows[1], offset+9)
+			}
+		})
+	}
+}
+
+func TestParseProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		schedule string
+		err      string
+	}{
+		{name: "empty CSV", format: FormatCSV, schedule: "", err: "schedule is empty"},
+		{name: "missing columns", format: FormatCSV, schedule: "location,date\nThe Wall,10/03/2027\n", err: "schedule is missing columns: meet_point, meet_time, total_seats, open_date, close_date"},
+		{name: "malformed CSV", format: FormatCSV, schedule: csvHeader + "\n\"The Wall,10/03/2027\n", err: "failed to read schedule: "},
+		{name: "empty YAML", format: FormatYAML, schedule: "", err: "schedule is empty"},
+		{name: "YAML without events", format: FormatYAML, schedule: "sessions: []\n", err: "schedule must be a list of events or have an events list"},
+		{name: "YAML scalar", format: FormatYAML, schedule: "events\n", err: "schedule must be a list of events or have an events list"},
+		{name: "unknown format", format: "xml", schedule: "<events/>", err: `unknown schedule format "xml"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.schedule), test.format)
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+// useTestDatabase points the database at a new file for the rest of the test
+func useTestDatabase(t *testing.T) context.Context {
+	t.Helper()
+
+	previous := database.Path
+	database.Path = filepath.Join(t.TempDir(), "database.db")
+	t.Cleanup(func() { database.Path = previous })
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return ctx
+}
+
+func parseTestSchedule(t *testing.T, lines ...string) []Row {
+	t.Helper()
+
+	rows, err := Parse(strings.NewReader(csvHeader+"\n"+strings.Join(lines, "\n")+"\n"), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func countEvents(t *testing.T, ctx context.Context) int {
+	t.Helper()
+
+	events, err := database.GetEvents(ctx, database.EventQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(events)
+}
+
+func TestImport(t *testing.T) {
+	ctx := useTestDatabase(t)
+	rows := parseTestSchedule(t,
+		"The Wall,10/03/2027,Union,18:00,12,01/03/2027 09:00:00,08/03/2027 18:00:00",
+		"The Arch,17/03/2027,Union,18:00,8,08/03/2027 09:00:00,15/03/2027 18:00:00",
+	)
+
+	report, err := Import(ctx, rows, true, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Created != 0 || countEvents(t, ctx) != 0 {
+		t.Fatalf("dry run report = %+v, with %d events created", report, countEvents(t, ctx))
+	}
+
+	report, err = Import(ctx, rows, false, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Created != 2 {
+		t.Fatalf("report = %+v, want both events created", report)
+	}
+	for _, row := range report.Rows {
+		event, err := database.GetEventByID(ctx, row.EventID)
+		if err != nil {
+			t.Fatalf("line %d: %v", row.Line, err)
+		}
+		if event.EventLocation != row.Location || event.EventStatus != database.EventStatusDraft || event.CreatedBy != "alice" {
+			t.Errorf("line %d created %+v, want a draft of %s from alice", row.Line, event, row.Location)
+		}
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := useTestDatabase(t)
+	rows := parseTestSchedule(t,
+		"The Wall,10/03/2027,Union,18:00,12,01/03/2027 09:00:00,08/03/2027 18:00:00",
+		"The Arch,17/03/2027,Union,18:00,0,08/03/2027 09:00:00,15/03/2027 18:00:00",
+		"the wall,10/03/2027,Car park,18:00,6,01/03/2027 09:00:00,08/03/2027 18:00:00",
+		"The Cave,24/03/2027,Union,18:00,lots,15/03/2027 09:00:00,22/03/2027 18:00:00",
+	)
+
+	report, err := Import(ctx, rows, false, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || report.Created != 0 {
+		t.Errorf("report = %+v, want it invalid with nothing created", report)
+	}
+	// One bad row stops the rest being created too
+	if count := countEvents(t, ctx); count != 0 {
+		t.Errorf("%d events created, want none", count)
+	}
+
+	want := map[int][]string{
+		2: nil,
+		3: {"total seats must be at least 1"},
+		4: {"same event as line 2"},
+		5: {`total seats "lots" must be a number`, "total seats must be at least 1"},
+	}
+	for _, row := range report.Rows {
+		if !reflect.DeepEqual(row.Errors, want[row.Line]) {
+			t.Errorf("line %d errors = %q, want %q", row.Line, row.Errors, want[row.Line])
+		}
+	}
+
+	if _, err := Import(ctx, nil, false, "alice"); err == nil {
+		t.Errorf("importing an empty schedule should fail")
+	}
+}
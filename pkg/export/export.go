@@ -0,0 +1,205 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+func (f Format) Valid() bool {
+	return f == FormatCSV || f == FormatXLSX
+}
+
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Table is a sheet of data to export. Cells are strings, ints or bools so spreadsheets get
+// numbers they can add up.
+type Table struct {
+	Name   string
+	Header []string
+	Rows   [][]any
+}
+
+// Write outputs the table in the given format
+func (t Table) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatCSV:
+		return t.writeCSV(w)
+	case FormatXLSX:
+		return t.writeXLSX(w)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func (t Table) writeCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(t.Header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(t.Header))
+	for _, row := range t.Rows {
+		for i, cell := range row {
+			record[i] = csvCell(cell)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCell formats a cell for CSV. Text that a spreadsheet would treat as a formula is prefixed
+// with an apostrophe, since names and locations come from outside the committee.
+func csvCell(cell any) string {
+	switch value := cell.(type) {
+	case int:
+		return strconv.Itoa(value)
+	case bool:
+		return yesNo(value)
+	case string:
+		if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+			return "'" + value
+		}
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// registeredAt shows a registration time in the same format as event times
+func registeredAt(value string) string {
+	registered, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return registered.In(time.Local).Format(database.DatetimeFormat)
+}
+
+// ParticipantsTable lists everyone registered for an event in the order seats were allocated
+func ParticipantsTable(event database.Event, participants []database.Participant) Table {
+	table := Table{
+		Name: fmt.Sprintf("Event %d", event.EventID),
+		Header: []string{
+			"#", "Participant ID", "Person ID", "Given Name", "Family Name", "Preferred Name", "Email",
+			"Member", "Membership Flag", "Seat Status", "Attendance", "Registered At", "Allocation Reason",
+		},
+	}
+
+	for i, participant := range participants {
+		table.Rows = append(table.Rows, []any{
+			i + 1,
+			participant.ParticipantID,
+			participant.PersonID,
+			participant.FirstName,
+			participant.LastName,
+			participant.PreferredName,
+			participant.Email,
+			participant.Member,
+			participant.MembershipFlag,
+			participant.SeatStatus.String(),
+			participant.Attendance.String(),
+			registeredAt(participant.RegisteredAt),
+			participant.AllocationReason,
+		})
+	}
+
+	return table
+}
+
+// EventsTable lists events with their seat counts
+func EventsTable(events []database.Event) Table {
+	table := Table{
+		Name: "Events",
+		Header: []string{
+			"Event ID", "Location", "Date", "Meet Location", "Meet Time", "Total Seats", "Seats Taken",
+			"Require Member", "Open Time", "Close Time", "Allocation",
+		},
+	}
+
+	for _, event := range events {
+		table.Rows = append(table.Rows, []any{
+			event.EventID,
+			event.EventLocation,
+			event.EventDate,
+			event.MeetLocation,
+			event.MeetTime,
+			event.TotalSeats,
+			event.SeatsTaken,
+			event.RequireMember,
+			event.OpenDatetime,
+			event.CloseDatetime,
+			string(event.AllocationMode),
+		})
+	}
+
+	return table
+}
+
+// EventsBetween returns the events whose date falls within from and to inclusive, where a zero
+// time leaves that end of the range open. Events with a date that can't be read are left out.
+func EventsBetween(events []database.Event, from time.Time, to time.Time) []database.Event {
+	var selected []database.Event
+	for _, event := range events {
+		date, err := time.ParseInLocation(database.DateFormat, event.EventDate, time.Local)
+		if err != nil {
+			continue
+		}
+		if !from.IsZero() && date.Before(from) {
+			continue
+		}
+		if !to.IsZero() && date.After(to) {
+			continue
+		}
+		selected = append(selected, event)
+	}
+	return selected
+}
+
+// ParseDateRange reads the from and to dates of an events export, given as YYYY-MM-DD. Either
+// can be empty to leave that end of the range open.
+func ParseDateRange(from string, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid from date %q, use YYYY-MM-DD", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.ParseInLocation("2006-01-02", to, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid to date %q, use YYYY-MM-DD", to)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return start, end, fmt.Errorf("to date %s is before from date %s", to, from)
+	}
+	return start, end, nil
+}
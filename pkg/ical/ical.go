@@ -0,0 +1,100 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	productID = "-//UoW Climbing Society//Seats App//EN"
+	// Lines longer than this many bytes must be folded onto continuation lines
+	maxLineLength = 75
+	utcFormat     = "20060102T150405Z"
+)
+
+type Event struct {
+	UID         string
+	Summary     string
+	Location    string
+	Description string
+	URL         string
+	Start       time.Time
+	End         time.Time
+	Cancelled   bool
+}
+
+// Write outputs a calendar of events as an RFC 5545 iCalendar file
+func Write(w io.Writer, name string, events []Event) error {
+	writer := bufio.NewWriter(w)
+	now := time.Now().UTC().Format(utcFormat)
+
+	line := func(name string, value string) {
+		writeFolded(writer, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", productID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", escapeText(name))
+
+	for _, event := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.UID)
+		line("DTSTAMP", now)
+		line("DTSTART", event.Start.UTC().Format(utcFormat))
+		line("DTEND", event.End.UTC().Format(utcFormat))
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Location != "" {
+			line("LOCATION", escapeText(event.Location))
+		}
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		if event.Cancelled {
+			line("STATUS", "CANCELLED")
+		} else {
+			line("STATUS", "CONFIRMED")
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return writer.Flush()
+}
+
+// escapeText escapes the characters with special meaning in iCalendar text values
+func escapeText(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// writeFolded writes a content line, folding it so no line is longer than 75 bytes without
+// splitting a multi-byte character
+func writeFolded(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n ", line[:cut])
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards their length
+		limit = maxLineLength - 1
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
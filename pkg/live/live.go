@@ -0,0 +1,158 @@
+package live
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+// Most streams open at once, so a link shared widely can't use up the Pi's connections
+const maxSubscribers = 500
+
+var ErrTooManySubscribers = errors.New("too many live updates open, try again later")
+
+// What happened to an event to send an update
+const (
+	// ChangeCurrent is the state sent when a stream starts, rather than a change
+	ChangeCurrent    = "current"
+	ChangeRegistered = "registered"
+	ChangeRemoved    = "removed"
+	ChangeUpdated    = "updated"
+	ChangeClosed     = "closed"
+	ChangeCancelled  = "cancelled"
+	ChangeDeleted    = "deleted"
+)
+
+// SeatUpdate is the state of an event's seats sent to everyone watching it
+type SeatUpdate struct {
+	EventID        int    `json:"event_id"`
+	Change         string `json:"change"`
+	TotalSeats     int    `json:"total_seats"`
+	SeatsTaken     int    `json:"current_seats"`
+	SeatsRemaining int    `json:"seats_remaining"`
+	Closed         bool   `json:"closed"`
+}
+
+var (
+	logger      = slog.Default()
+	mu          sync.Mutex
+	subscribers = map[int]map[chan SeatUpdate]struct{}{}
+	count       int
+	closed      bool
+)
+
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// Snapshot describes the seats of an event as they are now
+func Snapshot(event database.Event, change string) SeatUpdate {
+	return SeatUpdate{
+		EventID:        event.EventID,
+		Change:         change,
+		TotalSeats:     event.TotalSeats,
+		SeatsTaken:     event.SeatsTaken,
+		SeatsRemaining: max(event.TotalSeats-event.SeatsTaken, 0),
+		Closed:         !event.EventStatus.AcceptingRegistrations(),
+	}
+}
+
+// Subscribe returns a channel of updates to an event and a function to stop them. Only the latest
+// update is kept for a slow subscriber, since each one replaces the last. The channel is closed
+// when the event is deleted or the server shuts down.
+func Subscribe(eventID int) (<-chan SeatUpdate, func(), error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if closed {
+		return nil, nil, errors.New("server is shutting down")
+	}
+	if count >= maxSubscribers {
+		return nil, nil, ErrTooManySubscribers
+	}
+
+	updates := make(chan SeatUpdate, 1)
+	if subscribers[eventID] == nil {
+		subscribers[eventID] = map[chan SeatUpdate]struct{}{}
+	}
+	subscribers[eventID][updates] = struct{}{}
+	count++
+
+	unsubscribe := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		remove(eventID, updates)
+	}
+	return updates, unsubscribe, nil
+}
+
+// remove closes a subscriber's channel if it is still subscribed. mu must be held.
+func remove(eventID int, updates chan SeatUpdate) {
+	if _, ok := subscribers[eventID][updates]; !ok {
+		return
+	}
+	delete(subscribers[eventID], updates)
+	if len(subscribers[eventID]) == 0 {
+		delete(subscribers, eventID)
+	}
+	close(updates)
+	count--
+}
+
+// Publish reads an event's seats and sends them to everyone watching it. Failing to read the
+// event is only logged, since the change that caused the update has already been made.
+func Publish(ctx context.Context, eventID int, change string) {
+	mu.Lock()
+	watched := len(subscribers[eventID]) > 0
+	mu.Unlock()
+	if !watched {
+		return
+	}
+
+	if change == ChangeDeleted {
+		send(SeatUpdate{EventID: eventID, Change: change, Closed: true})
+		mu.Lock()
+		for updates := range subscribers[eventID] {
+			remove(eventID, updates)
+		}
+		mu.Unlock()
+		return
+	}
+
+	event, err := database.GetEventByID(ctx, eventID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to read event for live update", "event_id", eventID, "error", err)
+		return
+	}
+	send(Snapshot(*event, change))
+}
+
+func send(update SeatUpdate) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for updates := range subscribers[update.EventID] {
+		// Replace an update the subscriber hasn't read yet rather than waiting for them
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- update
+	}
+}
+
+// Close ends every stream so the server can shut down without waiting for them
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	closed = true
+	for eventID, watching := range subscribers {
+		for updates := range watching {
+			remove(eventID, updates)
+		}
+	}
+}
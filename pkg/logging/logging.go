@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type Config struct {
+	Level      string
+	Format     string
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+type contextKey struct{}
+
+// WithRequestID returns a context carrying the request ID, which is added to every log line
+// written with that context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
+
+// New builds a logger from the config. The returned closer must be closed on shutdown when
+// logging to a file.
+func New(config Config) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, nil, fmt.Errorf("invalid log level %q: %v", config.Level, err)
+	}
+
+	var output io.WriteCloser = nopCloser{os.Stderr}
+	if config.File != "" {
+		file, err := newRotatingFile(config.File, int64(config.MaxSizeMB)*1024*1024, config.MaxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %v", err)
+		}
+		output = file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "json":
+		handler = slog.NewJSONHandler(output, options)
+	case "text", "":
+		handler = slog.NewTextHandler(output, options)
+	default:
+		output.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q", config.Format)
+	}
+
+	return slog.New(requestIDHandler{handler}), output, nil
+}
+
+// requestIDHandler adds the request ID from the context to each record
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, want := range map[string]string{path: "third\n", path + ".1": "second\n", path + ".2": "first\n"} {
+		if got := readFile(t, file); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(file), got, want)
+		}
+	}
+}
+
+func TestRotateAfterMoveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := newRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// A directory where the backup goes stops the log being moved aside
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("second\n")); err == nil {
+		t.Fatalf("rotating onto a directory should fail")
+	}
+
+	// Once the way is clear the log carries on
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte("third\n")); err != nil {
+		t.Fatalf("log didn't recover: %v", err)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("log = %q, want %q", got, "third\n")
+	}
+	if got := readFile(t, path+".1"); got != "first\n" {
+		t.Errorf("backup = %q, want %q", got, "first\n")
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	seatsTakenDesc = prometheus.NewDesc(
+		"seats_event_seats_taken",
+		"Seats filled for each event that has not yet closed.",
+		[]string{"event_id"}, nil,
+	)
+	seatsTotalDesc = prometheus.NewDesc(
+		"seats_event_seats_total",
+		"Seats available for each event that has not yet closed.",
+		[]string{"event_id"}, nil,
+	)
+	collectorErrorsDesc = prometheus.NewDesc(
+		"seats_event_collector_errors",
+		"1 if reading events for the seat metrics failed on this scrape.",
+		nil, nil,
+	)
+)
+
+// seatsCollector reads seat counts from the database on each scrape so they are always in sync
+// with the events table, including after a restart
+type seatsCollector struct{}
+
+func (seatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- seatsTakenDesc
+	ch <- seatsTotalDesc
+	ch <- collectorErrorsDesc
+}
+
+func (seatsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	events, err := database.GetEvents(ctx, database.EventQuery{})
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(collectorErrorsDesc, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collectorErrorsDesc, prometheus.GaugeValue, 0)
+
+	for _, event := range events {
+		if !event.EventStatus.AcceptingRegistrations() {
+			continue
+		}
+		eventID := strconv.Itoa(event.EventID)
+		ch <- prometheus.MustNewConstMetric(seatsTakenDesc, prometheus.GaugeValue, float64(event.SeatsTaken), eventID)
+		ch <- prometheus.MustNewConstMetric(seatsTotalDesc, prometheus.GaugeValue, float64(event.TotalSeats), eventID)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(seatsCollector{})
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons a registration can be rejected, used as the reason label on RegistrationsTotal
+const (
+	ReasonNone         = ""
+	ReasonInvalidName  = "invalid_name"
+	ReasonInvalidEmail = "invalid_email"
+	ReasonClosed       = "closed"
+	ReasonNotMember    = "not_member"
+	ReasonFull         = "full"
+	ReasonDuplicate    = "duplicate"
+	ReasonCooldown     = "cooldown"
+	ReasonError        = "error"
+)
+
+var (
+	HTTPRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "seats_http_requests_total",
+		Help: "HTTP requests handled, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "seats_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	RegistrationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "seats_registrations_total",
+		Help: "Registration attempts, by event, outcome (accepted, waitlisted or rejected) and reason.",
+	}, []string{"event_id", "outcome", "reason"})
+
+	RegistrationDelay = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "seats_registration_delay_seconds",
+		Help:    "Time between signups opening and a registration being accepted, showing how fast seats fill.",
+		Buckets: []float64{1, 5, 15, 30, 60, 300, 900, 3600, 21600, 86400},
+	}, []string{"event_id"})
+
+	SchedulerJobsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "seats_scheduler_jobs_total",
+		Help: "Scheduler job runs, by job kind and result.",
+	}, []string{"job", "result"})
+
+	EmailsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "seats_emails_total",
+		Help: "Emails sent, by result.",
+	}, []string{"result"})
+
+	WebhooksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "seats_webhooks_total",
+		Help: "Webhook notifications sent, by kind and result.",
+	}, []string{"kind", "result"})
+)
+
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
@@ -0,0 +1,146 @@
+package names
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the longest name part accepted, in characters
+const MaxLength = 64
+
+// Joiners are part of the correct spelling of some names in Indic and Persian scripts
+const (
+	zeroWidthNonJoiner = '\u200c'
+	zeroWidthJoiner    = '\u200d'
+)
+
+var (
+	ErrEmpty   = errors.New("name is empty")
+	ErrTooLong = fmt.Errorf("name is longer than %d characters", MaxLength)
+)
+
+// Lower case words that stay lower case inside a family name, as in "van der Berg" or "da Silva"
+var particles = map[string]bool{
+	"al": true, "bin": true, "binti": true, "da": true, "das": true, "de": true, "del": true,
+	"della": true, "den": true, "der": true, "di": true, "do": true, "dos": true, "du": true,
+	"ibn": true, "la": true, "le": true, "ten": true, "ter": true, "van": true, "von": true,
+}
+
+// Normalise tidies a name as it was typed without changing its spelling: it is converted to
+// NFC so accented letters compare equal however they were entered, surrounding and repeated
+// whitespace is removed and typographic apostrophes become plain ones
+func Normalise(name string) string {
+	name = norm.NFC.String(name)
+	name = strings.NewReplacer("’", "'", "ʼ", "'", "‘", "'").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Fold is the form names are compared in to decide whether they match: the normalised name with
+// its case folded in every script, where a database's case-insensitive comparison only folds ASCII
+func Fold(name string) string {
+	return cases.Fold().String(Normalise(name))
+}
+
+// Validate checks a normalised name part is something a person could be called. Letters and
+// combining marks from any script are allowed, separated by single spaces, hyphens or
+// apostrophes, and a full stop may follow a letter as in "St. John".
+func Validate(name string) error {
+	if name == "" {
+		return ErrEmpty
+	}
+	if utf8.RuneCountInString(name) > MaxLength {
+		return ErrTooLong
+	}
+
+	var previous rune
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+		case unicode.Is(unicode.M, r) || r == zeroWidthNonJoiner || r == zeroWidthJoiner:
+			if i == 0 {
+				return fmt.Errorf("name can't start with %q", r)
+			}
+		case r == ' ' || r == '-' || r == '\'':
+			if i == 0 {
+				return fmt.Errorf("name can't start with %q", r)
+			}
+			if isSeparator(previous) {
+				return fmt.Errorf("name can't have %q after %q", r, previous)
+			}
+		case r == '.':
+			if !unicode.IsLetter(previous) {
+				return errors.New("a full stop can only follow a letter")
+			}
+		default:
+			return fmt.Errorf("name can't contain %q", r)
+		}
+		previous = r
+	}
+
+	if isSeparator(previous) {
+		return fmt.Errorf("name can't end with %q", previous)
+	}
+
+	return nil
+}
+
+func isSeparator(r rune) bool {
+	return r == ' ' || r == '-' || r == '\''
+}
+
+// Capitalise fixes the case of a name typed all in lower or upper case. A name with any mix of
+// cases is assumed to be deliberate and kept as it is, so McDonald or van der Berg survive.
+func Capitalise(name string) string {
+	hasUpper, hasLower := false, false
+	for _, r := range name {
+		hasUpper = hasUpper || unicode.IsUpper(r)
+		hasLower = hasLower || unicode.IsLower(r)
+	}
+	if hasUpper && hasLower {
+		return name
+	}
+	if !hasUpper && !hasLower {
+		// Scripts without case, like Chinese or Arabic, have nothing to fix
+		return name
+	}
+
+	words := strings.Split(strings.ToLower(name), " ")
+	for i, word := range words {
+		if i > 0 && particles[word] {
+			continue
+		}
+		words[i] = capitaliseWord(word)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// capitaliseWord upper cases the first letter of each hyphenated part, the letter after a one
+// letter prefix like O' or D', and the letter after a leading Mc, giving Smith-Jones, O'Brien
+// and McDonald
+func capitaliseWord(word string) string {
+	runes := []rune(word)
+	partStart := 0
+	for i, r := range runes {
+		switch {
+		case r == '-':
+			partStart = i + 1
+		case i == partStart && unicode.IsLetter(r):
+			runes[i] = unicode.ToTitle(r)
+		case i == partStart+2 && runes[i-1] == '\'' && unicode.IsLetter(r):
+			runes[i] = unicode.ToTitle(r)
+		}
+	}
+
+	if len(runes) > 3 && runes[0] == 'M' && runes[1] == 'c' {
+		runes[2] = unicode.ToTitle(runes[2])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,70 @@
+package names
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"SMITH", "Smith"},
+		{"ÉLODIE", "élodie"},
+		{"E\u0301lodie", "\u00c9lodie"},
+		{"O’BRIEN", "O'Brien"},
+		{"  van  der Berg ", "Van Der Berg"},
+		{"STRAUSS", "Strauß"},
+		{"ΣΩΚΡΆΤΗΣ", "σωκράτης"},
+	}
+
+	for _, test := range tests {
+		if Fold(test.a) != Fold(test.b) {
+			t.Errorf("Fold(%q) = %q, Fold(%q) = %q, want them equal", test.a, Fold(test.a), test.b, Fold(test.b))
+		}
+	}
+
+	if Fold("Smith") == Fold("Smyth") {
+		t.Errorf("different names folded the same")
+	}
+}
+
+// TestCorpus runs real-world names from many cultures and scripts, along with inputs that must be
+// rejected, through Normalise, Validate and Capitalise
+func TestCorpus(t *testing.T) {
+	file, err := os.Open("testdata/corpus.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read name corpus: %v", err)
+	}
+
+	for _, record := range records[1:] {
+		input, expected := record[0], record[2]
+		wantValid, err := strconv.ParseBool(record[1])
+		if err != nil {
+			t.Fatalf("invalid corpus entry %q: %v", input, err)
+		}
+
+		t.Run(input, func(t *testing.T) {
+			name := Normalise(input)
+			err := Validate(name)
+			if valid := err == nil; valid != wantValid {
+				t.Fatalf("valid = %t, want %t (%v)", valid, wantValid, err)
+			}
+			if !wantValid {
+				return
+			}
+
+			if got := Capitalise(name); got != expected {
+				t.Errorf("normalised to %q, want %q", got, expected)
+			}
+		})
+	}
+}
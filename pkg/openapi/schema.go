@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"encoding"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	valuesType        = reflect.TypeOf((*interface{ Values() []string })(nil)).Elem()
+)
+
+// Schema describes the JSON v is sent as, following the same rules as encoding/json. Named
+// structs are added to the document's components and referred to from where they are used.
+func (d *Document) Schema(v any) *Schema {
+	return d.schema(reflect.TypeOf(v), false)
+}
+
+// Input describes a request body bound into v. Handlers leave missing fields empty, so nothing is
+// required unless it has a binding:"required" tag, and unknown fields are ignored. Named structs
+// are added to the components with an Input suffix so they don't clash with the same type sent
+// back in a response.
+func (d *Document) Input(v any) *Schema {
+	return d.schema(reflect.TypeOf(v), true)
+}
+
+func (d *Document) schema(t reflect.Type, input bool) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	var enum []string
+	if t.Implements(valuesType) {
+		enum = reflect.Zero(t).Interface().(interface{ Values() []string }).Values()
+	}
+	if t.Implements(textMarshalerType) {
+		return &Schema{Type: "string", Enum: enum}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := d.schema(t.Elem(), input)
+		if elem.Ref != "" {
+			return &Schema{AllOf: []*Schema{elem}, Nullable: true}
+		}
+		elem.Nullable = true
+		return elem
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string", Enum: enum}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem(), input)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: &Additional{Schema: d.schema(t.Elem(), input)}}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t, input)
+		}
+		return d.component(t, input)
+	default:
+		return &Schema{}
+	}
+}
+
+// component adds a named struct to the document's schemas, returning a reference to it
+func (d *Document) component(t reflect.Type, input bool) *Schema {
+	name := exportedName(t.Name())
+	if input {
+		name += "Input"
+	}
+	if d.types == nil {
+		d.types = map[string]reflect.Type{}
+	}
+	if seen, ok := d.types[name]; ok && seen != t {
+		name = exportedName(path.Base(t.PkgPath())) + name
+	}
+
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	// Claimed before the fields are described so a struct referring to itself finishes
+	d.types[name] = t
+	d.Components.Schemas[name] = &Schema{}
+	*d.Components.Schemas[name] = *d.object(t, input)
+	return ref
+}
+
+func (d *Document) object(t reflect.Type, input bool) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	if !input {
+		schema.AdditionalProperties = &Additional{}
+	}
+
+	// Embedded structs have their fields promoted, unless the outer struct has one with the same name
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && options == "" {
+			continue
+		}
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = d.schema(fieldType, input)
+		if input {
+			if strings.Contains(field.Tag.Get("binding"), "required") {
+				schema.Required = append(schema.Required, name)
+			}
+		} else if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	for _, embeddedType := range embedded {
+		promoted := d.object(embeddedType, input)
+		for name, property := range promoted.Properties {
+			if _, ok := schema.Properties[name]; !ok {
+				schema.Properties[name] = property
+			}
+		}
+		for _, name := range promoted.Required {
+			if schema.Properties[name] == promoted.Properties[name] {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+	}
+
+	return schema
+}
+
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
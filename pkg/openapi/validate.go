@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Validate checks a value decoded from JSON into an any against a schema, returning every place
+// it doesn't match
+func (d *Document) Validate(schema *Schema, value any) error {
+	var problems []error
+	d.validate(schema, value, "$", &problems)
+	return errors.Join(problems...)
+}
+
+// resolve follows a schema's reference to the component it names
+func (d *Document) resolve(schema *Schema) (*Schema, error) {
+	for schema != nil && schema.Ref != "" {
+		name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+		if !ok {
+			return nil, fmt.Errorf("unsupported reference %q", schema.Ref)
+		}
+		schema, ok = d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("reference to missing schema %q", name)
+		}
+	}
+	return schema, nil
+}
+
+func (d *Document) validate(schema *Schema, value any, at string, problems *[]error) {
+	fail := func(format string, args ...any) {
+		*problems = append(*problems, fmt.Errorf("%s: %s", at, fmt.Sprintf(format, args...)))
+	}
+
+	schema, err := d.resolve(schema)
+	if err != nil {
+		fail("%s", err)
+		return
+	}
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if !schema.Nullable && (schema.Type != "" || len(schema.AllOf) > 0) {
+			fail("is null")
+		}
+		return
+	}
+
+	for _, part := range schema.AllOf {
+		d.validate(part, value, at, problems)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			fail("expected an object, got %s", kind(value))
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				fail("missing required field %q", name)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			switch {
+			case ok:
+				d.validate(property, object[name], at+"."+name, problems)
+			case schema.AdditionalProperties == nil:
+				// OpenAPI allows any other field when additionalProperties isn't given
+			case schema.AdditionalProperties.Schema == nil:
+				fail("unexpected field %q", name)
+			default:
+				d.validate(schema.AdditionalProperties.Schema, object[name], at+"."+name, problems)
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			fail("expected an array, got %s", kind(value))
+			return
+		}
+		for i, item := range array {
+			d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i), problems)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("expected a string, got %s", kind(value))
+			return
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, text) {
+			fail("%q is not one of %s", text, strings.Join(schema.Enum, ", "))
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				fail("%q is not a date-time", text)
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			fail("expected an integer, got %s", kind(value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			fail("expected a number, got %s", kind(value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected a boolean, got %s", kind(value))
+		}
+	}
+}
+
+// kind names the JSON type of a decoded value for problems
+func kind(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("the string %q", v)
+	case float64:
+		return fmt.Sprintf("the number %v", v)
+	case bool:
+		return fmt.Sprintf("%t", v)
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
@@ -0,0 +1,157 @@
+package roster
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+// Header names used by the students' union membership export, lower-cased. The export has been
+// renamed a few times so each field accepts a handful of names.
+var (
+	firstNameHeaders = []string{"first name", "firstname", "forename", "given name"}
+	surnameHeaders   = []string{"last name", "lastname", "surname", "family name"}
+	fullNameHeaders  = []string{"name", "full name", "member name"}
+	studentIDHeaders = []string{"student id", "student number", "studentid", "id number", "card number"}
+	emailHeaders     = []string{"email", "email address", "e-mail"}
+	expiryHeaders    = []string{"expiry", "expires", "expiry date", "membership expiry", "end date"}
+)
+
+var expiryFormats = []string{
+	"2006-01-02",
+	"02/01/2006",
+	"2006-01-02 15:04:05",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+}
+
+// Parse reads a students' union membership export. Every row must have a name and expiry date,
+// and the first row that doesn't is reported along with its line number.
+func Parse(r io.Reader) ([]database.Member, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("roster is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read roster header: %v", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+
+	firstNameColumn := findColumn(columns, firstNameHeaders)
+	surnameColumn := findColumn(columns, surnameHeaders)
+	fullNameColumn := findColumn(columns, fullNameHeaders)
+	studentIDColumn := findColumn(columns, studentIDHeaders)
+	emailColumn := findColumn(columns, emailHeaders)
+	expiryColumn := findColumn(columns, expiryHeaders)
+
+	if (firstNameColumn < 0 || surnameColumn < 0) && fullNameColumn < 0 {
+		return nil, errors.New("roster must have first and last name columns or a full name column")
+	}
+	if expiryColumn < 0 {
+		return nil, errors.New("roster must have a membership expiry column")
+	}
+
+	var members []database.Member
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read roster: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		if isBlank(record) {
+			continue
+		}
+
+		var member database.Member
+		if firstNameColumn >= 0 && surnameColumn >= 0 {
+			member.FirstName = field(record, firstNameColumn)
+			member.LastName = field(record, surnameColumn)
+		} else {
+			member.FirstName, member.LastName = splitFullName(field(record, fullNameColumn))
+		}
+		if member.FirstName == "" || member.LastName == "" {
+			return nil, fmt.Errorf("line %d: missing first or last name", line)
+		}
+
+		member.StudentID = field(record, studentIDColumn)
+		member.Email = strings.ToLower(field(record, emailColumn))
+
+		expiry, err := parseExpiry(field(record, expiryColumn))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		member.ExpiresAt = expiry.Format(database.MemberDateFormat)
+
+		members = append(members, member)
+	}
+
+	if len(members) == 0 {
+		return nil, errors.New("roster has no members")
+	}
+
+	return members, nil
+}
+
+func findColumn(columns map[string]int, names []string) int {
+	for _, name := range names {
+		if i, ok := columns[name]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+func field(record []string, column int) string {
+	if column < 0 || column >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[column])
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFullName treats the first word as the first name and everything after it as the surname
+func splitFullName(name string) (string, string) {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return name, ""
+	}
+	return parts[0], strings.Join(parts[1:], " ")
+}
+
+func parseExpiry(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("missing membership expiry")
+	}
+	for _, format := range expiryFormats {
+		if expiry, err := time.Parse(format, value); err == nil {
+			return expiry, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised membership expiry %q", value)
+}
@@ -0,0 +1,90 @@
+package roster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		roster string
+		want   []database.Member
+	}{
+		{
+			name:   "first and last names",
+			roster: "First Name,Last Name,Student ID,Email,Expiry\nAlex,Smith,123,Alex@Example.com,2027-08-31\n",
+			want:   []database.Member{{FirstName: "Alex", LastName: "Smith", StudentID: "123", Email: "alex@example.com", ExpiresAt: "2027-08-31"}},
+		},
+		{
+			name:   "other header names",
+			roster: "FORENAME, Surname, Card Number, E-mail, Membership Expiry\nAlex, Smith, 123, alex@example.com, 31/08/2027 23:59\n",
+			want:   []database.Member{{FirstName: "Alex", LastName: "Smith", StudentID: "123", Email: "alex@example.com", ExpiresAt: "2027-08-31"}},
+		},
+		{
+			name:   "full name",
+			roster: "Member Name,End Date\nMary Jane Watson,31/08/2027\n",
+			want:   []database.Member{{FirstName: "Mary", LastName: "Jane Watson", ExpiresAt: "2027-08-31"}},
+		},
+		{
+			name:   "byte order mark",
+			roster: "\ufeffFirst Name,Last Name,Expiry\nAlex,Smith,2027-08-31\n",
+			want:   []database.Member{{FirstName: "Alex", LastName: "Smith", ExpiresAt: "2027-08-31"}},
+		},
+		{
+			name:   "blank rows",
+			roster: "First Name,Last Name,Expiry\n\nAlex,Smith,2027-08-31\n, ,\nSam,Jones,2027-08-31\n",
+			want: []database.Member{
+				{FirstName: "Alex", LastName: "Smith", ExpiresAt: "2027-08-31"},
+				{FirstName: "Sam", LastName: "Jones", ExpiresAt: "2027-08-31"},
+			},
+		},
+		{
+			name:   "short rows",
+			roster: "First Name,Last Name,Expiry,Email\nAlex,Smith,2027-08-31\n",
+			want:   []database.Member{{FirstName: "Alex", LastName: "Smith", ExpiresAt: "2027-08-31"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			members, err := Parse(strings.NewReader(test.roster))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(members, test.want) {
+				t.Errorf("members = %+v\nwant %+v", members, test.want)
+			}
+		})
+	}
+}
+
+func TestParseProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		roster string
+		err    string
+	}{
+		{name: "empty", roster: "", err: "roster is empty"},
+		{name: "no names", roster: "Student ID,Expiry\n123,2027-08-31\n", err: "roster must have first and last name columns or a full name column"},
+		{name: "no expiry", roster: "First Name,Last Name\nAlex,Smith\n", err: "roster must have a membership expiry column"},
+		{name: "no members", roster: "First Name,Last Name,Expiry\n,,\n", err: "roster has no members"},
+		{name: "missing name", roster: "First Name,Last Name,Expiry\nAlex,Smith,2027-08-31\n\nSam,,2027-08-31\n", err: "line 4: missing first or last name"},
+		{name: "single full name", roster: "Name,Expiry\nCher,2027-08-31\n", err: "line 2: missing first or last name"},
+		{name: "missing expiry", roster: "First Name,Last Name,Expiry\nAlex,Smith,\n", err: "line 2: missing membership expiry"},
+		{name: "unreadable expiry", roster: "First Name,Last Name,Expiry\nAlex,Smith,August\n", err: `line 2: unrecognised membership expiry "August"`},
+		{name: "malformed line", roster: "First Name,Last Name,Expiry\nAlex,\"Smith,2027-08-31\n", err: "failed to read roster: parse error on line 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(test.roster))
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
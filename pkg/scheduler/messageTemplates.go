@@ -1,5 +1,27 @@
 package scheduler
 
+const EventPostTemplate = `
+## Post Event To {{ .Group }} Group Now ##
+Climbing Session Signup!
+Climbing Location: {{ .Event.EventLocation }}
+Meet Time: {{ .Event.MeetTime }}
+Meet Location: {{ .Event.MeetLocation }}
+Signups Open at: {{ .Event.OpenDatetime }}
+Signups Close at: {{ .Event.CloseDatetime }}
+
+{{ .Link }}
+`
+
+const EventReminderTemplate = `
+## Remind The Main Group That Signups Close Soon ##
+Last chance to sign up for the climbing session!
+Climbing Location: {{ .Event.EventLocation }}
+Seats Remaining: {{ .SeatsRemaining }}/{{ .Event.TotalSeats }}
+Signups Close at: {{ .Event.CloseDatetime }}
+
+{{ .Link }}
+`
+
 const EventOutputTemplate = `
 ## Event {{ .Event.EventID }} has closed! ##
 
@@ -11,8 +33,91 @@ Event Details:
 - Seats Taken: {{ .Event.SeatsTaken }}/{{ .Event.TotalSeats }}
 - Membership Required: {{ .Event.RequireMember }}
 
+{{- if .Cars }}
+{{- range .Cars }}
+
+{{ .Vehicle.Label }} - driven by {{ .Vehicle.DriverName }}, leaving from {{ .Vehicle.DeparturePoint }} ({{ len .Passengers }}/{{ .Vehicle.Capacity }}):
+{{- range .Passengers }}
+{{ .FirstName }} {{ .LastName }}
+{{- end }}
+{{- end }}
+{{- if .NoCar }}
+
+Not in a vehicle:
+{{- range .NoCar }}
+{{ .FirstName }} {{ .LastName }}
+{{- end }}
+{{- end }}
+{{- else }}
+
 Participants:
 {{- range $index, $participant := .Participants }}
 {{ $participant.FirstName }} {{ $participant.LastName }}
 {{- end }}
+{{- end }}
+{{- if .Waitlist }}
+
+Waitlist (did not get a seat):
+{{- range $index, $participant := .Waitlist }}
+{{ $participant.FirstName }} {{ $participant.LastName }}{{ if $participant.AllocationReason }} ({{ $participant.AllocationReason }}){{ end }}
+{{- end }}
+{{- end }}
+`
+
+const DriverTemplate = `
+Hi {{ .Vehicle.DriverName }},
+
+Signups for the climbing session at {{ .Event.EventLocation }} on {{ .Event.EventDate }} have closed.
+You are driving {{ .Vehicle.Label }}, picking up your passengers at {{ .Vehicle.DeparturePoint }} at {{ .Event.MeetTime }}.
+
+Your passengers ({{ len .Passengers }}/{{ .Vehicle.Capacity }}):
+{{- range .Passengers }}
+{{ .DisplayName }} {{ .LastName }}{{ if .Email }} - {{ .Email }}{{ end }}
+{{- else }}
+Nobody has been put in your vehicle.
+{{- end }}
+
+UoW Climbing Society
+`
+
+const SessionReminderTemplate = `
+Hi {{ .Participant.DisplayName }},
+
+This is a reminder that the climbing session at {{ .Event.EventLocation }} is {{ .Until }}.
+Meet at {{ .Event.MeetLocation }} at {{ .Event.MeetTime }} on {{ .Event.EventDate }}.
+{{ if .Driving }}
+You're driving, so if you can't make it please let the committee know as soon as possible so your passengers can be moved.
+{{ else }}
+If you can't make it, please cancel so your seat can go to someone on the waitlist.
+{{ end }}
+Cancel or stop these reminders: {{ .ManageLink }}
+
+UoW Climbing Society
+`
+
+const CancellationTemplate = `
+Hi {{ .Name }},
+
+Sorry, the climbing session at {{ .Event.EventLocation }} on {{ .Event.EventDate }} has been cancelled.
+{{- if .Event.CancellationReason }}
+
+Reason: {{ .Event.CancellationReason }}
+{{- end }}
+
+You don't need to do anything, keep an eye out for the next session.
+
+UoW Climbing Society
+`
+
+const BallotOutcomeTemplate = `
+Hi {{ .Participant.DisplayName }},
+
+The ballot for the climbing session at {{ .Event.EventLocation }} on {{ .Event.EventDate }} has been drawn.
+{{ if .Seated }}
+Good news, you got a seat! Meet at {{ .Event.MeetLocation }} at {{ .Event.MeetTime }}.
+{{ else }}
+Unfortunately you didn't get a seat this time. You are number {{ .WaitlistPosition }} on the waitlist
+and will be given a seat if one becomes free. Missing out also gives you priority next time.
+{{ end }}
+UoW Climbing Society
 `
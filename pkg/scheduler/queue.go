@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type JobKind string
+
+const (
+	JobCommitteePost JobKind = "committee_post"
+	JobOpen          JobKind = "open"
+	JobReminder      JobKind = "reminder"
+	JobClose         JobKind = "close"
+	// JobCancel tells everyone registered that the event has been cancelled
+	JobCancel JobKind = "cancel"
+	// JobComplete marks the event as having taken place once its session is over
+	JobComplete JobKind = "complete"
+	// JobSessionReminder reminds everyone with a seat about the session, there is one for each
+	// configured reminder with its time before the session added, see sessionReminderKind
+	JobSessionReminder JobKind = "session_reminder"
+)
+
+// sessionReminderKind is the kind of job for the reminder sent this long before a session
+func sessionReminderKind(before time.Duration) JobKind {
+	return JobKind(fmt.Sprintf("%s_%s", JobSessionReminder, before))
+}
+
+// sessionReminderBefore returns how long before the session a reminder job is sent, or false
+// if the job isn't a session reminder
+func sessionReminderBefore(kind JobKind) (time.Duration, bool) {
+	suffix, ok := strings.CutPrefix(string(kind), string(JobSessionReminder)+"_")
+	if !ok {
+		return 0, false
+	}
+	before, err := time.ParseDuration(suffix)
+	if err != nil {
+		return 0, false
+	}
+	return before, true
+}
+
+type Job struct {
+	EventID int
+	Kind    JobKind
+	RunAt   time.Time
+}
+
+// jobQueue is a min-heap of jobs ordered by the time they are due to run
+type jobQueue []Job
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].RunAt.Before(q[j].RunAt) }
+func (q jobQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x any) {
+	*q = append(*q, x.(Job))
+}
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	*q = old[:n-1]
+	return job
+}
+
+func (q *jobQueue) add(jobs ...Job) {
+	for _, job := range jobs {
+		heap.Push(q, job)
+	}
+}
+
+func (q *jobQueue) removeEvent(eventID int) {
+	kept := (*q)[:0]
+	for _, job := range *q {
+		if job.EventID != eventID {
+			kept = append(kept, job)
+		}
+	}
+	*q = kept
+	heap.Init(q)
+}
+
+// popDue removes and returns every job due at or before now
+func (q *jobQueue) popDue(now time.Time) []Job {
+	var due []Job
+	for q.Len() > 0 && !(*q)[0].RunAt.After(now) {
+		due = append(due, heap.Pop(q).(Job))
+	}
+	return due
+}
+
+// nextRun returns how long until the earliest job is due
+func (q jobQueue) nextRun(now time.Time, idle time.Duration) time.Duration {
+	if len(q) == 0 {
+		return idle
+	}
+	wait := q[0].RunAt.Sub(now)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
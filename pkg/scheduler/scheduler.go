@@ -1,158 +1,824 @@
 package scheduler
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/allocation"
 	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
 	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/emailer"
-	"github.com/robfig/cron/v3"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/metrics"
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/webhook"
 )
 
-func InitialiseScheduler() {
-	c := cron.New()
+const (
+	committeePostBeforeOpen = time.Hour * 6
+	reminderBeforeClose     = time.Hour * 2
+	retryDelay              = time.Minute * 5
+	idleWait                = time.Hour
+	// Sessions are marked completed this long after they start, by when they've certainly finished
+	completeAfterStart = time.Hour * 12
+	jobTimeout         = time.Minute * 2
+)
 
-	_, err := c.AddFunc("0 8 * * *", func() {
-		CheckScheduledEvents()
-	})
+var (
+	logger           = slog.Default()
+	allocationPolicy = allocation.DefaultPolicy()
+	// How long before the meet time participants are reminded, latest reminder first
+	sessionReminders = []time.Duration{time.Hour * 2, time.Hour * 24}
+	mu               sync.Mutex
+	queue            jobQueue
+	wake             = make(chan struct{}, 1)
+	stop             chan struct{}
+	loopDone         chan struct{}
+)
+
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// SetAllocationPolicy sets the policy used to weight ballot draws
+func SetAllocationPolicy(policy allocation.Policy) {
+	allocationPolicy = policy
+}
+
+// SetSessionReminders sets how long before the meet time everyone with a seat is reminded of a
+// session, with a reminder sent for each
+func SetSessionReminders(before []time.Duration) {
+	var reminders []time.Duration
+	for _, duration := range before {
+		if duration > 0 {
+			reminders = append(reminders, duration)
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool { return reminders[i] < reminders[j] })
+	sessionReminders = reminders
+}
+
+// InitialiseScheduler builds the job queue from every event in the database and starts running
+// jobs as they fall due. Jobs missed while the server was down are run straight away.
+func InitialiseScheduler(ctx context.Context) error {
+	events, err := database.GetEvents(ctx, database.EventQuery{})
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	queue = jobQueue{}
+	for _, event := range events {
+		jobs, err := buildJobs(ctx, event)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to schedule event", "event_id", event.EventID, "error", err)
+			continue
+		}
+		queue.add(jobs...)
+	}
+	stop = make(chan struct{})
+	loopDone = make(chan struct{})
+	go runLoop(stop, loopDone)
+	mu.Unlock()
+
+	return nil
+}
+
+// Stop prevents any further jobs from starting and waits for a job that is already running to
+// finish. Jobs left in the queue are picked up again by the next InitialiseScheduler.
+func Stop(ctx context.Context) error {
+	mu.Lock()
+	if stop == nil {
+		mu.Unlock()
+		return nil
+	}
+	close(stop)
+	done := loopDone
+	stop = nil
+	mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("scheduler did not stop in time: %v", ctx.Err())
+	}
+}
+
+// Running reports whether the scheduler has been started and not stopped
+func Running() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if loopDone == nil {
+		return false
+	}
+	select {
+	case <-loopDone:
+		return false
+	default:
+		return stop != nil
+	}
+}
+
+// RescheduleEvent replaces the queued jobs for an event, used whenever an event is created or updated.
+// Jobs that have already run are sent again if the event has been moved so they're due later.
+func RescheduleEvent(ctx context.Context, eventID int) {
+	event, err := database.GetEventByID(ctx, eventID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to reschedule event", "event_id", eventID, "error", err)
+		return
+	}
+
+	jobs, err := buildJobs(ctx, *event)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to reschedule event", "event_id", eventID, "error", err)
+	}
+
+	mu.Lock()
+	queue.removeEvent(eventID)
+	queue.add(jobs...)
+	mu.Unlock()
+
+	notify()
+}
+
+// UnscheduleEvent drops any queued jobs for an event, used when an event is deleted
+func UnscheduleEvent(eventID int) {
+	mu.Lock()
+	queue.removeEvent(eventID)
+	mu.Unlock()
+
+	notify()
+}
+
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func runLoop(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		mu.Lock()
+		wait := queue.nextRun(time.Now(), idleWait)
+		mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			runDueJobs(stop)
+		case <-wake:
+		case <-stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+func runDueJobs(stop <-chan struct{}) {
+	mu.Lock()
+	due := queue.popDue(time.Now())
+	mu.Unlock()
+
+	for i, job := range due {
+		select {
+		case <-stop:
+			// Put back what we haven't started so the queue stays accurate
+			mu.Lock()
+			queue.add(due[i:]...)
+			mu.Unlock()
+			return
+		default:
+		}
+
+		// Jobs get their own context so that shutting down lets a running job finish
+		ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+		runJob(ctx, job)
+		cancel()
+	}
+}
+
+// buildJobs works out which jobs an event still needs for its status. Once signups have closed
+// only the close and complete jobs are kept, so announcements missed during downtime are not sent
+// after the fact. A job that has run but is now due later was run for times the event has since
+// been moved from, so it is released to run again at the new time.
+func buildJobs(ctx context.Context, event database.Event) ([]Job, error) {
+	now := time.Now()
+
+	var jobs []Job
+	switch event.EventStatus {
+	case database.EventStatusDraft, database.EventStatusCompleted:
+		return nil, nil
+	case database.EventStatusCancelled:
+		jobs = append(jobs, Job{EventID: event.EventID, Kind: JobCancel, RunAt: now})
+	case database.EventStatusClosed:
+	default:
+		openTime, err := event.OpenTime()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse open datetime: %v", err)
+		}
+
+		closeTime, err := event.CloseTime()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse close datetime: %v", err)
+		}
+
+		jobs = append(jobs, Job{EventID: event.EventID, Kind: JobClose, RunAt: closeTime})
+
+		if now.Before(closeTime) {
+			jobs = append(jobs,
+				Job{EventID: event.EventID, Kind: JobCommitteePost, RunAt: openTime.Add(-committeePostBeforeOpen)},
+				Job{EventID: event.EventID, Kind: JobOpen, RunAt: openTime},
+			)
+
+			reminderTime := closeTime.Add(-reminderBeforeClose)
+			if reminderTime.After(openTime) {
+				jobs = append(jobs, Job{EventID: event.EventID, Kind: JobReminder, RunAt: reminderTime})
+			}
+		}
+	}
+
+	// Events without a start time that can be read get no reminders and are left for the
+	// committee to complete
+	if start, err := event.StartTime(); err == nil && event.EventStatus != database.EventStatusCancelled {
+		notBefore := now
+		if closeTime, err := event.CloseTime(); err == nil && closeTime.After(notBefore) {
+			notBefore = closeTime
+		}
+		jobs = append(jobs, sessionReminderJobs(event.EventID, start, notBefore)...)
+		jobs = append(jobs, Job{EventID: event.EventID, Kind: JobComplete, RunAt: start.Add(completeAfterStart)})
+	}
+
+	completed, err := database.GetCompletedJobs(ctx, event.EventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completed jobs: %v", err)
+	}
+
+	var pending []Job
+	for _, job := range jobs {
+		if completed[string(job.Kind)] {
+			// Jobs only run once they're due, so one that has run can't be due later unless the
+			// event has been moved
+			if !job.RunAt.After(now) {
+				continue
+			}
+			if err := database.ReleaseJob(ctx, job.EventID, string(job.Kind)); err != nil {
+				return nil, fmt.Errorf("failed to release moved job: %v", err)
+			}
+		}
+		pending = append(pending, job)
+	}
+
+	return pending, nil
+}
+
+func runJob(ctx context.Context, job Job) {
+	jobLogger := logger.With("event_id", job.EventID, "job", job.Kind)
+
+	event, err := database.GetEventByID(ctx, job.EventID)
+	if err != nil {
+		jobLogger.WarnContext(ctx, "Dropping job", "error", err)
+		return
+	}
+
+	claimed, err := database.ClaimJob(ctx, job.EventID, string(job.Kind), job.RunAt)
 	if err != nil {
-		log.Println("Error scheduling function: ", err)
+		jobLogger.ErrorContext(ctx, "Failed to claim job", "error", err)
+		requeue(job)
+		return
 	}
+	if !claimed {
+		jobLogger.DebugContext(ctx, "Job already claimed, skipping")
+		return
+	}
+
+	jobLogger.InfoContext(ctx, "Running job", "due", job.RunAt)
+
+	switch job.Kind {
+	case JobCommitteePost:
+		err = sendEventPost(ctx, *event, "Committee")
+	case JobOpen:
+		err = openEvent(ctx, *event)
+	case JobReminder:
+		err = sendEventReminder(ctx, *event)
+	case JobClose:
+		err = closeEvent(ctx, *event)
+	case JobCancel:
+		err = notifyCancellation(ctx, *event)
+	case JobComplete:
+		err = completeEvent(ctx, *event)
+	default:
+		if _, ok := sessionReminderBefore(job.Kind); ok {
+			err = sendSessionReminder(ctx, *event, job.Kind)
+		} else {
+			err = fmt.Errorf("unknown job kind %q", job.Kind)
+		}
+	}
+
+	metrics.SchedulerJobsTotal.WithLabelValues(string(job.Kind), metrics.Result(err)).Inc()
+
+	if err != nil {
+		jobLogger.ErrorContext(ctx, "Failed to run job, retrying later", "error", err, "retry_in", retryDelay)
+		if err := database.ReleaseJob(ctx, job.EventID, string(job.Kind)); err != nil {
+			jobLogger.ErrorContext(ctx, "Failed to release job", "error", err)
+			return
+		}
+		requeue(job)
+	}
+}
+
+func requeue(job Job) {
+	job.RunAt = time.Now().Add(retryDelay)
+
+	mu.Lock()
+	queue.add(job)
+	mu.Unlock()
+
+	notify()
+}
 
-	_, err = c.AddFunc("@every 1m", func() {
-		checkClosedEvents()
+func sendEventPost(ctx context.Context, event database.Event, group string) error {
+	message, err := renderTemplate(EventPostTemplate, struct {
+		Event database.Event
+		Group string
+		Link  string
+	}{
+		Event: event,
+		Group: group,
+		Link:  event.GetLink(),
 	})
 	if err != nil {
-		log.Println("Error scheduling function: ", err)
+		return err
 	}
 
-	c.Start()
+	subject := fmt.Sprintf("Society Session Event %d Post To Send To The %s Group Now!", event.EventID, group)
+	return emailer.SendEmail(ctx, os.Getenv("EVENT_POSTS_EMAIL_ADDRESS"), subject, message)
 }
 
-func CheckScheduledEvents() {
-	fmt.Println("Checking Scheduled Events")
-	events, err := database.GetEvents()
+// openEvent opens signups and announces the event to the main group
+func openEvent(ctx context.Context, event database.Event) error {
+	switch event.EventStatus {
+	case database.EventStatusScheduled:
+		if _, err := database.TransitionEvent(ctx, event.EventID, database.EventStatusOpen); err != nil {
+			return err
+		}
+	case database.EventStatusOpen:
+		// A retry after the post failed finds the event already open
+	default:
+		return nil
+	}
+
+	return sendEventPost(ctx, event, "Main")
+}
+
+// completeEvent marks a closed event as having taken place
+func completeEvent(ctx context.Context, event database.Event) error {
+	switch event.EventStatus {
+	case database.EventStatusClosed:
+		_, err := database.TransitionEvent(ctx, event.EventID, database.EventStatusCompleted)
+		return err
+	case database.EventStatusScheduled, database.EventStatusOpen:
+		// Signups closing has failed so far, completing waits for it
+		return fmt.Errorf("event has not closed yet")
+	default:
+		return nil
+	}
+}
+
+// sessionReminderJobs returns a job for each reminder before a session. Reminders aren't sent
+// before notBefore, so everyone registered by the time signups close is reminded, and any that
+// would then be sent at the same time as a later one are dropped so nobody gets two at once.
+func sessionReminderJobs(eventID int, start time.Time, notBefore time.Time) []Job {
+	if !notBefore.Before(start) {
+		return nil
+	}
+
+	var jobs []Job
+	for _, before := range sessionReminders {
+		runAt := start.Add(-before)
+		if runAt.Before(notBefore) {
+			runAt = notBefore
+		}
+		if len(jobs) > 0 && !runAt.Before(jobs[len(jobs)-1].RunAt) {
+			continue
+		}
+		jobs = append(jobs, Job{EventID: eventID, Kind: sessionReminderKind(before), RunAt: runAt})
+	}
+	return jobs
+}
+
+// sendSessionReminder emails everyone with a seat or driving the meet details and a link to
+// cancel if they can't make it. Each participant is marked once reminded, so retrying only
+// emails those who failed.
+func sendSessionReminder(ctx context.Context, event database.Event, reminder JobKind) error {
+	if event.EventStatus == database.EventStatusCancelled || event.EventStatus == database.EventStatusCompleted {
+		return nil
+	}
+
+	start, err := event.StartTime()
 	if err != nil {
-		log.Println(err)
+		return fmt.Errorf("failed to parse start time: %v", err)
+	}
+	if !time.Now().Before(start) {
+		logger.InfoContext(ctx, "Session has started, skipping reminder", "event_id", event.EventID, "reminder", reminder)
+		return nil
 	}
 
-	var message string
-	messageFormat := "## Post Event To %s Group At %v ##\nClimbing Session Signup!\nClimbing Location: %s\nMeet Time: %s\nMeet Location: %s\nSignups Close at: %s\n\n%s\n\n"
+	recipients, err := database.GetReminderRecipients(ctx, event.EventID, string(reminder))
+	if err != nil {
+		return err
+	}
 
-	// Iterate through each event
-	for _, event := range events {
-		currentDatetime, committeeMsgDatetime, openDatetime, _, err := getRoundedTimes(event)
+	subject := fmt.Sprintf("Climbing Session Reminder - %s %s", event.EventLocation, event.EventDate)
+	failed := 0
+	for _, participant := range recipients {
+		token, err := database.CancelToken(ctx, participant.ParticipantID)
 		if err != nil {
-			log.Println(err)
+			logger.ErrorContext(ctx, "Failed to get cancel token", "participant_id", participant.ParticipantID, "error", err)
+			failed++
+			continue
 		}
 
-		fmt.Printf("Current: %v; Committee: %v; Open: %v\n", currentDatetime, committeeMsgDatetime, openDatetime)
+		message, err := renderTemplate(SessionReminderTemplate, struct {
+			Event       database.Event
+			Participant database.Participant
+			Driving     bool
+			Until       string
+			ManageLink  string
+		}{
+			Event:       event,
+			Participant: participant,
+			Driving:     participant.SeatStatus == database.SeatDriver,
+			Until:       untilText(time.Until(start)),
+			ManageLink:  fmt.Sprintf("%s/cancel?token=%s", database.SiteURL, token),
+		})
+		if err != nil {
+			return err
+		}
 
-		if dateEqual(committeeMsgDatetime, currentDatetime) {
-			message += fmt.Sprintf(messageFormat, "Committee", committeeMsgDatetime.String(), event.EventLocation, event.MeetTime, event.MeetLocation, event.CloseDatetime, event.GetLink())
+		if err := emailer.SendEmail(ctx, participant.Email, subject, message); err != nil {
+			logger.ErrorContext(ctx, "Failed to send session reminder", "participant_id", participant.ParticipantID, "error", err)
+			failed++
+			continue
 		}
 
-		if dateEqual(openDatetime, currentDatetime) {
-			message += fmt.Sprintf(messageFormat, "Main", openDatetime.String(), event.EventLocation, event.MeetTime, event.MeetLocation, event.CloseDatetime, event.GetLink())
+		if err := database.MarkReminderSent(ctx, participant.ParticipantID, string(reminder)); err != nil {
+			logger.ErrorContext(ctx, "Failed to mark session reminder as sent", "participant_id", participant.ParticipantID, "error", err)
 		}
 	}
 
-	fmt.Printf("Message to email: \n%s\n", message)
+	logger.InfoContext(ctx, "Sent session reminders", "event_id", event.EventID, "reminder", reminder, "recipients", len(recipients)-failed)
+	if failed > 0 {
+		return fmt.Errorf("failed to remind %d of %d participants", failed, len(recipients))
+	}
+	return nil
+}
 
-	if message != "" {
-		fmt.Println("Sending Email")
-		emailer.SendEmail(os.Getenv("EVENT_POSTS_EMAIL_ADDRESS"), "Society Session Event Posts to Send Today!", message)
+// untilText describes how long until a session in words for reminder emails
+func untilText(until time.Duration) string {
+	hours := int(until.Round(time.Hour) / time.Hour)
+	switch {
+	case hours > 1:
+		return fmt.Sprintf("in %d hours", hours)
+	case hours == 1:
+		return "in an hour"
+	default:
+		return "soon"
 	}
 }
 
-func checkClosedEvents() {
-	events, err := database.GetEvents()
+// HandleTransition replaces an event's jobs with the ones its new status needs, registered as a
+// database.TransitionHook
+func HandleTransition(ctx context.Context, transition database.Transition) {
+	RescheduleEvent(ctx, transition.Event.EventID)
+}
+
+func sendEventReminder(ctx context.Context, event database.Event) error {
+	message, err := renderTemplate(EventReminderTemplate, struct {
+		Event          database.Event
+		SeatsRemaining int
+		Link           string
+	}{
+		Event:          event,
+		SeatsRemaining: event.TotalSeats - event.SeatsTaken,
+		Link:           event.GetLink(),
+	})
 	if err != nil {
-		log.Println(err)
+		return err
 	}
 
-	for _, event := range events {
-		if event.EventStatus == database.EventStatusClosed {
-			continue
+	subject := fmt.Sprintf("Society Session Event %d Closes Soon!", event.EventID)
+	return emailer.SendEmail(ctx, os.Getenv("EVENT_POSTS_EMAIL_ADDRESS"), subject, message)
+}
+
+func closeEvent(ctx context.Context, event database.Event) error {
+	if !event.EventStatus.AcceptingRegistrations() {
+		return nil
+	}
+
+	if event.AllocationMode == database.AllocationBallot && event.BallotDrawnAt == "" {
+		if err := drawBallot(ctx, event); err != nil {
+			return fmt.Errorf("failed to draw ballot: %v", err)
 		}
-		currentDatetime, _, _, closeDatetime, err := getRoundedTimes(event)
+
+		drawnEvent, err := database.GetEventByID(ctx, event.EventID)
 		if err != nil {
-			log.Println(err)
+			return err
 		}
-		if currentDatetime.After(closeDatetime) {
-			type details struct {
-				Event        database.Event
-				Participants []database.Participant
-			}
+		event = *drawnEvent
+	}
 
-			participants, err := event.GetParticipants()
-			if err != nil {
-				log.Println(err)
-			}
+	// Any seats still free go to the waitlist, including those held back by a no-show cooldown
+	promoted, err := database.PromoteFromWaitlist(ctx, event.EventID, true)
+	if err != nil {
+		return err
+	}
+	event.SeatsTaken += len(promoted)
 
-			data := details{
-				Event:        event,
-				Participants: participants,
-			}
+	vehicles, err := database.GetEventVehicles(ctx, event.EventID)
+	if err != nil {
+		return err
+	}
+	if len(vehicles) > 0 {
+		// Anyone the committee hasn't put in a vehicle by hand gets the first one with space
+		if _, err := database.AutoAssignVehicles(ctx, event.EventID); err != nil {
+			return fmt.Errorf("failed to assign vehicles: %v", err)
+		}
+	}
 
-			msgTmpl, err := template.New("messageTemplate").Parse(EventOutputTemplate)
-			if err != nil {
-				log.Println(err)
-			}
-			output := &strings.Builder{}
-			err = msgTmpl.Execute(output, data)
+	participants, err := event.GetParticipants(ctx)
+	if err != nil {
+		return err
+	}
 
-			message := output.String()
-			fmt.Printf("Message to email: \n%s\n", message)
+	var seated, waitlisted []database.Participant
+	for _, participant := range participants {
+		switch participant.SeatStatus {
+		case database.SeatConfirmed:
+			seated = append(seated, participant)
+		case database.SeatWaitlisted, database.SeatBallot:
+			waitlisted = append(waitlisted, participant)
+		}
+	}
 
-			if message != "" {
-				fmt.Println("Sending Email")
-				emailer.SendEmail(os.Getenv("EVENT_CLOSURE_EMAIL_ADDRESS"), fmt.Sprintf("Society Session Event %d Closed Today!", event.EventID), message)
-			}
+	cars, noCar := carLists(vehicles, seated)
 
-			err = event.Close()
-			if err != nil {
-				log.Println(err)
-			}
+	message, err := renderTemplate(EventOutputTemplate, struct {
+		Event        database.Event
+		Participants []database.Participant
+		Cars         []carList
+		NoCar        []database.Participant
+		Waitlist     []database.Participant
+	}{
+		Event:        event,
+		Participants: seated,
+		Cars:         cars,
+		NoCar:        noCar,
+		Waitlist:     waitlisted,
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("Society Session Event %d Closed Today!", event.EventID)
+	if err := emailer.SendEmail(ctx, os.Getenv("EVENT_CLOSURE_EMAIL_ADDRESS"), subject, message); err != nil {
+		return err
+	}
+
+	if event.AllocationMode == database.AllocationBallot {
+		notifyBallotOutcome(ctx, event, seated, waitlisted)
+	}
+	notifyDrivers(ctx, event, cars)
+
+	return event.Close(ctx)
+}
 
+// carList is a vehicle along with the participants travelling in it
+type carList struct {
+	Vehicle    database.Vehicle
+	Passengers []database.Participant
+}
+
+// carLists splits the seated participants between the vehicles they are in, returning anyone
+// not in a vehicle separately
+func carLists(vehicles []database.Vehicle, seated []database.Participant) ([]carList, []database.Participant) {
+	cars := make([]carList, len(vehicles))
+	index := map[int]int{}
+	for i, vehicle := range vehicles {
+		cars[i].Vehicle = vehicle
+		index[vehicle.VehicleID] = i
+	}
+
+	var noCar []database.Participant
+	for _, participant := range seated {
+		i, ok := index[participant.VehicleID]
+		if !ok {
+			noCar = append(noCar, participant)
+			continue
 		}
+		cars[i].Passengers = append(cars[i].Passengers, participant)
 	}
+
+	return cars, noCar
 }
 
-func getRoundedTimes(event database.Event) (currentTime, committeeMsgTime, openTime, closeTime time.Time, err error) {
-	// Check that sign ups are open
-	dateFormat := "02/01/2006 15:04:05"
-	openTime, err = time.Parse(dateFormat, event.OpenDatetime)
+// notifyDrivers emails each driver their passengers. Each vehicle is marked once its driver is
+// notified so a retried close job doesn't email them twice.
+func notifyDrivers(ctx context.Context, event database.Event, cars []carList) {
+	for _, car := range cars {
+		if car.Vehicle.DriverEmail == "" || car.Vehicle.DriverNotified {
+			continue
+		}
+
+		message, err := renderTemplate(DriverTemplate, struct {
+			Event      database.Event
+			Vehicle    database.Vehicle
+			Passengers []database.Participant
+		}{
+			Event:      event,
+			Vehicle:    car.Vehicle,
+			Passengers: car.Passengers,
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to render driver passenger list", "vehicle_id", car.Vehicle.VehicleID, "error", err)
+			continue
+		}
+
+		subject := fmt.Sprintf("Climbing Session Passengers - %s %s", event.EventLocation, event.EventDate)
+		if err := emailer.SendEmail(ctx, car.Vehicle.DriverEmail, subject, message); err != nil {
+			logger.ErrorContext(ctx, "Failed to send driver passenger list", "vehicle_id", car.Vehicle.VehicleID, "error", err)
+			continue
+		}
+
+		if err := database.MarkDriverNotified(ctx, car.Vehicle.VehicleID); err != nil {
+			logger.ErrorContext(ctx, "Failed to mark driver as notified", "vehicle_id", car.Vehicle.VehicleID, "error", err)
+		}
+	}
+}
+
+// notifyCancellation posts the cancellation to the webhook then emails everyone registered and
+// every driver. Only a failed webhook is retried, so nobody is emailed twice.
+func notifyCancellation(ctx context.Context, event database.Event) error {
+	err := webhook.Send(ctx, webhook.KindEventCancelled, struct {
+		EventID  int    `json:"event_id"`
+		Location string `json:"session_location"`
+		Date     string `json:"session_date"`
+		Reason   string `json:"cancellation_reason"`
+		Link     string `json:"link"`
+	}{
+		EventID:  event.EventID,
+		Location: event.EventLocation,
+		Date:     event.EventDate,
+		Reason:   event.CancellationReason,
+		Link:     event.GetLink(),
+	})
 	if err != nil {
-		return time.Time{}, time.Time{}, time.Time{}, time.Time{}, err
+		return fmt.Errorf("failed to send cancellation webhook: %v", err)
 	}
-	openTime = openTime.Round(time.Minute)
 
-	closeTime, err = time.Parse(dateFormat, event.CloseDatetime)
+	participants, err := event.GetParticipants(ctx)
+	if err != nil {
+		return err
+	}
+	vehicles, err := database.GetEventVehicles(ctx, event.EventID)
 	if err != nil {
-		return time.Time{}, time.Time{}, time.Time{}, time.Time{}, err
+		return err
 	}
-	closeTime = closeTime.Round(time.Minute)
 
-	// Get current time in local timezone
-	localTime := time.Now()
+	recipients := map[string]string{}
+	for _, participant := range participants {
+		if participant.Email != "" {
+			recipients[strings.ToLower(participant.Email)] = participant.DisplayName()
+		}
+	}
+	for _, vehicle := range vehicles {
+		address := strings.ToLower(vehicle.DriverEmail)
+		if _, ok := recipients[address]; address != "" && !ok {
+			recipients[address] = vehicle.DriverName
+		}
+	}
 
-	// Get current time without timezone information for comparison
-	currentTime = time.Date(localTime.Year(), localTime.Month(), localTime.Day(), localTime.Hour(), localTime.Minute(),
-		localTime.Second(), localTime.Nanosecond(), time.UTC)
-	currentTime = currentTime.Round(time.Minute)
+	subject := fmt.Sprintf("Climbing Session Cancelled - %s %s", event.EventLocation, event.EventDate)
+	for address, name := range recipients {
+		message, err := renderTemplate(CancellationTemplate, struct {
+			Event database.Event
+			Name  string
+		}{
+			Event: event,
+			Name:  name,
+		})
+		if err != nil {
+			return err
+		}
 
-	committeeMsgTime = openTime.Add(-(time.Hour * 6))
+		if err := emailer.SendEmail(ctx, address, subject, message); err != nil {
+			logger.ErrorContext(ctx, "Failed to send cancellation", "event_id", event.EventID, "error", err)
+		}
+	}
 
-	return currentTime, committeeMsgTime, openTime, closeTime, nil
+	logger.InfoContext(ctx, "Sent cancellation", "event_id", event.EventID, "recipients", len(recipients))
+	return nil
 }
 
-func dateEqual(date1, date2 time.Time) bool {
-	y1, m1, d1 := date1.Date()
-	y2, m2, d2 := date2.Date()
-	return y1 == y2 && m1 == m2 && d1 == d2
+// drawBallot runs the draw for every entry into an event's ballot using the event's seed
+func drawBallot(ctx context.Context, event database.Event) error {
+	participants, err := event.GetParticipants(ctx)
+	if err != nil {
+		return err
+	}
+
+	var entries []allocation.BallotEntry
+	for _, participant := range participants {
+		if participant.SeatStatus != database.SeatBallot {
+			continue
+		}
+
+		weight := 1.0
+		if event.BallotWeighted {
+			history, err := database.GetAttendanceHistory(ctx, participant.PersonID)
+			if err != nil {
+				return err
+			}
+			weight = allocationPolicy.BallotWeight(participant, history)
+		}
+
+		entries = append(entries, allocation.BallotEntry{Participant: participant, Weight: weight})
+	}
+
+	// Drivers and anyone seated before a reopen keep their seats, only what's left is drawn
+	seatsFree := event.TotalSeats - event.SeatsTaken
+	if seatsFree < 0 {
+		seatsFree = 0
+	}
+
+	results := allocation.Draw(entries, seatsFree, event.BallotSeed)
+	logger.InfoContext(ctx, "Drew ballot", "event_id", event.EventID, "entries", len(entries), "seats", seatsFree, "seed", event.BallotSeed)
+
+	return database.RecordBallotDraw(ctx, event.EventID, results)
+}
+
+// notifyBallotOutcome emails everyone who entered the ballot with their result. Each participant
+// is marked once notified so a retried close job doesn't email them twice.
+func notifyBallotOutcome(ctx context.Context, event database.Event, seated []database.Participant, waitlisted []database.Participant) {
+	notify := func(participant database.Participant, isSeated bool, waitlistPosition int) {
+		if participant.Email == "" || participant.OutcomeNotified {
+			return
+		}
+
+		message, err := renderTemplate(BallotOutcomeTemplate, struct {
+			Event            database.Event
+			Participant      database.Participant
+			Seated           bool
+			WaitlistPosition int
+		}{
+			Event:            event,
+			Participant:      participant,
+			Seated:           isSeated,
+			WaitlistPosition: waitlistPosition,
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to render ballot outcome", "participant_id", participant.ParticipantID, "error", err)
+			return
+		}
+
+		subject := fmt.Sprintf("Climbing Session Ballot Result - %s %s", event.EventLocation, event.EventDate)
+		if err := emailer.SendEmail(ctx, participant.Email, subject, message); err != nil {
+			logger.ErrorContext(ctx, "Failed to send ballot outcome", "participant_id", participant.ParticipantID, "error", err)
+			return
+		}
+
+		if err := database.MarkOutcomeNotified(ctx, participant.ParticipantID); err != nil {
+			logger.ErrorContext(ctx, "Failed to mark ballot outcome as sent", "participant_id", participant.ParticipantID, "error", err)
+		}
+	}
+
+	for _, participant := range seated {
+		notify(participant, true, 0)
+	}
+	for i, participant := range waitlisted {
+		notify(participant, false, i+1)
+	}
+}
+
+func renderTemplate(text string, data any) (string, error) {
+	msgTmpl, err := template.New("messageTemplate").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	output := &strings.Builder{}
+	if err := msgTmpl.Execute(output, data); err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
 }
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/database"
+)
+
+func TestMain(m *testing.M) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
+
+// useTestDatabase points the database at a new file and empties the queue for the rest of the test
+func useTestDatabase(t *testing.T) context.Context {
+	t.Helper()
+
+	previous := database.Path
+	database.Path = filepath.Join(t.TempDir(), "database.db")
+	t.Cleanup(func() {
+		database.Path = previous
+		mu.Lock()
+		queue = jobQueue{}
+		mu.Unlock()
+	})
+
+	mu.Lock()
+	queue = jobQueue{}
+	mu.Unlock()
+
+	ctx := context.Background()
+	if err := database.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return ctx
+}
+
+// createEvent adds an approved event that opened an hour ago, closes at closes and starts a week
+// from now, then moves it on to the status given
+func createEvent(t *testing.T, ctx context.Context, closes time.Time, statuses ...database.EventStatus) int {
+	t.Helper()
+
+	now := time.Now()
+	eventID, err := database.CreateEvent(ctx, database.Event{
+		EventLocation: "Wall",
+		EventDate:     now.AddDate(0, 0, 7).Format(database.DateFormat),
+		MeetLocation:  "Union",
+		MeetTime:      "18:00",
+		TotalSeats:    10,
+		OpenDatetime:  now.Add(-time.Hour).Format(database.DatetimeFormat),
+		CloseDatetime: closes.Format(database.DatetimeFormat),
+		CreatedBy:     "alice",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.ApproveEvent(ctx, eventID, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range statuses {
+		if _, err := database.TransitionEvent(ctx, eventID, status); err != nil {
+			t.Fatalf("failed to move event to %s: %v", status, err)
+		}
+	}
+	return eventID
+}
+
+func eventStatus(t *testing.T, ctx context.Context, eventID int) database.EventStatus {
+	t.Helper()
+
+	event, err := database.GetEventByID(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event.EventStatus
+}
+
+func TestRunJobOnce(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID := createEvent(t, ctx, time.Now().Add(-time.Minute), database.EventStatusOpen, database.EventStatusClosed)
+
+	job := Job{EventID: eventID, Kind: JobComplete, RunAt: time.Now()}
+	runJob(ctx, job)
+	if status := eventStatus(t, ctx, eventID); status != database.EventStatusCompleted {
+		t.Fatalf("status = %s after running the job, want %s", status, database.EventStatusCompleted)
+	}
+
+	// Put the event back so a second run would be seen completing it again
+	db, err := sql.Open("sqlite", database.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "UPDATE events SET event_status = ? WHERE event_id = ?", database.EventStatusClosed, eventID); err != nil {
+		t.Fatal(err)
+	}
+
+	runJob(ctx, job)
+	if status := eventStatus(t, ctx, eventID); status != database.EventStatusClosed {
+		t.Errorf("status = %s, the job was run a second time", status)
+	}
+	if len(queue) != 0 {
+		t.Errorf("queue = %v, want nothing requeued", queue)
+	}
+}
+
+func TestRunJobRetriesAfterFailure(t *testing.T) {
+	ctx := useTestDatabase(t)
+	eventID := createEvent(t, ctx, time.Now().Add(time.Hour), database.EventStatusOpen)
+
+	// Completing fails while signups are still open
+	runJob(ctx, Job{EventID: eventID, Kind: JobComplete, RunAt: time.Now()})
+
+	completed, err := database.GetCompletedJobs(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed[string(JobComplete)] {
+		t.Errorf("the failed job is still claimed")
+	}
+	if len(queue) != 1 || queue[0].Kind != JobComplete {
+		t.Fatalf("queue = %v, want the failed job requeued", queue)
+	}
+	if wait := time.Until(queue[0].RunAt); wait < retryDelay-time.Minute || wait > retryDelay {
+		t.Errorf("retry is due in %s, want %s", wait, retryDelay)
+	}
+
+	if _, err := database.TransitionEvent(ctx, eventID, database.EventStatusClosed); err != nil {
+		t.Fatal(err)
+	}
+	retry := queue.popDue(queue[0].RunAt)
+	runJob(ctx, retry[0])
+	if status := eventStatus(t, ctx, eventID); status != database.EventStatusCompleted {
+		t.Errorf("status = %s after the retry, want %s", status, database.EventStatusCompleted)
+	}
+}
+
+func TestBuildJobsAfterMove(t *testing.T) {
+	ctx := useTestDatabase(t)
+	now := time.Now()
+	eventID := createEvent(t, ctx, now.Add(90*time.Minute))
+
+	// The announcements and reminder for the close in an hour and a half have gone out
+	for _, kind := range []JobKind{JobCommitteePost, JobOpen, JobReminder} {
+		if _, err := database.ClaimJob(ctx, eventID, string(kind), now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kinds := func() map[JobKind]bool {
+		t.Helper()
+		event, err := database.GetEventByID(ctx, eventID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs, err := buildJobs(ctx, *event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds := map[JobKind]bool{}
+		for _, job := range jobs {
+			kinds[job.Kind] = true
+		}
+		return kinds
+	}
+
+	if kinds := kinds(); kinds[JobReminder] || kinds[JobOpen] || !kinds[JobClose] {
+		t.Errorf("jobs = %v, want the close without the jobs that have run", kinds)
+	}
+
+	// Moving the close a day later means the reminder is due again, the announcements aren't
+	db, err := sql.Open("sqlite", database.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	closes := now.AddDate(0, 0, 1).Format(database.DatetimeFormat)
+	if _, err := db.ExecContext(ctx, "UPDATE events SET close_datetime = ? WHERE event_id = ?", closes, eventID); err != nil {
+		t.Fatal(err)
+	}
+
+	if kinds := kinds(); !kinds[JobReminder] || kinds[JobOpen] || kinds[JobCommitteePost] {
+		t.Errorf("jobs = %v, want the reminder again without the announcements", kinds)
+	}
+	completed, err := database.GetCompletedJobs(ctx, eventID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed[string(JobReminder)] || !completed[string(JobOpen)] {
+		t.Errorf("claims = %v, want only the reminder released", completed)
+	}
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/alipali737/climbing-society-seats-app/climbing-society-seats-app/pkg/metrics"
+)
+
+// Kinds of notification sent to the webhook
+const (
+	KindEventCancelled     = "event.cancelled"
+	KindEventStatusChanged = "event.status_changed"
+)
+
+// Notification is the JSON body posted to the webhook
+type Notification struct {
+	Kind   string    `json:"kind"`
+	SentAt time.Time `json:"sent_at"`
+	Data   any       `json:"data"`
+}
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+func getWebhookURL() string {
+	return os.Getenv("WEBHOOK_URL")
+}
+
+// Send posts a notification to the webhook in config.env, so the committee's chat or other tools
+// hear about changes. Nothing is sent when no webhook is configured.
+func Send(ctx context.Context, kind string, data any) error {
+	url := getWebhookURL()
+	if url == "" {
+		return nil
+	}
+
+	err := send(ctx, url, Notification{Kind: kind, SentAt: time.Now(), Data: data})
+	metrics.WebhooksTotal.WithLabelValues(kind, metrics.Result(err)).Inc()
+	return err
+}
+
+func send(ctx context.Context, url string, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+const urlParams = new URLSearchParams(window.location.search);
+const token = urlParams.get('token') || '';
+
+window.onload = fetchRegistration;
+
+async function fetchRegistration() {
+    try {
+        const response = await fetch('/api/registration?token=' + encodeURIComponent(token));
+        const data = await response.json();
+        if (!response.ok) {
+            responseText(data.message, false);
+            return;
+        }
+
+        document.getElementById('registration-name').textContent = data.name;
+        document.getElementById('session-location').textContent = data.session_location;
+        document.getElementById('session-date').textContent = data.session_date;
+        document.getElementById('meet-time').textContent = data.meet_time;
+        document.getElementById('meet-point').textContent = data.meet_point;
+        document.getElementById('reminders').checked = data.reminders;
+
+        if (!data.cancellable) {
+            document.getElementById('cancel-button').disabled = true;
+            if (data.seat_status == 'driver') {
+                document.getElementById('cancel-text').textContent = "You're driving, please let the committee know if you can't make it so your passengers can be moved.";
+            } else {
+                document.getElementById('cancel-text').textContent = 'This session can no longer be cancelled.';
+            }
+        }
+
+        document.getElementById('registration-details').classList.remove('disabled');
+    } catch (error) {
+        responseText(error, false);
+        console.error(error);
+    }
+}
+
+document.getElementById('cancel-button').addEventListener('click', async function () {
+    if (!confirm('Cancel your registration? Your seat will be given to someone else.')) {
+        return;
+    }
+
+    const data = await sendRegistrationChange('/api/registration/cancel', 'POST', { token: token });
+    if (data && data.success) {
+        document.getElementById('registration-details').classList.add('disabled');
+    }
+});
+
+document.getElementById('reminders').addEventListener('change', function () {
+    sendRegistrationChange('/api/registration/reminders', 'PUT', { token: token, enabled: this.checked });
+});
+
+async function sendRegistrationChange(url, method, body) {
+    try {
+        const response = await fetch(url, {
+            method: method,
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(body)
+        });
+        const data = await response.json();
+        responseText(data.message, data.success);
+        return data;
+    } catch (error) {
+        responseText(error, false);
+        console.error(error);
+    }
+}
+
+function responseText(text, success) {
+    var displayElement = document.getElementById('response-text');
+    displayElement.textContent = text;
+
+    if (success) {
+        displayElement.classList.remove('invalid-text');
+        displayElement.classList.add('valid-text');
+    } else {
+        displayElement.classList.remove('valid-text');
+        displayElement.classList.add('invalid-text');
+    }
+}
@@ -0,0 +1,145 @@
+window.onload = populateEventSelect;
+
+const eventSelect = document.getElementById("event-select");
+
+async function populateEventSelect() {
+    try {
+        // The latest sessions first, so today's is in the list however many there have been
+        const response = await fetch('/api/events?' + new URLSearchParams({ order: '-start', limit: 200 }));
+        if (!response.ok) {
+            throw new Error('Error fetching event details: Request failed with status ' + response.status);
+        }
+        const events = await response.json();
+
+        for (const event of events) {
+            const option = document.createElement('option');
+            option.value = event.event_id;
+            option.textContent = event.session_date + ' - ' + event.session_location;
+            eventSelect.appendChild(option);
+        }
+    } catch (error) {
+        console.error(error);
+    }
+}
+
+async function getCheckinParticipants() {
+    const checkinList = document.getElementById("checkin-list");
+    const selectedEventId = eventSelect.value;
+    checkinList.innerHTML = '';
+    if (!selectedEventId) {
+        updateSummary([]);
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/participants?event=${selectedEventId}`);
+        if (!response.ok) {
+            throw new Error('Error fetching event participants: Request failed with status ' + response.status);
+        }
+        // Only people with a seat can be checked in, the waitlist never had a place to turn up to
+        const participants = (await response.json()).filter(p => p.seat_status == 'confirmed' || p.seat_status == 'driver');
+
+        for (const participant of participants) {
+            checkinList.appendChild(createCheckinCard(participant));
+        }
+
+        if (participants.length == 0) {
+            const empty = document.createElement("h4");
+            empty.textContent = "No participants registered";
+            checkinList.appendChild(empty);
+        }
+
+        updateSummary(participants);
+    } catch (error) {
+        console.error(error);
+        responseText(error.message, false);
+    }
+}
+
+function createCheckinCard(participant) {
+    const card = document.createElement("div");
+    card.classList.add("checkin-card", participant.attendance);
+
+    const name = document.createElement("span");
+    name.classList.add("checkin-name");
+    name.textContent = participant.first_name + ' ' + participant.last_name;
+    if (participant.preferred_name) {
+        name.textContent += ' (' + participant.preferred_name + ')';
+    }
+    card.appendChild(name);
+
+    const buttons = document.createElement("div");
+    buttons.classList.add("checkin-buttons");
+
+    const attendedButton = document.createElement("button");
+    attendedButton.innerHTML = '<i class="fa fa-check"></i> Here';
+    attendedButton.classList.add("attended-button");
+    if (participant.attendance == "attended") {
+        attendedButton.classList.add("selected");
+    }
+    attendedButton.onclick = () => setAttendance(participant.participant_id, participant.attendance == "attended" ? "unknown" : "attended");
+    buttons.appendChild(attendedButton);
+
+    const noShowButton = document.createElement("button");
+    noShowButton.innerHTML = '<i class="fa fa-times"></i> No-show';
+    noShowButton.classList.add("no-show-button");
+    if (participant.attendance == "no_show") {
+        noShowButton.classList.add("selected");
+    }
+    noShowButton.onclick = () => setAttendance(participant.participant_id, participant.attendance == "no_show" ? "unknown" : "no_show");
+    buttons.appendChild(noShowButton);
+
+    card.appendChild(buttons);
+    return card;
+}
+
+function updateSummary(participants) {
+    const summary = document.getElementById("checkin-summary");
+    if (participants.length == 0) {
+        summary.textContent = '';
+        return;
+    }
+
+    const attended = participants.filter(p => p.attendance == "attended").length;
+    const noShows = participants.filter(p => p.attendance == "no_show").length;
+    summary.textContent = `${attended} here, ${noShows} no-shows, ${participants.length - attended - noShows} waiting`;
+}
+
+async function setAttendance(participantId, attendance) {
+    try {
+        const response = await fetch('/api/participant/attendance?participant=' + participantId, {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ attendance: attendance })
+        });
+        const data = await response.json();
+        if (!data.success) {
+            throw new Error(data.message);
+        }
+        getCheckinParticipants();
+    } catch (error) {
+        console.error(error);
+        responseText(error.message, false);
+    }
+}
+
+function responseText(text, success) {
+    var displayElement = document.getElementById('response-text');
+    displayElement.textContent = text;
+
+    if (success) {
+        displayElement.classList.remove('invalid-text');
+        displayElement.classList.add('valid-text');
+    } else {
+        displayElement.classList.remove('valid-text');
+        displayElement.classList.add('invalid-text');
+    }
+
+    setTimeout(() => {
+        displayElement.textContent = '';
+        displayElement.classList.remove('valid-text');
+        displayElement.classList.remove('invalid-text');
+    }, 5000);
+}
@@ -1,24 +1,36 @@
 window.onload = populateEventSelect;
 
-async function fetchEventDetails() {
-    const events = await fetch('/api/events')
-    .then(response => {
+// fetchEventDetails gets a page of events, next is the cursor of the page after or null on the last page
+async function fetchEventDetails(params) {
+    const page = await fetch('/api/v1/events?' + (params || new URLSearchParams()).toString())
+    .then(async response => {
         if (!response.ok) {
             throw new Error('Error fetching event details: Request failed with status ' + response.status);
         }
-        return response.json();
-    })
-    .then(data => {
-        return data;
+        return { events: await response.json(), next: response.headers.get('X-Next-Cursor') };
     })
     .catch(error => {
         console.error(error);
+        return { events: [], next: null };
     });
-    return events;
+    return page;
+}
+
+// eventFilters reads the filters above the events table
+function eventFilters() {
+    const params = new URLSearchParams({ order: document.getElementById('filter_order').value });
+    const filters = { status: 'filter_status', location: 'filter_location', from: 'filter_from', to: 'filter_to' };
+    for (const name in filters) {
+        const value = document.getElementById(filters[name]).value.trim();
+        if (value) {
+            params.append(name, value);
+        }
+    }
+    return params;
 }
 
 async function fetchEventParticipants(eventId) {
-    const participants = await fetch(`/api/participants?event=${eventId}`)
+    const participants = await fetch(`/api/v1/events/${eventId}/participants`)
     .then(response => {
         if (!response.ok) {
             throw new Error('Error fetching event participants: Request failed with status ' + response.status)
@@ -34,16 +46,27 @@ async function fetchEventParticipants(eventId) {
     return participants;
 }
 
-async function getEvents() {
-    // Clear existing table data
+// Cursor of the next page of events in the table, null once they've all been loaded
+var nextEventsCursor = null;
+
+async function getEvents(more = false) {
     const tableBody = document.getElementById("event-table-body");
-    tableBody.innerHTML = "";
+    const params = eventFilters();
+    if (more && nextEventsCursor) {
+        params.append('cursor', nextEventsCursor);
+    } else {
+        // Clear existing table data
+        tableBody.innerHTML = "";
+    }
 
-    const fieldsToDisplay = ["session_location","session_date","meet_point","meet_time","total_seats","require_member","open_date","close_date"]
+    const fieldsToDisplay = ["session_location","session_date","meet_point","meet_time","total_seats","require_member","open_date","close_date","allocation_mode","ballot_weighted"]
 
     try {
         // Get events from backend
-        const events = await fetchEventDetails()
+        const page = await fetchEventDetails(params);
+        const events = page.events;
+        nextEventsCursor = page.next;
+        document.getElementById('more-events-button').classList.toggle('disabled', !nextEventsCursor);
 
         // Populate the table with event data
         for (const event of events) {
@@ -55,6 +78,12 @@ async function getEvents() {
                     row.appendChild(cell);
                 }
             }
+
+            // Status is changed with the buttons below rather than edited
+            const statusCell = document.createElement("td");
+            statusCell.textContent = event.status;
+            statusCell.classList.add("status-cell");
+            row.appendChild(statusCell);
     
             const editCell = document.createElement("td");
             const editButton = document.createElement("button");
@@ -68,6 +97,42 @@ async function getEvents() {
             deleteButton.classList.add("danger-button");
             deleteButton.onclick = () => deleteEvent(event.event_id);
             editCell.appendChild(deleteButton);
+
+            if (event.status == 'draft') {
+                // Drafts need approving by a different admin to the one who created them
+                const approveButton = document.createElement("button");
+                approveButton.textContent = "Approve";
+                approveButton.title = event.created_by ? "Created by " + event.created_by : "";
+                approveButton.classList.add("success-button");
+                approveButton.onclick = () => changeEventStatus(event.event_id, 'approve');
+                editCell.appendChild(approveButton);
+            }
+            if (event.status == 'closed') {
+                const reopenButton = document.createElement("button");
+                reopenButton.textContent = "Reopen";
+                reopenButton.classList.add("warning-button");
+                reopenButton.onclick = () => reopenEvent(event.event_id);
+                editCell.appendChild(reopenButton);
+
+                const completeButton = document.createElement("button");
+                completeButton.textContent = "Complete";
+                completeButton.classList.add("success-button");
+                completeButton.onclick = () => changeEventStatus(event.event_id, 'complete');
+                editCell.appendChild(completeButton);
+            }
+
+            const cancelButton = document.createElement("button");
+            cancelButton.classList.add("danger-button");
+            if (event.status == 'cancelled') {
+                cancelButton.textContent = "Cancelled";
+                cancelButton.title = event.cancellation_reason;
+                cancelButton.disabled = true;
+            } else {
+                cancelButton.textContent = "Cancel Event";
+                cancelButton.onclick = () => cancelEvent(event.event_id);
+                cancelButton.disabled = event.status == 'completed';
+            }
+            editCell.appendChild(cancelButton);
     
             const linkButton = document.createElement("button");
             linkButton.textContent = "Link";
@@ -117,6 +182,9 @@ function editEvent(row, eventId) {
     const cells = row.getElementsByTagName("td");
     for (let i = 0; i < cells.length - 1; i++) {
         const cell = cells[i];
+        if (cell.classList.contains("status-cell")) {
+            continue;
+        }
         const cellValue = cell.textContent;
         cell.innerHTML = `<input type="text" class="edit-cell" value="${cellValue}" />`;
     }
@@ -148,10 +216,12 @@ function saveEvent(rowIndex, eventId) {
         require_member: Boolean(cells[5].querySelector('input').value),
         open_date: cells[6].querySelector('input').value,
         close_date: cells[7].querySelector('input').value,
+        allocation_mode: cells[8].querySelector('input').value,
+        ballot_weighted: cells[9].querySelector('input').value === 'true',
     };
 
     // POST API
-    fetch('/api/events?event='+eventId, {
+    fetch('/api/v1/events/' + eventId, {
         method: 'PUT',
         headers: {
             'Content-Type': 'application/json'
@@ -183,9 +253,10 @@ async function populateEventSelect() {
     eventSelect.selectElement = 0;
 
     try {
-        // Get events from backend
-        const events = await fetchEventDetails();
-     
+        // The latest sessions are the ones registrations are managed for
+        const page = await fetchEventDetails(new URLSearchParams({ order: '-start', limit: 200 }));
+        const events = page.events;
+
         // Populate the table with event data
         for (const event of events) {
              const option = document.createElement('option');
@@ -205,18 +276,56 @@ function clearOptions(selectElement) {
     }
 }
 
-async function getParticipants() {
+var participantsStream;
+
+// watchParticipants reloads the participants table whenever the selected event's seats change
+function watchParticipants(eventId) {
+    if (participantsStream) {
+        participantsStream.close();
+        participantsStream = null;
+    }
+    if (!eventId || !window.EventSource) {
+        return;
+    }
+
+    // The first update is the current state, which the table is already being loaded with. Later
+    // ones, including the state sent after reconnecting, may mean there are new participants.
+    var loaded = false;
+    participantsStream = new EventSource(`/api/v1/events/${eventId}/stream`);
+    participantsStream.addEventListener('seats', message => {
+        const update = JSON.parse(message.data);
+        if (update.change == 'deleted') {
+            participantsStream.close();
+            participantsStream = null;
+            return;
+        }
+        if (!loaded) {
+            loaded = true;
+            return;
+        }
+        getParticipants(false);
+    });
+}
+
+async function getParticipants(watch = true) {
     const participantsTableBody = document.getElementById("participants-table-body")
     const selectedEventId = eventSelect.value;
+    if (watch) {
+        watchParticipants(selectedEventId);
+    }
     if (!selectedEventId) {
         // No event selected, clear table
         participantsTableBody.innerHTML = '';
+        document.getElementById('vehicles-table-body').innerHTML = '';
+        document.getElementById('driver-offers-table-body').innerHTML = '';
         return;
     }
 
     try {
         // Get participants from backend
         const eventParticipants = await fetchEventParticipants(selectedEventId)
+        const vehicles = await getVehicles(selectedEventId);
+        getDriverOffers(selectedEventId);
     
         // Populate table
         participantsTableBody.innerHTML = '';
@@ -231,17 +340,45 @@ async function getParticipants() {
             
             const firstNameCell = document.createElement("td");
             firstNameCell.textContent = participant.first_name;
+            if (participant.preferred_name) {
+                firstNameCell.textContent += ' (' + participant.preferred_name + ')';
+            }
             row.appendChild(firstNameCell);
     
             const lastNameCell = document.createElement("td");
             lastNameCell.textContent = participant.last_name;
             row.appendChild(lastNameCell);
+
+            const statusCell = document.createElement("td");
+            statusCell.textContent = participant.seat_status;
+            row.appendChild(statusCell);
+
+            const priorityCell = document.createElement("td");
+            priorityCell.textContent = participant.priority;
+            row.appendChild(priorityCell);
+
+            const reasonCell = document.createElement("td");
+            reasonCell.textContent = participant.allocation_reason;
+            row.appendChild(reasonCell);
+
+            const membershipCell = document.createElement("td");
+            membershipCell.textContent = participant.membership_flag || (participant.member ? 'member' : 'non-member');
+            if (participant.membership_flag) {
+                membershipCell.classList.add('invalid-text');
+            }
+            row.appendChild(membershipCell);
+
+            const vehicleCell = document.createElement('td');
+            if (vehicles.length > 0 && participant.seat_status == 'confirmed') {
+                vehicleCell.appendChild(vehicleSelect(participant, vehicles));
+            }
+            row.appendChild(vehicleCell);
     
             const deleteCell = document.createElement('td');
             const deleteButton = document.createElement('button');
             deleteButton.textContent = 'Delete';
             deleteButton.classList.add("danger-button");
-            deleteButton.onclick = () => deleteParticipant(participant.participant_id);
+            deleteButton.onclick = () => deleteParticipant(selectedEventId, participant.participant_id);
             deleteCell.appendChild(deleteButton);
     
             row.appendChild(deleteCell);
@@ -263,6 +400,10 @@ async function getParticipants() {
             lastNameCell.textContent = "No participants registered";
             row.appendChild(lastNameCell);
 
+            for (let i = 0; i < 5; i++) {
+                row.appendChild(document.createElement("td"));
+            }
+
             const actionCell = document.createElement("td");
             row.appendChild(actionCell);
     
@@ -275,6 +416,9 @@ async function getParticipants() {
 }
 
 async function deleteEvent(eventId) {
+    if (!confirm('Delete this event? Nobody registered is told, cancel it instead to let them know.')) {
+        return;
+    }
     try {
         await fetchDeleteEvent(eventId);
         await new Promise(r => setTimeout(r, 500));
@@ -285,8 +429,59 @@ async function deleteEvent(eventId) {
     }
 }
 
+function cancelEvent(eventId) {
+    const reason = prompt('Cancel this event? Everyone registered will be emailed.\n\nReason (optional):');
+    if (reason === null) {
+        return;
+    }
+
+    fetch('/api/v1/events/' + eventId + '/cancel', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ reason: reason })
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getEvents();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
+
+function changeEventStatus(eventId, action, body) {
+    fetch(`/api/v1/events/${eventId}/${action}`, {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify(body || {})
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getEvents();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
+
+function reopenEvent(eventId) {
+    const closeDate = prompt('Reopen signups until (dd/mm/yyyy hh:mm:ss):');
+    if (closeDate === null) {
+        return;
+    }
+    changeEventStatus(eventId, 'reopen', { close_date: closeDate });
+}
+
 async function fetchDeleteEvent(eventId) {
-    fetch('/api/event?event='+eventId, {
+    fetch('/api/v1/events/' + eventId, {
         method: 'DELETE'
     })
     .then(response => {
@@ -303,18 +498,18 @@ async function fetchDeleteEvent(eventId) {
     });
 }
 
-async function deleteParticipant(participantId) {
+async function deleteParticipant(eventId, participantId) {
     try {
-        await fetchDeleteParticipant(participantId);
+        await fetchDeleteParticipant(eventId, participantId);
         await new Promise(r => setTimeout(r, 500));
-        getParticipants();
+        getParticipants(false);
     } catch (error) {
         console.error(error);
     }
 }
 
-async function fetchDeleteParticipant(participantId) {
-    fetch('/api/participant?participant='+participantId, {
+async function fetchDeleteParticipant(eventId, participantId) {
+    fetch(`/api/v1/events/${eventId}/participants/${participantId}`, {
         method: 'DELETE'
     })
     .then(response => {
@@ -344,9 +539,11 @@ createEventForm.addEventListener('submit', function (event) {
         require_member: document.getElementById('require_member').checked,
         open_date: document.getElementById('open_datetime').value,
         close_date: document.getElementById('close_datetime').value,
+        allocation_mode: document.getElementById('allocation_mode').value,
+        ballot_weighted: document.getElementById('ballot_weighted').checked,
     };
 
-    fetch('/api/events', {
+    fetch('/api/v1/events', {
         method: 'POST',
         headers: {
             'Content-Type': 'application/json'
@@ -360,7 +557,7 @@ createEventForm.addEventListener('submit', function (event) {
         return response.json();
     })
     .then(data => {
-        responseText(data.message, data.success);
+        responseText(apiMessage(data), data.success);
         populateEventSelect();
         createEventForm.reset();
     })
@@ -369,6 +566,12 @@ createEventForm.addEventListener('submit', function (event) {
     });
 });
 
+// apiMessage reads the message from a reply, which /api/v1 puts in an error envelope when the
+// request fails
+function apiMessage(data) {
+    return data.error ? data.error.message : data.message;
+}
+
 function responseText(text, success) {
     var displayElement = document.getElementById('response-text');
     displayElement.textContent = text;
@@ -386,4 +589,423 @@ function responseText(text, success) {
         displayElement.classList.remove('valid-text');
         displayElement.classList.remove('invalid-text');
     }, 5000);
-}
\ No newline at end of file
+}
+
+// MEMBERSHIP ROSTER SECTION
+
+async function getMembersCount() {
+    try {
+        const response = await fetch('/api/v1/members');
+        if (!response.ok) {
+            throw new Error('Failed to fetch members: ' + response.status);
+        }
+        const members = await response.json();
+        document.getElementById('members-count').textContent = members.length + ' members on the roster';
+    } catch (error) {
+        console.error(error);
+    }
+}
+
+const importMembersForm = document.getElementById('import-members-form');
+importMembersForm.addEventListener('submit', function (event) {
+    event.preventDefault();
+    const formData = new FormData();
+    formData.append('file', document.getElementById('members_file').files[0]);
+
+    fetch('/api/v1/members', {
+        method: 'POST',
+        body: formData
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getMembersCount();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+});
+
+document.addEventListener('DOMContentLoaded', getMembersCount);
+
+// PEOPLE SECTION
+
+async function getPeople() {
+    const tableBody = document.getElementById("people-table-body");
+    const fieldsToDisplay = ["person_id","first_name","last_name","email","student_id","registrations","attended","no_shows","last_session_date"];
+
+    try {
+        const response = await fetch('/api/v1/people');
+        if (!response.ok) {
+            throw new Error('Failed to fetch people: ' + response.status);
+        }
+        const people = await response.json();
+
+        tableBody.innerHTML = "";
+        for (const person of people) {
+            const row = document.createElement("tr");
+            for (const key of fieldsToDisplay) {
+                const cell = document.createElement("td");
+                cell.textContent = person[key];
+                row.appendChild(cell);
+            }
+
+            const driverCell = document.createElement("td");
+            const driverCheckbox = document.createElement("input");
+            driverCheckbox.type = "checkbox";
+            driverCheckbox.checked = person.qualified_driver;
+            driverCheckbox.onchange = () => setQualifiedDriver(person.person_id, driverCheckbox.checked);
+            driverCell.appendChild(driverCheckbox);
+            row.appendChild(driverCell);
+
+            tableBody.appendChild(row);
+        }
+    } catch (error) {
+        console.error(error);
+    }
+}
+
+function setQualifiedDriver(personId, qualified) {
+    fetch('/api/v1/people/' + personId + '/driver', {
+        method: 'PUT',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ qualified: qualified })
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getPeople();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
+
+const mergePeopleForm = document.getElementById('merge-people-form');
+mergePeopleForm.addEventListener('submit', function (event) {
+    event.preventDefault();
+    const from = parseInt(document.getElementById('merge_from').value);
+    const into = parseInt(document.getElementById('merge_into').value);
+    if (!confirm('Merge person #' + from + ' into person #' + into + '? This cannot be undone.')) {
+        return;
+    }
+
+    fetch('/api/v1/people/merge', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ from: from, into: into })
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getPeople();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+});
+
+document.addEventListener('DOMContentLoaded', getPeople);
+
+// EXPORT SECTION
+
+function exportParticipants(format) {
+    const selectedEventId = eventSelect.value;
+    if (!selectedEventId) {
+        responseText('Select an event to export', false);
+        return;
+    }
+    window.location.href = '/api/v1/events/' + selectedEventId + '/export?format=' + format;
+}
+
+function exportEvents(format) {
+    const params = new URLSearchParams({ format: format });
+    const from = document.getElementById('export_from').value;
+    const to = document.getElementById('export_to').value;
+    if (from) {
+        params.append('from', from);
+    }
+    if (to) {
+        params.append('to', to);
+    }
+    window.location.href = '/api/v1/export/events?' + params.toString();
+}
+
+// IMPORT EVENTS SECTION
+
+const importEventsForm = document.getElementById('import-events-form');
+importEventsForm.addEventListener('submit', function (event) {
+    event.preventDefault();
+    const dryRun = document.getElementById('import_dry_run').checked;
+    const formData = new FormData();
+    formData.append('file', document.getElementById('events_file').files[0]);
+
+    fetch('/api/v1/events/import?dry_run=' + dryRun, {
+        method: 'POST',
+        body: formData
+    })
+    .then(response => response.json())
+    .then(data => {
+        const results = document.getElementById('import-results');
+        results.innerHTML = '';
+
+        if (data.rows === undefined) {
+            responseText(apiMessage(data), false);
+            return;
+        }
+
+        for (const row of data.rows) {
+            const item = document.createElement('li');
+            if (row.errors) {
+                item.textContent = 'Line ' + row.line + ' (' + row.session_location + ' ' + row.session_date + '): ' + row.errors.join(', ');
+                item.classList.add('invalid-text');
+            } else if (row.event_id) {
+                item.textContent = 'Line ' + row.line + ': created event ' + row.event_id + ', ' + row.session_location + ' ' + row.session_date;
+            } else {
+                item.textContent = 'Line ' + row.line + ': ok, ' + row.session_location + ' ' + row.session_date;
+            }
+            results.appendChild(item);
+        }
+
+        if (!data.valid) {
+            responseText('Schedule has errors, no events were created', false);
+        } else if (data.dry_run) {
+            responseText('Schedule is valid, untick dry run to create ' + data.rows.length + ' events', true);
+        } else {
+            responseText('Created ' + data.created + ' events', true);
+            getEvents();
+            populateEventSelect();
+        }
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+});
+
+// VEHICLES SECTION
+
+// getVehicles fills the vehicles table for an event and returns them for the participants table
+async function getVehicles(eventId) {
+    const tableBody = document.getElementById('vehicles-table-body');
+    try {
+        const response = await fetch('/api/v1/events/' + eventId + '/vehicles');
+        if (!response.ok) {
+            throw new Error('Failed to fetch vehicles: ' + response.status);
+        }
+        const vehicles = await response.json();
+
+        tableBody.innerHTML = '';
+        for (const vehicle of vehicles) {
+            const row = document.createElement('tr');
+            const cells = [
+                vehicle.name,
+                vehicle.driver_name,
+                vehicle.driver_email,
+                vehicle.departure_point,
+                vehicle.passengers + '/' + vehicle.capacity,
+            ];
+            for (const text of cells) {
+                const cell = document.createElement('td');
+                cell.textContent = text;
+                row.appendChild(cell);
+            }
+
+            const deleteCell = document.createElement('td');
+            const deleteButton = document.createElement('button');
+            deleteButton.textContent = 'Delete';
+            deleteButton.classList.add('danger-button');
+            deleteButton.onclick = () => deleteVehicle(eventId, vehicle.vehicle_id);
+            deleteCell.appendChild(deleteButton);
+            row.appendChild(deleteCell);
+
+            tableBody.appendChild(row);
+        }
+        return vehicles;
+    } catch (error) {
+        console.error(error);
+        return [];
+    }
+}
+
+function vehicleSelect(participant, vehicles) {
+    const select = document.createElement('select');
+
+    const none = document.createElement('option');
+    none.value = 0;
+    none.textContent = '-- none --';
+    select.appendChild(none);
+
+    for (const vehicle of vehicles) {
+        const option = document.createElement('option');
+        option.value = vehicle.vehicle_id;
+        option.textContent = (vehicle.name || vehicle.driver_name + "'s car") + ' (' + vehicle.passengers + '/' + vehicle.capacity + ')';
+        select.appendChild(option);
+    }
+    select.value = participant.vehicle_id;
+
+    select.onchange = () => {
+        fetch('/api/v1/events/' + participant.event_id + '/participants/' + participant.participant_id + '/vehicle', {
+            method: 'PUT',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify({ vehicle_id: parseInt(select.value) })
+        })
+        .then(response => response.json())
+        .then(data => {
+            responseText(apiMessage(data), data.success);
+            getParticipants(false);
+        })
+        .catch(error => {
+            responseText(error, false);
+            console.error(error);
+        });
+    };
+    return select;
+}
+
+const addVehicleForm = document.getElementById('add-vehicle-form');
+addVehicleForm.addEventListener('submit', function (event) {
+    event.preventDefault();
+    const selectedEventId = eventSelect.value;
+    if (!selectedEventId) {
+        responseText('Select an event to add a vehicle to', false);
+        return;
+    }
+
+    fetch('/api/v1/events/' + selectedEventId + '/vehicles', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({
+            name: document.getElementById('vehicle_name').value,
+            driver_name: document.getElementById('vehicle_driver_name').value,
+            driver_email: document.getElementById('vehicle_driver_email').value,
+            capacity: parseInt(document.getElementById('vehicle_capacity').value),
+            departure_point: document.getElementById('vehicle_departure_point').value,
+        })
+    })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        if (data.success) {
+            addVehicleForm.reset();
+        }
+        getParticipants(false);
+        getEvents();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+});
+
+function deleteVehicle(eventId, vehicleId) {
+    if (!confirm('Delete this vehicle? Its passengers keep their seats but will need a new vehicle.')) {
+        return;
+    }
+
+    fetch('/api/v1/events/' + eventId + '/vehicles/' + vehicleId, { method: 'DELETE' })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getParticipants(false);
+        getEvents();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
+
+function autoAssignVehicles() {
+    const selectedEventId = eventSelect.value;
+    if (!selectedEventId) {
+        responseText('Select an event to assign vehicles for', false);
+        return;
+    }
+
+    fetch('/api/v1/events/' + selectedEventId + '/vehicles/assign', { method: 'POST' })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getParticipants(false);
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
+
+// DRIVER OFFERS SECTION
+
+async function getDriverOffers(eventId) {
+    const tableBody = document.getElementById('driver-offers-table-body');
+    try {
+        const response = await fetch('/api/v1/events/' + eventId + '/driver-offers');
+        if (!response.ok) {
+            throw new Error('Failed to fetch driver offers: ' + response.status);
+        }
+        const offers = await response.json();
+
+        tableBody.innerHTML = '';
+        for (const offer of offers) {
+            const row = document.createElement('tr');
+            const cells = [
+                offer.first_name + ' ' + offer.last_name,
+                offer.email,
+                offer.vehicle_name,
+                offer.capacity,
+                offer.departure_point,
+                offer.status,
+            ];
+            for (const text of cells) {
+                const cell = document.createElement('td');
+                cell.textContent = text;
+                row.appendChild(cell);
+            }
+
+            const actionCell = document.createElement('td');
+            if (offer.status == 'pending') {
+                const approveButton = document.createElement('button');
+                approveButton.textContent = 'Approve';
+                approveButton.onclick = () => decideDriverOffer(eventId, offer.offer_id, 'approve');
+                actionCell.appendChild(approveButton);
+
+                const declineButton = document.createElement('button');
+                declineButton.textContent = 'Decline';
+                declineButton.classList.add('danger-button');
+                declineButton.onclick = () => decideDriverOffer(eventId, offer.offer_id, 'decline');
+                actionCell.appendChild(declineButton);
+            }
+            row.appendChild(actionCell);
+
+            tableBody.appendChild(row);
+        }
+    } catch (error) {
+        console.error(error);
+    }
+}
+
+function decideDriverOffer(eventId, offerId, decision) {
+    fetch('/api/v1/events/' + eventId + '/driver-offers/' + offerId + '/' + decision, { method: 'POST' })
+    .then(response => response.json())
+    .then(data => {
+        responseText(apiMessage(data), data.success);
+        getParticipants(false);
+        getEvents();
+    })
+    .catch(error => {
+        responseText(error, false);
+        console.error(error);
+    });
+}
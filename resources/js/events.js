@@ -0,0 +1,83 @@
+document.addEventListener('DOMContentLoaded', () => {
+    // Calendar apps subscribe to a webcal link rather than downloading the feed once
+    document.getElementById('calendar-link').href = 'webcal://' + window.location.host + '/calendar.ics';
+    fetchUpcomingEvents();
+})
+
+function fetchUpcomingEvents() {
+    fetch('/api/events/upcoming')
+    .then(response => {
+        if (!response.ok) {
+            throw new Error('Error fetching sessions: Request failed with status ' + response.status);
+        }
+        return response.json();
+    })
+    .then(data => {
+        var list = document.getElementById('events-list');
+        list.innerHTML = '';
+
+        if (data.length == 0) {
+            document.getElementById('events-empty').classList.remove('disabled');
+            return;
+        }
+
+        data.forEach(event => {
+            list.appendChild(eventItem(event));
+        });
+    })
+    .catch(error => {
+        const errorMessage = error.message;
+        const errorPageUrl = '/register/error.html?message=' + encodeURIComponent(errorMessage);
+        window.location.href = errorPageUrl;
+    });
+}
+
+function eventItem(event) {
+    var item = document.createElement('li');
+    item.className = 'event-item all-round-shadow';
+
+    var title = document.createElement('h3');
+    title.textContent = event.session_location;
+    item.appendChild(title);
+
+    var details = [
+        event.session_date + ', meet at ' + event.meet_point + ' at ' + event.meet_time,
+        event.require_member ? 'Members only' : 'Open to everyone',
+    ];
+    if (event.open) {
+        details.push('Signups close ' + event.close_date);
+    } else if (!event.cancelled) {
+        details.push('Signups open ' + event.open_date);
+    }
+    details.forEach(text => {
+        var line = document.createElement('h4');
+        line.textContent = text;
+        item.appendChild(line);
+    });
+
+    var seats = document.createElement('h4');
+    if (event.cancelled) {
+        seats.textContent = 'Cancelled' + (event.cancellation_reason ? ': ' + event.cancellation_reason : '');
+        seats.className = 'invalid-text';
+    } else {
+        seats.textContent = 'Seats remaining: ' + event.seats_remaining + '/' + event.total_seats;
+        seats.className = event.seats_remaining > 0 ? 'valid-text' : 'invalid-text';
+    }
+    item.appendChild(seats);
+
+    var link = document.createElement('a');
+    link.href = '/register?event=' + event.event_id;
+    link.className = 'event-link';
+    if (!event.open) {
+        link.textContent = 'view';
+    } else if (event.allocation_mode == 'ballot') {
+        link.textContent = 'enter ballot';
+    } else if (event.seats_remaining > 0) {
+        link.textContent = 'register';
+    } else {
+        link.textContent = 'join waitlist';
+    }
+    item.appendChild(link);
+
+    return item;
+}
@@ -7,9 +7,32 @@ form.addEventListener('submit', function (event) {
     
 })
 
+// Drivers offer their vehicle instead of taking a seat, the committee confirms it before it counts
+var driving = document.getElementById('driving');
+driving.addEventListener('change', function () {
+    document.getElementById('driver-fields').classList.toggle('disabled', !driving.checked);
+    document.getElementById('capacity').required = driving.checked;
+    // Drivers are emailed their passenger list
+    document.getElementById('email').required = driving.checked || allocationMode == 'ballot';
+    setButtonText(registerText);
+});
+
+// registerText is what registering as a passenger does right now, shown unless offering to drive
+var registerText = 'register';
+
+function setButtonText(text) {
+    registerText = text;
+    document.getElementById('submit-button-content').textContent = driving.checked ? 'offer to drive' : registerText;
+}
+
 const urlParams = new URLSearchParams(window.location.search);
 const eventId = parseInt(urlParams.get('event'), 10);
 
+// Without an event there's nothing to register for, so show the list of sessions instead
+if (isNaN(eventId)) {
+    window.location.replace('/events');
+}
+
 
 const societyGreen = '#45B91A';
 const bsDanger = '#DC3545';
@@ -27,7 +50,7 @@ async function registerLogic() {
 
     setTimeout(() => {
         // Reset button
-        buttonContent.innerHTML = 'register';
+        setButtonText(registerText);
         buttonContent.style.backgroundColor = societyGreen;
         button.disabled = false;
         fetchEventDetails();
@@ -36,17 +59,33 @@ async function registerLogic() {
 
 async function fetchRegisterAPI() {
     var buttonContent = document.getElementById('submit-button-content');
-    var name = form.elements['name'].value;
+    var givenName = form.elements['given_name'].value;
+    var familyName = form.elements['family_name'].value;
+    var preferredName = form.elements['preferred_name'].value;
     var member = document.getElementById('member').checked;
+    var email = document.getElementById('email').value;
+    var reminders = document.getElementById('reminders').checked;
 
     var jsonData = {
-        name: name,
+        given_name: givenName,
+        family_name: familyName,
+        preferred_name: preferredName,
         member: member,
+        email: email,
+        reminders: reminders,
         event: eventId
     }
 
+    var url = '/api/register';
+    if (driving.checked) {
+        url = '/api/drivers';
+        jsonData.capacity = parseInt(document.getElementById('capacity').value, 10);
+        jsonData.vehicle_name = document.getElementById('vehicle_name').value;
+        jsonData.departure_point = document.getElementById('departure_point').value;
+    }
+
     try {
-        const response = await fetch('/api/register', {
+        const response = await fetch(url, {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'
@@ -99,6 +138,7 @@ function responseText(text, success) {
 
 var countDownDate;
 var openDate;
+var allocationMode;
 
 function fetchEventDetails() {
     fetch('/api/event?event='+eventId)
@@ -117,14 +157,29 @@ function fetchEventDetails() {
         document.getElementById('meet-point').textContent = data.meet_point;
         document.getElementById('current-seats').textContent = seats_remaining;
         document.getElementById('max-seats').textContent = data.total_seats;
+        document.getElementById('event-calendar-link').href = '/calendar/event.ics?event=' + eventId;
         
-        if (seats_remaining >= 1) {
+        if (data.status == 'cancelled') {
+            showCancelled(data.cancellation_reason);
+            return;
+        }
+
+        // A reopened event whose ballot has been drawn is first come first served
+        allocationMode = data.ballot_drawn_at ? 'fcfs' : data.allocation_mode;
+        if (allocationMode == 'ballot') {
+            // Seats are drawn at random when signups close so there's no rush to register
+            document.getElementById('register-heading').textContent = 'Enter the ballot for a seat, results are emailed when signups close';
+            document.getElementById('email').required = true;
+            setButtonText('enter ballot');
+        } else if (seats_remaining >= 1) {
             document.getElementById('current-seats').classList.remove('invalid-text');
             document.getElementById('current-seats').classList.add('valid-text');
+            setButtonText('register');
         } else {
+            // Registrations still go through when full, they join the waitlist instead
             document.getElementById('current-seats').classList.remove('valid-text');
             document.getElementById('current-seats').classList.add('invalid-text');
-            document.getElementById('submit-button').disabled = true;
+            setButtonText('join waitlist');
         }
 
         countDownDate = convertToDate(data.close_date);
@@ -137,6 +192,17 @@ function fetchEventDetails() {
     });
 }
 
+// showCancelled replaces the form with the reason the committee gave, so nobody turns up for nothing
+function showCancelled(reason) {
+    document.getElementById('register-heading').textContent = 'This session has been cancelled';
+    document.getElementById('registerForm').classList.add('disabled');
+    document.getElementById('submit-button').disabled = true;
+    document.getElementById('cancelled-text').textContent = reason;
+    document.getElementById('countdown-closed-text').textContent = 'CANCELLED';
+    // Ends the countdown, which then shows the closed text
+    countDownDate = 0;
+}
+
 function convertToDate(dateString) {
     var parts = dateString.split(' ');
     var datePart = parts[0].split('/');
@@ -154,8 +220,47 @@ function convertToDate(dateString) {
 
 document.addEventListener('DOMContentLoaded', () => {
     fetchEventDetails(eventId);
+    watchSeats();
 })
 
+// LIVE SEATS SECTION
+
+// watchSeats keeps the seats remaining up to date as people register, the browser reconnects by itself if the stream drops
+function watchSeats() {
+    if (!window.EventSource) {
+        return;
+    }
+
+    const stream = new EventSource('/api/events/stream?event=' + eventId);
+    stream.addEventListener('seats', message => {
+        const update = JSON.parse(message.data);
+        if (update.change == 'deleted') {
+            stream.close();
+            return;
+        }
+        if (update.change == 'updated' || update.change == 'closed' || update.change == 'cancelled') {
+            // Anything about the event may have changed, not just the seats
+            fetchEventDetails();
+            return;
+        }
+
+        document.getElementById('current-seats').textContent = update.seats_remaining;
+        document.getElementById('max-seats').textContent = update.total_seats;
+        if (allocationMode == 'ballot') {
+            return;
+        }
+        if (update.seats_remaining >= 1) {
+            document.getElementById('current-seats').classList.remove('invalid-text');
+            document.getElementById('current-seats').classList.add('valid-text');
+            setButtonText('register');
+        } else {
+            document.getElementById('current-seats').classList.remove('valid-text');
+            document.getElementById('current-seats').classList.add('invalid-text');
+            setButtonText('join waitlist');
+        }
+    });
+}
+
 // COUNTDOWN SECTION
 
 const second = 1000,